@@ -4,12 +4,15 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"github.com/bazo-blockchain/bazo-miner/crypto"
+	"github.com/bazo-blockchain/bazo-miner/metrics"
 	"github.com/bazo-blockchain/bazo-miner/miner"
 	"github.com/bazo-blockchain/bazo-miner/p2p"
+	"github.com/bazo-blockchain/bazo-miner/rpc"
 	"github.com/bazo-blockchain/bazo-miner/storage"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 	"log"
+	"time"
 )
 
 type startArgs struct {
@@ -21,6 +24,10 @@ type startArgs struct {
 	commitmentFile			string
 	rootKeyFile				string
 	rootCommitmentFile		string
+	rpcAddress				string
+	metricsAddress			string
+	memPoolSize				uint64
+	memPoolExpiry			time.Duration
 }
 
 func GetStartCommand(logger *log.Logger) cli.Command {
@@ -37,6 +44,10 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 				commitmentFile:			c.String("commitment"),
 				rootKeyFile:			c.String("rootwallet"),
 				rootCommitmentFile: 	c.String("rootcommitment"),
+				rpcAddress:				c.String("rpc"),
+				metricsAddress:			c.String("metrics"),
+				memPoolSize:			c.Uint64("mempoolsize"),
+				memPoolExpiry:			c.Duration("mempoolexpiry"),
 			}
 
 			if !c.IsSet("bootstrap") {
@@ -96,6 +107,24 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 				Usage: 	"load root's RSA public-private key from `FILE`",
 				Value: 	"commitment.txt",
 			},
+			cli.StringFlag {
+				Name: 	"rpc",
+				Usage: 	"serve the JSON-RPC API at `IP:PORT` (disabled if not set)",
+			},
+			cli.StringFlag {
+				Name: 	"metrics",
+				Usage: 	"serve Prometheus metrics at `IP:PORT`/metrics (disabled if not set)",
+			},
+			cli.Uint64Flag {
+				Name: 	"mempoolsize",
+				Usage: 	"cap the mempool at `MB` megabytes, the txs with the lowest fee are evicted",
+				Value: 	storage.MEMPOOL_MAX_SIZE >> 20,
+			},
+			cli.DurationFlag {
+				Name: 	"mempoolexpiry",
+				Usage: 	"purge txs from the mempool that have not been included in a block after `DURATION`",
+				Value: 	storage.MEMPOOL_TX_EXPIRY,
+			},
 			cli.BoolFlag {
 				Name: 	"confirm",
 				Usage: 	"user must press enter before starting the miner",
@@ -105,9 +134,23 @@ func GetStartCommand(logger *log.Logger) cli.Command {
 }
 
 func Start(args *startArgs, logger *log.Logger) error {
+	storage.MemPoolMaxSize = args.memPoolSize << 20
+	storage.MemPoolTxExpiry = args.memPoolExpiry
 	storage.Init(args.dbname, args.bootstrapNodeAddress)
 	p2p.Init(args.myNodeAddress)
 
+	if len(args.rpcAddress) > 0 {
+		go rpc.Init(args.rpcAddress)
+	}
+
+	if len(args.metricsAddress) > 0 {
+		go func() {
+			if err := metrics.Init(args.metricsAddress); err != nil {
+				logger.Printf("Metrics server stopped: %v\n", err)
+			}
+		}()
+	}
+
 	validatorPubKey, err := crypto.ExtractECDSAPublicKeyFromFile(args.walletFile)
 	if err != nil {
 		logger.Printf("%v\n", err)
@@ -176,6 +219,10 @@ func (args startArgs) ValidateInput() error {
 		return errors.New("argument missing: rootCommitmentFile")
 	}
 
+	if args.memPoolSize == 0 {
+		return errors.New("argument invalid: memPoolSize must be at least 1 MB")
+	}
+
 	return nil
 }
 
@@ -188,7 +235,11 @@ func (args startArgs) String() string {
 			"- Multisig File:\t\t %v\n" +
 			"- Commitment File:\t\t %v\n" +
 			"- Root Wallet File:\t\t %v\n" +
-			"- Root Commitment File:\t %v\n",
+			"- Root Commitment File:\t %v\n" +
+			"- RPC Address:\t\t\t %v\n" +
+			"- Metrics Address:\t\t %v\n" +
+			"- Mempool Size:\t\t %v MB\n" +
+			"- Mempool Expiry:\t\t %v\n",
 		args.dbname,
 		args.myNodeAddress,
 		args.bootstrapNodeAddress,
@@ -196,5 +247,9 @@ func (args startArgs) String() string {
 		args.multisigFile,
 		args.commitmentFile,
 		args.rootKeyFile,
-		args.rootCommitmentFile)
+		args.rootCommitmentFile,
+		args.rpcAddress,
+		args.metricsAddress,
+		args.memPoolSize,
+		args.memPoolExpiry)
 }
\ No newline at end of file
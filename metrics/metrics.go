@@ -0,0 +1,219 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//Minimal implementation of the Prometheus text exposition format. The other packages declare their metrics as package
+//variables, which registers them at program start. Values that are cheap to read on demand (e.g., the mempool size)
+//are registered as gauge functions that get evaluated on every scrape.
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registry      []metric
+	registryMutex = &sync.Mutex{}
+)
+
+type Counter struct {
+	name, help string
+	value      uint64
+}
+
+//Counter with a single label, e.g., the tx type.
+type CounterVec struct {
+	name, help, label string
+	values            map[string]uint64
+	mutex             sync.Mutex
+}
+
+type Gauge struct {
+	name, help string
+	bits       uint64
+}
+
+type GaugeFunc struct {
+	name, help string
+	value      func() float64
+}
+
+type Histogram struct {
+	name, help string
+	buckets    []float64 //Upper bounds in ascending order
+	counts     []uint64  //Not cumulative, the last count is for +Inf
+	sum        float64
+	mutex      sync.Mutex
+}
+
+func NewCounter(name, help string) *Counter {
+	counter := &Counter{name: name, help: help}
+	register(counter)
+	return counter
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	counterVec := &CounterVec{name: name, help: help, label: label, values: make(map[string]uint64)}
+	register(counterVec)
+	return counterVec
+}
+
+func NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{name: name, help: help}
+	register(gauge)
+	return gauge
+}
+
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	gaugeFunc := &GaugeFunc{name, help, value}
+	register(gaugeFunc)
+	return gaugeFunc
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	histogram := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+	register(histogram)
+	return histogram
+}
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, m)
+}
+
+func (counter *Counter) Inc() {
+	atomic.AddUint64(&counter.value, 1)
+}
+
+func (counter *Counter) Value() uint64 {
+	return atomic.LoadUint64(&counter.value)
+}
+
+func (counterVec *CounterVec) Inc(labelValue string) {
+	counterVec.mutex.Lock()
+	defer counterVec.mutex.Unlock()
+
+	counterVec.values[labelValue]++
+}
+
+func (counterVec *CounterVec) Value(labelValue string) uint64 {
+	counterVec.mutex.Lock()
+	defer counterVec.mutex.Unlock()
+
+	return counterVec.values[labelValue]
+}
+
+func (gauge *Gauge) Set(value float64) {
+	atomic.StoreUint64(&gauge.bits, math.Float64bits(value))
+}
+
+func (gauge *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&gauge.bits))
+}
+
+func (histogram *Histogram) Observe(value float64) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	index := sort.SearchFloat64s(histogram.buckets, value)
+	histogram.counts[index]++
+	histogram.sum += value
+}
+
+func (counter *Counter) write(w io.Writer) {
+	writeHeader(w, counter.name, counter.help, "counter")
+	fmt.Fprintf(w, "%v %v\n", counter.name, counter.Value())
+}
+
+func (counterVec *CounterVec) write(w io.Writer) {
+	counterVec.mutex.Lock()
+	defer counterVec.mutex.Unlock()
+
+	labelValues := make([]string, 0, len(counterVec.values))
+	for labelValue := range counterVec.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	writeHeader(w, counterVec.name, counterVec.help, "counter")
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(w, "%v{%v=%q} %v\n", counterVec.name, counterVec.label, labelValue, counterVec.values[labelValue])
+	}
+}
+
+func (gauge *Gauge) write(w io.Writer) {
+	writeHeader(w, gauge.name, gauge.help, "gauge")
+	fmt.Fprintf(w, "%v %v\n", gauge.name, formatFloat(gauge.Value()))
+}
+
+func (gaugeFunc *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, gaugeFunc.name, gaugeFunc.help, "gauge")
+	fmt.Fprintf(w, "%v %v\n", gaugeFunc.name, formatFloat(gaugeFunc.value()))
+}
+
+func (histogram *Histogram) write(w io.Writer) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	writeHeader(w, histogram.name, histogram.help, "histogram")
+	var cumulative uint64
+	for i, bound := range histogram.buckets {
+		cumulative += histogram.counts[i]
+		fmt.Fprintf(w, "%v_bucket{le=\"%v\"} %v\n", histogram.name, formatFloat(bound), cumulative)
+	}
+	cumulative += histogram.counts[len(histogram.buckets)]
+	fmt.Fprintf(w, "%v_bucket{le=\"+Inf\"} %v\n", histogram.name, cumulative)
+	fmt.Fprintf(w, "%v_sum %v\n", histogram.name, formatFloat(histogram.sum))
+	fmt.Fprintf(w, "%v_count %v\n", histogram.name, cumulative)
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	help = strings.Replace(strings.Replace(help, `\`, `\\`, -1), "\n", `\n`, -1)
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, metricType)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return fmt.Sprintf("%g", value)
+}
+
+//Writes all registered metrics in the text exposition format.
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, m := range registry {
+		m.write(w)
+	}
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	Write(w)
+}
+
+//Entry function for the metrics package, serves the metrics at http://IP:Port/metrics until the server fails.
+func Init(address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+
+	counter := NewCounter("test_counter_total", "A counter.")
+	counterVec := NewCounterVec("test_labeled_total", "A labeled counter.", "type")
+	gauge := NewGauge("test_gauge", "A gauge.")
+	NewGaugeFunc("test_gauge_func", "A gauge function.", func() float64 { return 42 })
+	histogram := NewHistogram("test_seconds", "A histogram.", []float64{0.1, 1})
+
+	counter.Inc()
+	counter.Inc()
+	counterVec.Inc("funds")
+	gauge.Set(-1.5)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+
+	var buffer bytes.Buffer
+	Write(&buffer)
+	output := buffer.String()
+
+	expected := []string{
+		"# HELP test_counter_total A counter.\n# TYPE test_counter_total counter\ntest_counter_total 2\n",
+		"# TYPE test_labeled_total counter\ntest_labeled_total{type=\"funds\"} 1\n",
+		"test_gauge -1.5\n",
+		"test_gauge_func 42\n",
+		"# TYPE test_seconds histogram\n" +
+			"test_seconds_bucket{le=\"0.1\"} 1\n" +
+			"test_seconds_bucket{le=\"1\"} 2\n" +
+			"test_seconds_bucket{le=\"+Inf\"} 3\n" +
+			"test_seconds_sum 2.55\n" +
+			"test_seconds_count 3\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line) {
+			t.Errorf("Output does not contain\n%v\nOutput:\n%v", line, output)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "test_gauge_func 42\n") {
+		t.Errorf("Metrics not served:\n%v", rec.Body.String())
+	}
+}
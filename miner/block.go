@@ -10,7 +10,6 @@ import (
 	"github.com/bazo-blockchain/bazo-miner/p2p"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/bazo-blockchain/bazo-miner/storage"
-	"github.com/bazo-blockchain/bazo-vm/vm"
 	"github.com/bazo-blockchain/bazo-miner/crypto"
 	"golang.org/x/crypto/sha3"
 )
@@ -21,7 +20,10 @@ type blockData struct {
 	fundsTxSlice  []*protocol.FundsTx
 	configTxSlice []*protocol.ConfigTx
 	stakeTxSlice  []*protocol.StakeTx
+	batchTxSlice  []*protocol.BatchTx
+	keyTxSlice    []*protocol.KeyTx
 	block         *protocol.Block
+	contractDiff  *protocol.ContractDiff //Filled when the block is applied, needed to roll it back
 }
 
 //Block constructor, argument is the previous block in the blockchain.
@@ -61,6 +63,15 @@ func finalizeBlock(block *protocol.Block) error {
 	validatorAccHash := validatorAcc.Hash()
 	copy(block.Beneficiary[:], validatorAccHash[:])
 
+	//The state root commits to the state after applying the block, the receipts root to the outcome of its txs. They
+	//are calculated on a copy of the state, which must not change in the meantime.
+	blockValidation.Lock()
+	block.StateRoot, block.ReceiptsRoot, err = calculateRoots(block)
+	blockValidation.Unlock()
+	if err != nil {
+		return err
+	}
+
 	// Cryptographic Sortition for PoS in Bazo
 	// The commitment proof stores a signed message of the Height that this block was created at.
 	commitmentProof, err := crypto.SignMessageWithRSAKey(commPrivKey, fmt.Sprint(block.Height))
@@ -68,7 +79,6 @@ func finalizeBlock(block *protocol.Block) error {
 		return err
 	}
 
-	partialHash := block.HashBlock()
 	prevProofs := GetLatestProofs(activeParameters.num_included_prev_proofs, block)
 
 	nonce, err := proofOfStake(getDifficulty(), block.PrevHash, prevProofs, block.Height, validatorAcc.Balance, commitmentProof)
@@ -81,20 +91,28 @@ func finalizeBlock(block *protocol.Block) error {
 	block.Nonce = nonceBuf
 	block.Timestamp = nonce
 
-	//Put pieces together to get the final hash.
-	block.Hash = sha3.Sum256(append(nonceBuf[:], partialHash[:]...))
+	copy(block.CommitmentProof[0:crypto.COMM_PROOF_LENGTH], commitmentProof[:])
+
+	//The hash is calculated after all hashed fields are set, such that other miners can recalculate it.
+	block.Hash = blockHash(block)
 
 	//This doesn't need to be hashed, because we already have the merkle tree taking care of consistency.
 	block.NrAccTx = uint16(len(block.AccTxData))
 	block.NrFundsTx = uint16(len(block.FundsTxData))
 	block.NrConfigTx = uint8(len(block.ConfigTxData))
 	block.NrStakeTx = uint16(len(block.StakeTxData))
-
-	copy(block.CommitmentProof[0:crypto.COMM_PROOF_LENGTH], commitmentProof[:])
+	block.NrBatchTx = uint16(len(block.BatchTxData))
+	block.NrKeyTx = uint16(len(block.KeyTxData))
 
 	return nil
 }
 
+//Put pieces together to get the final hash.
+func blockHash(block *protocol.Block) [32]byte {
+	partialHash := block.HashBlock()
+	return sha3.Sum256(append(block.Nonce[:], partialHash[:]...))
+}
+
 //Transaction validation operates on a copy of a tiny subset of the state (all accounts involved in transactions).
 //We do not operate global state because the work might get interrupted by receiving a block that needs validation
 //which is done on the global state.
@@ -118,6 +136,11 @@ func addTx(b *protocol.Block, tx protocol.Transaction) error {
 		return errors.New("Transaction could not be verified.")
 	}
 
+	if protocol.IsExpired(tx, b.Height) {
+		logger.Printf("Transaction (%x) has expired at block height %v.\n", tx.Hash(), b.Height)
+		return errors.New(fmt.Sprintf("Transaction has expired at block height %v.", b.Height))
+	}
+
 	switch tx.(type) {
 	case *protocol.AccTx:
 		err := addAccTx(b, tx.(*protocol.AccTx))
@@ -144,6 +167,18 @@ func addTx(b *protocol.Block, tx protocol.Transaction) error {
 			logger.Printf("Adding stakeTx (%x) failed (%v): %v\n",tx.Hash(), err, tx.(*protocol.StakeTx))
 			return err
 		}
+	case *protocol.BatchTx:
+		err := addBatchTx(b, tx.(*protocol.BatchTx))
+		if err != nil {
+			logger.Printf("Adding batchTx (%x) failed (%v): %v\n", tx.Hash(), err, tx.(*protocol.BatchTx))
+			return err
+		}
+	case *protocol.KeyTx:
+		err := addKeyTx(b, tx.(*protocol.KeyTx))
+		if err != nil {
+			logger.Printf("Adding keyTx (%x) failed (%v): %v\n", tx.Hash(), err, tx.(*protocol.KeyTx))
+			return err
+		}
 	default:
 		return errors.New("Transaction type not recognized.")
 	}
@@ -168,15 +203,17 @@ func addAccTx(b *protocol.Block, tx *protocol.AccTx) error {
 }
 
 func addFundsTx(b *protocol.Block, tx *protocol.FundsTx) error {
+	if isLockedTx(tx, lastBlock) {
+		return errors.New(fmt.Sprintf("Transaction is locked until height %v and time %v.\n", tx.LockHeight, tx.LockTime))
+	}
+
 	//Checking if the sender account is already in the local state copy. If not and account exist, create local copy.
 	//If account does not exist in state, abort.
 	if _, exists := b.StateCopy[tx.From]; !exists {
 		if acc := storage.State[tx.From]; acc != nil {
 			hash := protocol.SerializeHashContent(acc.Address)
 			if hash == tx.From {
-				newAcc := protocol.Account{}
-				newAcc = *acc
-				b.StateCopy[tx.From] = &newAcc
+				b.StateCopy[tx.From] = copyAccount(acc)
 			}
 		} else {
 			return errors.New(fmt.Sprintf("Sender account not present in the state: %x\n", tx.From))
@@ -188,9 +225,7 @@ func addFundsTx(b *protocol.Block, tx *protocol.FundsTx) error {
 		if acc := storage.State[tx.To]; acc != nil {
 			hash := protocol.SerializeHashContent(acc.Address)
 			if hash == tx.To {
-				newAcc := protocol.Account{}
-				newAcc = *acc
-				b.StateCopy[tx.To] = &newAcc
+				b.StateCopy[tx.To] = copyAccount(acc)
 			}
 		} else {
 			return errors.New(fmt.Sprintf("Receiver account not present in the state: %x\n", tx.To))
@@ -217,27 +252,28 @@ func addFundsTx(b *protocol.Block, tx *protocol.FundsTx) error {
 		return errors.New(err)
 	}
 
-	//Check if transaction has data and the receiver account has a smart contract
-	if tx.Data != nil && b.StateCopy[tx.To].Contract != nil {
-		context := protocol.NewContext(*b.StateCopy[tx.To], *tx)
-		virtualMachine := vm.NewVM(context)
-
-		// Check if vm execution run without error
-		if !virtualMachine.Exec(false) {
-			return errors.New(virtualMachine.GetErrorMsg())
+	//Check if transaction has data and the receiver account has a smart contract. The contract runs on the state
+	//copy, the global state is only changed when the block is validated. The amount of a failed call is not transferred.
+	amount := tx.Amount
+	if isContractCall(tx, b.StateCopy[tx.To]) {
+		if err := checkBlockGas(tx, b.ContractGas); err != nil {
+			return err
 		}
 
-		//Update changes vm has made to the contract variables
-		context.PersistChanges()
+		call := execContract(tx, b.StateCopy[tx.To])
+		b.ContractGas += call.GasLimit
+		if call.Failed {
+			amount = 0
+		}
 	}
 
 	//Update state copy.
 	accSender := b.StateCopy[tx.From]
 	accSender.TxCnt += 1
-	accSender.Balance -= tx.Amount
+	accSender.Balance -= amount
 
 	accReceiver := b.StateCopy[tx.To]
-	accReceiver.Balance += tx.Amount
+	accReceiver.Balance += amount
 
 	//Add the tx hash to the block header and write it to open storage (non-validated transactions).
 	b.FundsTxData = append(b.FundsTxData, tx.Hash())
@@ -245,6 +281,94 @@ func addFundsTx(b *protocol.Block, tx *protocol.FundsTx) error {
 	return nil
 }
 
+func addBatchTx(b *protocol.Block, tx *protocol.BatchTx) error {
+	//Same as for fundsTxs, the sender and all receivers need a local state copy.
+	accHashes := [][32]byte{tx.From}
+	for _, payment := range tx.Payments {
+		accHashes = append(accHashes, payment.To)
+	}
+
+	for _, accHash := range accHashes {
+		if _, exists := b.StateCopy[accHash]; !exists {
+			if acc := storage.State[accHash]; acc != nil {
+				b.StateCopy[accHash] = copyAccount(acc)
+			} else {
+				return errors.New(fmt.Sprintf("Account not present in the state: %x\n", accHash))
+			}
+		}
+	}
+
+	//The amounts have been checked for overflows with verify().
+	total := tx.TotalAmount()
+	if !storage.IsRootKey(tx.From) {
+		if (total + tx.Fee) > b.StateCopy[tx.From].Balance {
+			return errors.New("Not enough funds to complete the transaction!")
+		}
+	}
+
+	if b.StateCopy[tx.From].TxCnt != tx.TxCnt {
+		err := fmt.Sprintf("Sender txCnt does not match: %v (tx.txCnt) vs. %v (state txCnt)", tx.TxCnt, b.StateCopy[tx.From].TxCnt)
+		return errors.New(err)
+	}
+
+	//A receiver may be paid several times, the sum must not overflow its balance.
+	received := make(map[[32]byte]uint64)
+	for _, payment := range tx.Payments {
+		received[payment.To] += payment.Amount
+		if b.StateCopy[payment.To].Balance+received[payment.To] > MAX_MONEY {
+			err := fmt.Sprintf("Payment amount (%v) leads to overflow at receiver account balance (%v).\n", payment.Amount, b.StateCopy[payment.To].Balance)
+			return errors.New(err)
+		}
+	}
+
+	//Update state copy.
+	accSender := b.StateCopy[tx.From]
+	accSender.TxCnt += 1
+	accSender.Balance -= total
+
+	for _, payment := range tx.Payments {
+		b.StateCopy[payment.To].Balance += payment.Amount
+	}
+
+	b.BatchTxData = append(b.BatchTxData, tx.Hash())
+	logger.Printf("Added tx (%x) to the BatchTxData slice: %v", tx.Hash(), *tx)
+	return nil
+}
+
+func addKeyTx(b *protocol.Block, tx *protocol.KeyTx) error {
+	if _, exists := b.StateCopy[tx.Account]; !exists {
+		if acc := storage.State[tx.Account]; acc != nil {
+			b.StateCopy[tx.Account] = copyAccount(acc)
+		} else {
+			return errors.New(fmt.Sprintf("Account not present in the state: %x\n", tx.Account))
+		}
+	}
+
+	//The fee is paid by the account itself, root accounts do not issue coins for it.
+	if tx.Fee > b.StateCopy[tx.Account].Balance {
+		return errors.New("Not enough funds to complete the transaction!")
+	}
+
+	if b.StateCopy[tx.Account].TxCnt != tx.TxCnt {
+		err := fmt.Sprintf("Sender txCnt does not match: %v (tx.txCnt) vs. %v (state txCnt)", tx.TxCnt, b.StateCopy[tx.Account].TxCnt)
+		return errors.New(err)
+	}
+
+	//The old key has to match the state, a second keyTx of the account in the same block therefore fails.
+	if b.StateCopy[tx.Account].PubKey() != tx.OldKey {
+		return errors.New("Old key does not match the signing key of the account.")
+	}
+
+	//Update state copy.
+	acc := b.StateCopy[tx.Account]
+	acc.TxCnt += 1
+	acc.SetPubKey(tx.NewKey)
+
+	b.KeyTxData = append(b.KeyTxData, tx.Hash())
+	logger.Printf("Added tx (%x) to the KeyTxData slice: %v", tx.Hash(), *tx)
+	return nil
+}
+
 func addConfigTx(b *protocol.Block, tx *protocol.ConfigTx) error {
 	//No further checks needed, static checks were already done with verify().
 	b.ConfigTxData = append(b.ConfigTxData, tx.Hash())
@@ -292,197 +416,135 @@ func addStakeTx(b *protocol.Block, tx *protocol.StakeTx) error {
 	return nil
 }
 
-//We use slices (not maps) because order is now important.
-func fetchAccTxData(block *protocol.Block, accTxSlice []*protocol.AccTx, initialSetup bool, errChan chan error) {
-	for cnt, txHash := range block.AccTxData {
-		var tx protocol.Transaction
-		var accTx *protocol.AccTx
-
-		closedTx := storage.ReadClosedTx(txHash)
-		if closedTx != nil {
-			if initialSetup {
-				accTx = closedTx.(*protocol.AccTx)
-				accTxSlice[cnt] = accTx
-				continue
-			} else {
-				//Reject blocks that have txs which have already been validated.
-				errChan <- errors.New("Block validation had accTx that was already in a previous block.")
-				return
-			}
+//We use slices (not maps) because order is now important. The txs are read from closed storage (only during the
+//initial setup), from the mempool, from the staging area of the sync, from the invalid tx stash or fetched from the
+//network, in this order. Every tx is passed to add together with its position, which returns false if the tx does not
+//have the expected type.
+func fetchTxData(txHashes [][32]byte, reqType uint8, initialSetup bool, add func(int, protocol.Transaction) bool, errChan chan error) {
+	for cnt, txHash := range txHashes {
+		tx, err := fetchTx(txHash, reqType, initialSetup)
+		if err != nil {
+			errChan <- err
+			return
 		}
 
-		//TODO Optimize code (duplicated)
-		//Tx is either in open storage or needs to be fetched from the network.
-		tx = storage.ReadOpenTx(txHash)
-		if tx != nil {
-			accTx = tx.(*protocol.AccTx)
-		} else {
-			err := p2p.TxReq(txHash, p2p.ACCTX_REQ)
-			if err != nil {
-				errChan <- errors.New(fmt.Sprintf("AccTx could not be read: %v", err))
-				return
-			}
-
-			//Blocking Wait
-			select {
-			case accTx = <-p2p.AccTxChan:
-				//Limit the waiting time for TXFETCH_TIMEOUT seconds.
-			case <-time.After(TXFETCH_TIMEOUT * time.Second):
-				errChan <- errors.New("AccTx fetch timed out.")
-			}
-			//This check is important. A malicious miner might have sent us a tx whose hash is a different one
-			//from what we requested.
-			if accTx.Hash() != txHash {
-				errChan <- errors.New("Received txHash did not correspond to our request.")
-			}
+		if !add(cnt, tx) {
+			errChan <- errors.New(fmt.Sprintf("Transaction (%x) is not of type %v.", txHash[0:8], txReqNames[reqType]))
+			return
 		}
-
-		accTxSlice[cnt] = accTx
 	}
 
 	errChan <- nil
 }
 
-func fetchFundsTxData(block *protocol.Block, fundsTxSlice []*protocol.FundsTx, initialSetup bool, errChan chan error) {
-	for cnt, txHash := range block.FundsTxData {
-		var tx protocol.Transaction
-		var fundsTx *protocol.FundsTx
-
-		closedTx := storage.ReadClosedTx(txHash)
-		if closedTx != nil {
-			if initialSetup {
-				fundsTx = closedTx.(*protocol.FundsTx)
-				fundsTxSlice[cnt] = fundsTx
-				continue
-			} else {
-				errChan <- errors.New("Block validation had fundsTx that was already in a previous block.")
-				return
-			}
+func fetchTx(txHash [32]byte, reqType uint8, initialSetup bool) (protocol.Transaction, error) {
+	if tx := storage.ReadClosedTx(txHash); tx != nil {
+		if !initialSetup {
+			//Reject blocks that have txs which have already been validated.
+			return nil, errors.New(fmt.Sprintf("Block validation had %v that was already in a previous block.", txReqNames[reqType]))
 		}
+		return tx, nil
+	}
 
-		//TODO Optimize code (duplicated)
-		//We check if the Transaction is in the invalidOpenTX stash. When it is in there, and it is valid now, we save
-		//it into the fundsTX and continue like usual. This additional stash does lower the amount of network requests. 
-		tx = storage.ReadOpenTx(txHash)
-		txINVALID := storage.ReadINVALIDOpenTx(txHash)
-		if tx != nil {
-			fundsTx = tx.(*protocol.FundsTx)
-		} else if  txINVALID != nil && verify(txINVALID) {
-			fundsTx = txINVALID.(*protocol.FundsTx)
-		} else {
-			err := p2p.TxReq(txHash, p2p.FUNDSTX_REQ)
-			if err != nil {
-				errChan <- errors.New(fmt.Sprintf("FundsTx could not be read: %v", err))
-				return
-			}
-			select {
-			case fundsTx = <-p2p.FundsTxChan:
-				storage.WriteOpenTx(fundsTx)
-			case <-time.After(TXFETCH_TIMEOUT * time.Second):
-				errChan <- errors.New("FundsTx fetch timed out")
-				return
-			}
-			if fundsTx.Hash() != txHash {
-				errChan <- errors.New("Received txHash did not correspond to our request.")
-			}
+	if tx := storage.ReadOpenTx(txHash); tx != nil {
+		return tx, nil
+	}
+	if initialSetup {
+		if tx := readSyncedTx(txHash); tx != nil {
+			return tx, nil
 		}
-
-		fundsTxSlice[cnt] = fundsTx
+	}
+	//Txs that could not be added to a block before may be valid now. This lowers the amount of network requests.
+	if tx := storage.ReadINVALIDOpenTx(txHash); tx != nil && verify(tx) {
+		return tx, nil
 	}
 
-	errChan <- nil
-}
+	if err := p2p.TxReq(txHash, reqType); err != nil {
+		return nil, errors.New(fmt.Sprintf("%v could not be read: %v", txReqNames[reqType], err))
+	}
 
-func fetchConfigTxData(block *protocol.Block, configTxSlice []*protocol.ConfigTx, initialSetup bool, errChan chan error) {
-	for cnt, txHash := range block.ConfigTxData {
-		var tx protocol.Transaction
-		var configTx *protocol.ConfigTx
-
-		closedTx := storage.ReadClosedTx(txHash)
-		if closedTx != nil {
-			if initialSetup {
-				configTx = closedTx.(*protocol.ConfigTx)
-				configTxSlice[cnt] = configTx
-				continue
-			} else {
-				errChan <- errors.New("Block validation had configTx that was already in a previous block.")
-				return
-			}
+	//Responses to earlier requests (or txs sent by a malicious miner) whose hash is a different one from what we
+	//requested are skipped.
+	timeout := time.After(TXFETCH_TIMEOUT * time.Second)
+	for {
+		tx := receiveTx(reqType, timeout)
+		if tx == nil {
+			txFetchTimeouts.Inc(txReqLabels[reqType])
+			return nil, errors.New(fmt.Sprintf("%v fetch timed out.", txReqNames[reqType]))
 		}
 
-		//TODO Optimize code (duplicated)
-		tx = storage.ReadOpenTx(txHash)
-		if tx != nil {
-			configTx = tx.(*protocol.ConfigTx)
-		} else {
-			err := p2p.TxReq(txHash, p2p.CONFIGTX_REQ)
-			if err != nil {
-				errChan <- errors.New(fmt.Sprintf("ConfigTx could not be read: %v", err))
-				return
-			}
-
-			select {
-			case configTx = <-p2p.ConfigTxChan:
-			case <-time.After(TXFETCH_TIMEOUT * time.Second):
-				errChan <- errors.New("ConfigTx fetch timed out.")
-				return
-			}
-			if configTx.Hash() != txHash {
-				errChan <- errors.New("Received txHash did not correspond to our request.")
-			}
+		if tx.Hash() == txHash {
+			//The tx stays in the mempool in case the block turns out to be invalid.
+			storage.WriteOpenTx(tx)
+			return tx, nil
 		}
-
-		configTxSlice[cnt] = configTx
 	}
-
-	errChan <- nil
 }
 
-func fetchStakeTxData(block *protocol.Block, stakeTxSlice []*protocol.StakeTx, initialSetup bool, errChan chan error) {
-	for cnt, txHash := range block.StakeTxData {
-		var tx protocol.Transaction
-		var stakeTx *protocol.StakeTx
-
-		closedTx := storage.ReadClosedTx(txHash)
-		if closedTx != nil {
-			if initialSetup {
-				stakeTx = closedTx.(*protocol.StakeTx)
-				stakeTxSlice[cnt] = stakeTx
-				continue
-			} else {
-				errChan <- errors.New("Block validation had stakeTx that was already in a previous block.")
-				return
-			}
+//Returns the next tx received for the given request type, nil once the timeout has passed.
+func receiveTx(reqType uint8, timeout <-chan time.Time) protocol.Transaction {
+	switch reqType {
+	case p2p.ACCTX_REQ:
+		select {
+		case tx := <-p2p.AccTxChan:
+			return tx
+		case <-timeout:
 		}
-
-		//TODO Optimize code (duplicated)
-		tx = storage.ReadOpenTx(txHash)
-		if tx != nil {
-			stakeTx = tx.(*protocol.StakeTx)
-		} else {
-			err := p2p.TxReq(txHash, p2p.STAKETX_REQ)
-			if err != nil {
-				errChan <- errors.New(fmt.Sprintf("StakeTx could not be read: %v", err))
-				return
-			}
-
-			select {
-			case stakeTx = <-p2p.StakeTxChan:
-			case <-time.After(TXFETCH_TIMEOUT * time.Second):
-				errChan <- errors.New("StakeTx fetch timed out.")
-				return
-			}
-			if stakeTx.Hash() != txHash {
-				errChan <- errors.New("Received txHash did not correspond to our request.")
-			}
+	case p2p.FUNDSTX_REQ:
+		select {
+		case tx := <-p2p.FundsTxChan:
+			return tx
+		case <-timeout:
+		}
+	case p2p.CONFIGTX_REQ:
+		select {
+		case tx := <-p2p.ConfigTxChan:
+			return tx
+		case <-timeout:
+		}
+	case p2p.STAKETX_REQ:
+		select {
+		case tx := <-p2p.StakeTxChan:
+			return tx
+		case <-timeout:
+		}
+	case p2p.BATCHTX_REQ:
+		select {
+		case tx := <-p2p.BatchTxChan:
+			return tx
+		case <-timeout:
+		}
+	case p2p.KEYTX_REQ:
+		select {
+		case tx := <-p2p.KeyTxChan:
+			return tx
+		case <-timeout:
 		}
-
-		stakeTxSlice[cnt] = stakeTx
 	}
 
-	errChan <- nil
+	return nil
 }
 
+var (
+	//Tx types in errors and in the labels of the tx fetch timeouts.
+	txReqNames = map[uint8]string{
+		p2p.ACCTX_REQ:    "AccTx",
+		p2p.FUNDSTX_REQ:  "FundsTx",
+		p2p.CONFIGTX_REQ: "ConfigTx",
+		p2p.STAKETX_REQ:  "StakeTx",
+		p2p.BATCHTX_REQ:  "BatchTx",
+		p2p.KEYTX_REQ:    "KeyTx",
+	}
+	txReqLabels = map[uint8]string{
+		p2p.ACCTX_REQ:    "acc",
+		p2p.FUNDSTX_REQ:  "funds",
+		p2p.CONFIGTX_REQ: "config",
+		p2p.STAKETX_REQ:  "stake",
+		p2p.BATCHTX_REQ:  "batch",
+		p2p.KEYTX_REQ:    "key",
+	}
+)
+
 //This function is split into block syntax/PoS check and actual state change
 //because there is the case that we might need to go fetch several blocks
 // and have to check the blocks first before changing the state in the correct order.
@@ -494,6 +556,9 @@ func validate(b *protocol.Block, initialSetup bool) error {
 	blockValidation.Lock()
 	defer blockValidation.Unlock()
 
+	start := time.Now()
+	defer func() { validationLatency.Observe(time.Since(start).Seconds()) }()
+
 	//Prepare datastructure to fill tx payloads.
 	blockDataMap := make(map[[32]byte]blockData)
 
@@ -517,7 +582,7 @@ func validate(b *protocol.Block, initialSetup bool) error {
 	if len(blocksToRollback) == 0 {
 		for _, block := range blocksToValidate {
 			//Fetching payload data from the txs (if necessary, ask other miners).
-			accTxs, fundsTxs, configTxs, stakeTxs, err := preValidate(block, initialSetup)
+			accTxs, fundsTxs, configTxs, stakeTxs, batchTxs, keyTxs, err := preValidate(block, initialSetup)
 
 			//Check if the validator that added the block has previously voted on different competing chains (find slashing proof).
 			//The proof will be stored in the global slashing dictionary.
@@ -529,7 +594,7 @@ func validate(b *protocol.Block, initialSetup bool) error {
 				return err
 			}
 
-			blockDataMap[block.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, block}
+			blockDataMap[block.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, batchTxs, keyTxs, block, new(protocol.ContractDiff)}
 			if err := validateState(blockDataMap[block.Hash]); err != nil {
 				return err
 			}
@@ -537,15 +602,23 @@ func validate(b *protocol.Block, initialSetup bool) error {
 			postValidate(blockDataMap[block.Hash], initialSetup)
 		}
 	} else {
+		//Txs of the rolled back blocks that are not part of the new chain go back to the mempool, even if the new chain
+		//turns out to be invalid.
+		var rolledBackTxs []protocol.Transaction
+		defer func() { reinjectTxs(rolledBackTxs) }()
+
 		for _, block := range blocksToRollback {
-			if err := rollback(block); err != nil {
+			data, err := rollbackData(block)
+			if err != nil {
 				return err
 			}
+			rollbackBlock(data)
+			rolledBackTxs = append(rolledBackTxs, getBlockTxs(data)...)
 			logger.Printf("Rolled back block: %vState:\n%v", block, getState())
 		}
 		for _, block := range blocksToValidate {
 			//Fetching payload data from the txs (if necessary, ask other miners).
-			accTxs, fundsTxs, configTxs, stakeTxs, err := preValidate(block, initialSetup)
+			accTxs, fundsTxs, configTxs, stakeTxs, batchTxs, keyTxs, err := preValidate(block, initialSetup)
 
 			//Check if the validator that added the block has previously voted on different competing chains (find slashing proof).
 			//The proof will be stored in the global slashing dictionary.
@@ -557,7 +630,7 @@ func validate(b *protocol.Block, initialSetup bool) error {
 				return err
 			}
 
-			blockDataMap[block.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, block}
+			blockDataMap[block.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, batchTxs, keyTxs, block, new(protocol.ContractDiff)}
 			if err := validateState(blockDataMap[block.Hash]); err != nil {
 				return err
 			}
@@ -571,78 +644,112 @@ func validate(b *protocol.Block, initialSetup bool) error {
 }
 
 //Doesn't involve any state changes.
-func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsTx, configTxSlice []*protocol.ConfigTx, stakeTxSlice []*protocol.StakeTx, err error) {
+func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsTx, configTxSlice []*protocol.ConfigTx, stakeTxSlice []*protocol.StakeTx, batchTxSlice []*protocol.BatchTx, keyTxSlice []*protocol.KeyTx, err error) {
 	//This dynamic check is only done if we're up-to-date with syncing, otherwise timestamp is not checked.
 	//Other miners (which are up-to-date) made sure that this is correct.
 	if !initialSetup && uptodate {
 		if err := timestampCheck(block.Timestamp); err != nil {
-			return nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, err
 		}
 	}
 
 	//Check block size.
 	if block.GetSize() > activeParameters.Block_size {
-		return nil, nil, nil, nil, errors.New("Block size too large.")
+		return nil, nil, nil, nil, nil, nil, errors.New("Block size too large.")
 	}
 
 	//Duplicates are not allowed, use tx hash hashmap to easily check for duplicates.
 	duplicates := make(map[[32]byte]bool)
 	for _, txHash := range block.AccTxData {
 		if _, exists := duplicates[txHash]; exists {
-			return nil, nil, nil, nil, errors.New("Duplicate Account Transaction Hash detected.")
+			return nil, nil, nil, nil, nil, nil, errors.New("Duplicate Account Transaction Hash detected.")
 		}
 		duplicates[txHash] = true
 	}
 	for _, txHash := range block.FundsTxData {
 		if _, exists := duplicates[txHash]; exists {
-			return nil, nil, nil, nil, errors.New("Duplicate Funds Transaction Hash detected.")
+			return nil, nil, nil, nil, nil, nil, errors.New("Duplicate Funds Transaction Hash detected.")
 		}
 		duplicates[txHash] = true
 	}
 	for _, txHash := range block.ConfigTxData {
 		if _, exists := duplicates[txHash]; exists {
-			return nil, nil, nil, nil, errors.New("Duplicate Config Transaction Hash detected.")
+			return nil, nil, nil, nil, nil, nil, errors.New("Duplicate Config Transaction Hash detected.")
 		}
 		duplicates[txHash] = true
 	}
 	for _, txHash := range block.StakeTxData {
 		if _, exists := duplicates[txHash]; exists {
-			return nil, nil, nil, nil, errors.New("Duplicate Stake Transaction Hash detected.")
+			return nil, nil, nil, nil, nil, nil, errors.New("Duplicate Stake Transaction Hash detected.")
+		}
+		duplicates[txHash] = true
+	}
+	for _, txHash := range block.BatchTxData {
+		if _, exists := duplicates[txHash]; exists {
+			return nil, nil, nil, nil, nil, nil, errors.New("Duplicate Batch Transaction Hash detected.")
+		}
+		duplicates[txHash] = true
+	}
+	for _, txHash := range block.KeyTxData {
+		if _, exists := duplicates[txHash]; exists {
+			return nil, nil, nil, nil, nil, nil, errors.New("Duplicate Key Transaction Hash detected.")
 		}
 		duplicates[txHash] = true
 	}
 
 	//We fetch tx data for each type in parallel -> performance boost.
-	errChan := make(chan error, 4)
+	errChan := make(chan error, 6)
 
 	//We need to allocate slice space for the underlying array when we pass them as reference.
 	accTxSlice = make([]*protocol.AccTx, block.NrAccTx)
 	fundsTxSlice = make([]*protocol.FundsTx, block.NrFundsTx)
 	configTxSlice = make([]*protocol.ConfigTx, block.NrConfigTx)
 	stakeTxSlice = make([]*protocol.StakeTx, block.NrStakeTx)
-
-	go fetchAccTxData(block, accTxSlice, initialSetup, errChan)
-	go fetchFundsTxData(block, fundsTxSlice, initialSetup, errChan)
-	go fetchConfigTxData(block, configTxSlice, initialSetup, errChan)
-	go fetchStakeTxData(block, stakeTxSlice, initialSetup, errChan)
+	batchTxSlice = make([]*protocol.BatchTx, block.NrBatchTx)
+	keyTxSlice = make([]*protocol.KeyTx, block.NrKeyTx)
+
+	go fetchTxData(block.AccTxData, p2p.ACCTX_REQ, initialSetup, func(i int, tx protocol.Transaction) (ok bool) {
+		accTxSlice[i], ok = tx.(*protocol.AccTx)
+		return ok
+	}, errChan)
+	go fetchTxData(block.FundsTxData, p2p.FUNDSTX_REQ, initialSetup, func(i int, tx protocol.Transaction) (ok bool) {
+		fundsTxSlice[i], ok = tx.(*protocol.FundsTx)
+		return ok
+	}, errChan)
+	go fetchTxData(block.ConfigTxData, p2p.CONFIGTX_REQ, initialSetup, func(i int, tx protocol.Transaction) (ok bool) {
+		configTxSlice[i], ok = tx.(*protocol.ConfigTx)
+		return ok
+	}, errChan)
+	go fetchTxData(block.StakeTxData, p2p.STAKETX_REQ, initialSetup, func(i int, tx protocol.Transaction) (ok bool) {
+		stakeTxSlice[i], ok = tx.(*protocol.StakeTx)
+		return ok
+	}, errChan)
+	go fetchTxData(block.BatchTxData, p2p.BATCHTX_REQ, initialSetup, func(i int, tx protocol.Transaction) (ok bool) {
+		batchTxSlice[i], ok = tx.(*protocol.BatchTx)
+		return ok
+	}, errChan)
+	go fetchTxData(block.KeyTxData, p2p.KEYTX_REQ, initialSetup, func(i int, tx protocol.Transaction) (ok bool) {
+		keyTxSlice[i], ok = tx.(*protocol.KeyTx)
+		return ok
+	}, errChan)
 
 	//Wait for all goroutines to finish.
-	for cnt := 0; cnt < 4; cnt++ {
+	for cnt := 0; cnt < 6; cnt++ {
 		err = <-errChan
 		if err != nil {
-			return nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, err
 		}
 	}
 
 	//Check state contains beneficiary.
 	acc, err := storage.GetAccount(block.Beneficiary)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, err
 	}
 
 	//Check if node is part of the validator set.
 	if !acc.IsStaking {
-		return nil, nil, nil, nil, errors.New("Validator is not part of the validator set.")
+		return nil, nil, nil, nil, nil, nil, errors.New("Validator is not part of the validator set.")
 	}
 
 	//First, initialize an RSA Public Key instance with the modulus of the proposer of the block (acc)
@@ -650,12 +757,12 @@ func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protoc
 	//Invalid if the commitment proof can not be verified with the public key of the proposer
 	commitmentPubKey, err := crypto.CreateRSAPubKeyFromBytes(acc.CommitmentKey)
 	if err != nil {
-		return nil, nil, nil, nil, errors.New("Invalid commitment key in account.")
+		return nil, nil, nil, nil, nil, nil, errors.New("Invalid commitment key in account.")
 	}
 
 	err = crypto.VerifyMessageWithRSAKey(commitmentPubKey, fmt.Sprint(block.Height), block.CommitmentProof)
 	if err != nil {
-		return nil, nil, nil, nil, errors.New("The submitted commitment proof can not be verified.")
+		return nil, nil, nil, nil, nil, nil, errors.New("The submitted commitment proof can not be verified.")
 	}
 
 	//Invalid if PoS calculation is not correct.
@@ -663,74 +770,133 @@ func preValidate(block *protocol.Block, initialSetup bool) (accTxSlice []*protoc
 
 	//PoS validation
 	if !validateProofOfStake(getDifficulty(), prevProofs, block.Height, acc.Balance, block.CommitmentProof, block.Timestamp) {
-		return nil, nil, nil, nil, errors.New("The nonce is incorrect.")
+		return nil, nil, nil, nil, nil, nil, errors.New("The nonce is incorrect.")
 	}
 
 	//Invalid if PoS is too far in the future.
 	now := time.Now()
 	if block.Timestamp > now.Unix()+int64(activeParameters.Accepted_time_diff) {
-		return nil, nil, nil, nil, errors.New("The timestamp is too far in the future. " + string(block.Timestamp) + " vs " + string(now.Unix()))
+		return nil, nil, nil, nil, nil, nil, errors.New("The timestamp is too far in the future. " + string(block.Timestamp) + " vs " + string(now.Unix()))
 	}
 
 	//Check for minimum waiting time.
 	if block.Height-acc.StakingBlockHeight < uint32(activeParameters.Waiting_minimum) {
-		return nil, nil, nil, nil, errors.New("The miner must wait a minimum amount of blocks before start validating. Block Height:" + fmt.Sprint(block.Height) + " - Height when started validating " + string(acc.StakingBlockHeight) + " MinWaitingTime: " + string(activeParameters.Waiting_minimum))
+		return nil, nil, nil, nil, nil, nil, errors.New("The miner must wait a minimum amount of blocks before start validating. Block Height:" + fmt.Sprint(block.Height) + " - Height when started validating " + string(acc.StakingBlockHeight) + " MinWaitingTime: " + string(activeParameters.Waiting_minimum))
 	}
 
 	//Check if block contains a proof for two conflicting block hashes, else no proof provided.
 	if block.SlashedAddress != [32]byte{} {
 		if _, err = slashingCheck(block.SlashedAddress, block.ConflictingBlockHash1, block.ConflictingBlockHash2); err != nil {
-			return nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, err
 		}
 	}
 
 	//Merkle Tree validation
 	if protocol.BuildMerkleTree(block).MerkleRoot() != block.MerkleRoot {
-		return nil, nil, nil, nil, errors.New("Merkle Root is incorrect.")
+		return nil, nil, nil, nil, nil, nil, errors.New("Merkle Root is incorrect.")
 	}
 
-	return accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, err
+	return accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, batchTxSlice, keyTxSlice, err
 }
 
 //Dynamic state check.
 func validateState(data blockData) error {
+	for _, tx := range getBlockTxs(data) {
+		if protocol.IsExpired(tx, data.block.Height) {
+			return errors.New(fmt.Sprintf("Transaction (%x) has expired at block height %v.", tx.Hash(), data.block.Height))
+		}
+	}
+
+	if err := blockStateChange(data); err != nil {
+		return err
+	}
+
+	//The state root in the block needs to correspond to the state after applying the block. Only the accounts changed
+	//by the block are updated in the state tree.
+	newStateTree := updateStateTree(stateTree, getStateChangeAccounts(data))
+	if stateRoot := newStateTree.Root(); stateRoot != data.block.StateRoot {
+		validateStateRollback(data)
+		return errors.New(fmt.Sprintf("State root is incorrect: %x (block) vs. %x (state).", data.block.StateRoot[0:8], stateRoot[0:8]))
+	}
+
+	//Same for the receipts root and the outcome of the txs.
+	if receiptsRoot := protocol.ReceiptsRoot(blockReceipts(data.block, data.contractDiff)); receiptsRoot != data.block.ReceiptsRoot {
+		validateStateRollback(data)
+		return errors.New(fmt.Sprintf("Receipts root is incorrect: %x (block) vs. %x (state).", data.block.ReceiptsRoot[0:8], receiptsRoot[0:8]))
+	}
+
+	stateTree = newStateTree
+
+	return nil
+}
+
+//Applies all state changes of a block. If one of them fails, all previous changes are rolled back.
+func blockStateChange(data blockData) error {
 	//The sequence of validation matters. If we start with accs, then fund/stake transactions can be done in the same block
 	//even though the accounts did not exist before the block validation.
 	if err := accStateChange(data.accTxSlice); err != nil {
 		return err
 	}
 
-	if err := fundsStateChange(data.fundsTxSlice); err != nil {
+	//The locks of the fundsTxs are checked against the block this block builds on.
+	prevBlock := storage.ReadClosedBlock(data.block.PrevHash)
+	if appliedFundsTxs, err := fundsStateChange(data.fundsTxSlice, data.contractDiff, prevBlock); err != nil {
+		fundsStateChangeRollback(appliedFundsTxs, data.contractDiff)
+		accStateChangeRollback(data.accTxSlice)
+		return err
+	}
+
+	//BatchTxs are applied after the fundsTxs, a sender's fundsTxs therefore precede its batchTxs in a block.
+	if appliedBatchTxs, err := batchStateChange(data.batchTxSlice); err != nil {
+		batchStateChangeRollback(appliedBatchTxs)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
 	if err := stakeStateChange(data.stakeTxSlice, data.block.Height); err != nil {
-		fundsStateChangeRollback(data.fundsTxSlice)
+		batchStateChangeRollback(data.batchTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
+		accStateChangeRollback(data.accTxSlice)
+		return err
+	}
+
+	//KeyTxs are applied last, a sender's other txs in the block have therefore been signed with the old key.
+	if appliedKeyTxs, err := keyStateChange(data.keyTxSlice); err != nil {
+		keyStateChangeRollback(appliedKeyTxs)
+		stakeStateChangeRollback(data.stakeTxSlice)
+		batchStateChangeRollback(data.batchTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
-	if err := collectTxFees(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary); err != nil {
+	if err := collectTxFees(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.batchTxSlice, data.keyTxSlice, data.block.Beneficiary); err != nil {
+		keyStateChangeRollback(data.keyTxSlice)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		batchStateChangeRollback(data.batchTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
 	if err := collectBlockReward(activeParameters.Block_reward, data.block.Beneficiary); err != nil {
-		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
+		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.batchTxSlice, data.keyTxSlice, data.block.Beneficiary)
+		keyStateChangeRollback(data.keyTxSlice)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		batchStateChangeRollback(data.batchTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
 
 	if err := collectSlashReward(activeParameters.Slash_reward, data.block); err != nil {
 		collectBlockRewardRollback(activeParameters.Block_reward, data.block.Beneficiary)
-		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
+		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.batchTxSlice, data.keyTxSlice, data.block.Beneficiary)
+		keyStateChangeRollback(data.keyTxSlice)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		batchStateChangeRollback(data.batchTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
@@ -738,9 +904,11 @@ func validateState(data blockData) error {
 	if err := updateStakingHeight(data.block); err != nil {
 		collectSlashRewardRollback(activeParameters.Slash_reward, data.block)
 		collectBlockRewardRollback(activeParameters.Block_reward, data.block.Beneficiary)
-		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
+		collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.batchTxSlice, data.keyTxSlice, data.block.Beneficiary)
+		keyStateChangeRollback(data.keyTxSlice)
 		stakeStateChangeRollback(data.stakeTxSlice)
-		fundsStateChangeRollback(data.fundsTxSlice)
+		batchStateChangeRollback(data.batchTxSlice)
+		fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 		accStateChangeRollback(data.accTxSlice)
 		return err
 	}
@@ -756,41 +924,70 @@ func postValidate(data blockData, initialSetup bool) {
 	//Collects meta information about the block (and handled difficulty adaption).
 	collectStatistics(data.block)
 
+	//The closed txs, the account history, the contract variable changes (needed if the block is rolled back) and the
+	//receipts are written together with the block, during the initial setup the block is closed already.
+	records := &storage.BlockRecords{
+		Txs:          getBlockTxs(data),
+		ContractDiff: data.contractDiff,
+		Receipts:     blockReceipts(data.block, data.contractDiff),
+	}
+	if initialSetup {
+		if err := storage.WriteBlockRecords(data.block, records); err != nil {
+			logger.Printf("Could not write the records of block (%x): %v\n", data.block.Hash[0:8], err)
+		}
+	}
+
 	if !initialSetup {
-		//Write all open transactions to closed/validated storage.
+		//Remove the validated transactions from the mempool.
 		for _, tx := range data.accTxSlice {
-			storage.WriteClosedTx(tx)
 			storage.DeleteOpenTx(tx)
 		}
 
 		for _, tx := range data.fundsTxSlice {
-			storage.WriteClosedTx(tx)
 			storage.DeleteOpenTx(tx)
 			storage.DeleteINVALIDOpenTx(tx)
 		}
 
 		for _, tx := range data.configTxSlice {
-			storage.WriteClosedTx(tx)
 			storage.DeleteOpenTx(tx)
 		}
 
 		for _, tx := range data.stakeTxSlice {
-			storage.WriteClosedTx(tx)
 			storage.DeleteOpenTx(tx)
 		}
 
+		for _, tx := range data.batchTxSlice {
+			storage.DeleteOpenTx(tx)
+			storage.DeleteINVALIDOpenTx(tx)
+		}
+
+		for _, tx := range data.keyTxSlice {
+			storage.DeleteOpenTx(tx)
+			storage.DeleteINVALIDOpenTx(tx)
+		}
+
 		if len(data.fundsTxSlice) > 0 {
 			broadcastVerifiedTxs(data.fundsTxSlice)
 		}
 
 		//It might be that block is not in the openblock storage, but this doesn't matter.
 		storage.DeleteOpenBlock(data.block.Hash)
-		storage.WriteClosedBlock(data.block)
 
-		// Write last block to db and delete last block's ancestor.
-		storage.DeleteAllLastClosedBlock()
-		storage.WriteLastClosedBlock(data.block)
+		//Write the block as last closed block to db together with the accounts it changed and its records. This way,
+		//the persisted state and the indexes always correspond to the last closed block.
+		if err := storage.WriteClosedBlockWithState(data.block, getStateChangeAccounts(data), records); err != nil {
+			logger.Printf("Could not persist block (%x) and state: %v\n", data.block.Hash[0:8], err)
+		}
+
+		publishEvent(EVENT_BLOCK, data.block, data.fundsTxSlice)
+
+		//Txs that cannot be included in the next block anymore are purged from the mempool.
+		if expired := storage.DeleteOpenTxsExpiredAt(data.block.Height + 1); len(expired) > 0 {
+			logger.Printf("Purged %v transaction(s) that expired at height %v from the mempool.\n", len(expired), data.block.Height+1)
+		}
 	}
+
+	updateChainMetrics(data.block)
 }
 
 //Only blocks with timestamp not diverging from system time (past or future) more than one hour are accepted.
@@ -57,6 +57,50 @@ func TestBlock(t *testing.T) {
 	}
 }
 
+//A batchTx following a fundsTx of the same sender is applied after it and rolled back completely.
+func TestBlockWithBatchTx(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	balanceB := accB.Balance
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	fundsTx, _ := protocol.ConstrFundsTx(0x01, 5, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	batchTx, _ := protocol.ConstrBatchTx(0x01, 1, accA.TxCnt+1, accAHash, []protocol.BatchPayment{{To: accBHash, Amount: 10}, {To: accBHash, Amount: 20}}, 0, PrivKeyAccA, PrivKeyMultiSig)
+	for _, tx := range []protocol.Transaction{fundsTx, batchTx} {
+		if err := addTx(b, tx); err != nil {
+			t.Errorf("Block rejected a valid transaction: %v\n", err)
+		}
+		storage.WriteOpenTx(tx)
+	}
+
+	if err := finalizeBlock(b); err != nil {
+		t.Errorf("Block finalization failed (%v)\n", err)
+		return
+	}
+
+	var decodedBlock *protocol.Block
+	decodedBlock = decodedBlock.Decode(b.Encode())
+	if len(decodedBlock.BatchTxData) != 1 || decodedBlock.BatchTxData[0] != batchTx.Hash() {
+		t.Error("BatchTx data is not properly serialized!")
+	}
+
+	if err := validate(decodedBlock, false); err != nil {
+		t.Errorf("Block validation failed (%v)\n", err)
+	}
+	if accB.Balance != balanceB+35 || storage.ReadClosedTx(batchTx.Hash()) == nil {
+		t.Errorf("BatchTx has not been applied: %v vs. %v\n", accB.Balance, balanceB+35)
+	}
+
+	if err := rollback(decodedBlock); err != nil {
+		t.Errorf("Block rollback failed (%v)\n", err)
+	}
+	if accB.Balance != balanceB || storage.ReadOpenTx(batchTx.Hash()) == nil {
+		t.Errorf("BatchTx has not been rolled back: %v vs. %v\n", accB.Balance, balanceB)
+	}
+}
+
 //Duplicate Txs are not allowed
 func TestBlockTxDuplicates(t *testing.T) {
 
@@ -129,6 +173,35 @@ func TestMultipleBlocks(t *testing.T) {
 	}
 }
 
+//Blocks with a state root that does not match the state after applying them are rejected
+func TestStateRootCheck(t *testing.T) {
+	cleanAndPrepare()
+
+	stateRoot := protocol.BuildStateTree(storage.State).Root()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	createBlockWithTxs(b)
+	if err := finalizeBlock(b); err != nil {
+		t.Errorf("Block finalization failed. (%v)\n", err)
+	}
+
+	//Calculating the state root must not change the state.
+	if stateRoot != protocol.BuildStateTree(storage.State).Root() {
+		t.Error("State changed during block finalization.\n")
+	}
+
+	b.StateRoot = [32]byte{'0'}
+	if err := validate(b, false); err == nil {
+		t.Error("Block with wrong state root passed validation.\n")
+	}
+	if stateRoot != protocol.BuildStateTree(storage.State).Root() {
+		t.Error("State wasn't rolled back after state root mismatch.\n")
+	}
+	if stateTree.Root() != stateRoot {
+		t.Error("State tree wasn't rolled back after state root mismatch.\n")
+	}
+}
+
 //Test the blocktimestamp check
 func TestTimestampCheck(t *testing.T) {
 	cleanAndPrepare()
@@ -150,6 +223,36 @@ func TestTimestampCheck(t *testing.T) {
 	}
 }
 
+//A tx with an expiry height can only be added to and validated in blocks up to that height.
+func TestExpiredTx(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	b := newBlock(lastBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, lastBlock.Height+1)
+	tx, _ := protocol.ConstrTimeBoundFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, 0, 0, b.Height, PrivKeyAccA, PrivKeyMultiSig, nil)
+
+	nextBlock := newBlock(b.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, b.Height+1)
+	if err := addTx(nextBlock, tx); err == nil {
+		t.Error("Expired tx has been added to the block.\n")
+	}
+	if err := validateState(blockData{nil, []*protocol.FundsTx{tx}, nil, nil, nil, nil, nextBlock, nil}); err == nil {
+		t.Error("Block with an expired tx has been validated.\n")
+	}
+
+	if err := addTx(b, tx); err != nil {
+		t.Errorf("Tx has been rejected before its expiry height: %v\n", err)
+	}
+	storage.WriteOpenTx(tx)
+	if err := finalizeBlock(b); err != nil {
+		t.Errorf("Block finalization failed (%v)\n", err)
+		return
+	}
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation failed (%v)\n", err)
+	}
+}
+
 //Helper function used by lots of test to fill the block with some random data
 func createBlockWithTxs(b *protocol.Block) ([][32]byte, [][32]byte, [][32]byte, [][32]byte) {
 	var testSize uint32
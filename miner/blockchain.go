@@ -21,6 +21,7 @@ var (
 	multisigPubKey      			*ecdsa.PublicKey
 	commPrivKey, rootCommPrivKey	*rsa.PrivateKey
 	blockchainSize uint64			= 0
+	stateTree           			*protocol.StateTree //State tree of storage.State, updated with each (rolled back) block
 )
 
 //Miner entry point
@@ -55,8 +56,12 @@ func Init(validatorWallet, multisigWallet, rootWallet *ecdsa.PublicKey, validato
 
 	logger.Printf("Active config params:%v", activeParameters)
 
+	revalidateOpenTxs()
+
 	//Start to listen to network inputs (txs and blocks).
 	go incomingData()
+	go incomingTxReplacements()
+	go incomingAccProofReqs()
 	mining(initialBlock)
 }
 
@@ -31,6 +31,8 @@ type Parameters struct {
 	Accepted_time_diff      	uint64 //Number of seconds that a block can be received in the future.
 	Slashing_window_size    	uint64 //Number of blocks that a validator cannot vote on two competing chains.
 	Slash_reward            	uint64 //Reward for providing the correct slashing proof.
+	Multisig_required       	uint64 //If set, all fundsTxs and batchTxs need the co-signature (Sig2) of the multisig server.
+	Block_gas_limit         	uint64 //Gas all contract calls of a block may use together.
 	num_included_prev_proofs	int
 }
 
@@ -47,6 +49,8 @@ func NewDefaultParameters() Parameters {
 		ACCEPTED_TIME_DIFF,
 		SLASHING_WINDOW_SIZE,
 		SLASH_REWARD,
+		MULTISIG_REQUIRED,
+		BLOCK_GAS_LIMIT,
 		NUM_INCL_PREV_PROOFS,
 	}
 
@@ -164,6 +168,8 @@ func (param Parameters) String() string {
 			"Acceptanced time difference: %v\n"+
 			"Slashing window size: %v\n"+
 			"Slash reward: %v\n"+
+			"Multisig required: %v\n"+
+			"Block gas limit: %v\n"+
 			"Num of previous proofs included in PoS: %v\n",
 		param.BlockHash[0:8],
 		param.Block_size,
@@ -176,6 +182,8 @@ func (param Parameters) String() string {
 		param.Accepted_time_diff,
 		param.Slashing_window_size,
 		param.Slash_reward,
+		param.Multisig_required,
+		param.Block_gas_limit,
 		param.num_included_prev_proofs,
 	)
 }
@@ -3,31 +3,60 @@ package miner
 import (
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/bazo-blockchain/bazo-miner/storage"
-	"sort"
 )
 
-//The code here is needed if a new block is built. All open (not yet validated) transactions are first fetched
-//from the mempool and then sorted. The sorting is important because if transactions are fetched from the mempool
-//they're received in random order (because it's implemented as a map). However, if a user wants to issue more fundsTxs
-//they need to be sorted according to increasing txCnt, this greatly increases throughput.
-
-type openTxs []protocol.Transaction
+//The code here is needed if a new block is built. All open (not yet validated) transactions are fetched from the
+//mempool ordered by fee per byte, so the most profitable transactions get included first. If a user issues more
+//fundsTxs, batchTxs or keyTxs, they are kept in increasing txCnt order (the mempool takes care of this), otherwise only
+//the first one would be valid.
 
 func prepareBlock(block *protocol.Block) {
-	//Fetch all txs from mempool (opentxs).
-	opentxs := storage.ReadAllOpenTxs()
+	//Transactions that have been waiting for too long are purged first.
+	var lastHeight uint32
+	var lastTime int64
+	if lastBlock != nil {
+		lastHeight, lastTime = lastBlock.Height, lastBlock.Timestamp
+	}
+	if expired := storage.DeleteExpiredOpenTxs(lastHeight, lastTime); len(expired) > 0 {
+		logger.Printf("Purged %v expired transaction(s) from the mempool.\n", len(expired))
+	}
+
+	//Senders whose txs are skipped, their later txs cannot be valid in this block.
+	skippedSenders := make(map[[32]byte]bool)
+
+	for _, tx := range storage.ReadOpenTxsByFee() {
+		sender, _, hasTxCnt := protocol.SenderTxCnt(tx)
+		if hasTxCnt && skippedSenders[sender] {
+			continue
+		}
 
-	//This copy is strange, but seems to be necessary to leverage the sort interface.
-	//Shouldn't be too bad because no deep copy.
-	var tmpCopy openTxs
-	tmpCopy = opentxs
+		//Expired txs can never be included anymore.
+		if protocol.IsExpired(tx, block.Height) {
+			storage.DeleteOpenTx(tx)
+			continue
+		}
 
-	sort.Sort(tmpCopy)
+		//Locked txs stay in the mempool until the lock is satisfied, later txs of the sender have to wait as well.
+		if isLockedTx(tx, lastBlock) {
+			skippedSenders[sender] = true
+			continue
+		}
 
-	for _, tx := range opentxs {
-		//Prevent block size to overflow.
+		//Prevent block size to overflow. A smaller tx might still fit.
 		if block.GetSize()+tx.Size() > activeParameters.Block_size {
-			break
+			if hasTxCnt {
+				skippedSenders[sender] = true
+			}
+			continue
+		}
+
+		//Prevent the contract calls to exceed the block gas limit. A call using less gas might still fit, a call
+		//exceeding the limit on its own is invalid.
+		if gas := txGas(tx); gas <= activeParameters.Block_gas_limit && block.ContractGas+gas > activeParameters.Block_gas_limit {
+			if hasTxCnt {
+				skippedSenders[sender] = true
+			}
+			continue
 		}
 
 		err := addTx(block, tx)
@@ -35,42 +64,54 @@ func prepareBlock(block *protocol.Block) {
 			//If the tx is invalid, we remove it completely, prevents starvation in the mempool.
 			storage.WriteINVALIDOpenTx(tx)
 			storage.DeleteOpenTx(tx)
+			continue
+		}
+
+		//BatchTxs are applied after all fundsTxs of a block, later txs of the sender have to wait for the next block.
+		//The same holds for keyTxs, later txs of the sender are signed with the new key.
+		switch tx.(type) {
+		case *protocol.BatchTx, *protocol.KeyTx:
+			skippedSenders[sender] = true
 		}
 	}
 }
 
-//Implement the sort interface
-func (f openTxs) Len() int {
-	return len(f)
-}
+//The mempool is persisted, so after a restart it contains the txs that were pending before. Txs that have been
+//validated in the meantime or that no longer apply to the current state are dropped.
+func revalidateOpenTxs() {
+	var nextHeight uint32
+	if lastBlock != nil {
+		nextHeight = lastBlock.Height + 1
+	}
+
+	var dropped int
+	for _, tx := range storage.ReadAllOpenTxs() {
+		if storage.ReadClosedTx(tx.Hash()) != nil || !verify(tx) || isStaleTx(tx) || protocol.IsExpired(tx, nextHeight) {
+			storage.DeleteOpenTx(tx)
+			dropped++
+		}
+	}
 
-func (f openTxs) Swap(i, j int) {
-	f[i], f[j] = f[j], f[i]
+	logger.Printf("Revalidated the mempool, %v transaction(s) pending, %v dropped.\n", storage.ReadMemPoolSize(), dropped)
 }
 
-func (f openTxs) Less(i, j int) bool {
-	//Comparison only makes sense if both tx are fundsTxs.
-	//Why can we only do that with switch, and not e.g., if tx.(type) == ..?
-	switch f[i].(type) {
-	case *protocol.AccTx:
-		//We only want to sort a subset of all transactions, namely all fundsTxs.
-		//However, to successfully do that we have to place all other txs at the beginning.
-		//The order between accTxs and configTxs doesn't matter.
-		return true
-	case *protocol.ConfigTx:
-		return true
-	case *protocol.StakeTx:
-		return true
+//A fundsTx, batchTx or keyTx whose txCnt has already been used by the sender can never be valid again.
+func isStaleTx(tx protocol.Transaction) bool {
+	sender, txCnt, hasTxCnt := protocol.SenderTxCnt(tx)
+	if !hasTxCnt {
+		return false
 	}
 
-	switch f[j].(type) {
-	case *protocol.AccTx:
-		return false
-	case *protocol.ConfigTx:
-		return false
-	case *protocol.StakeTx:
+	acc := storage.State[sender]
+	return acc == nil || txCnt < acc.TxCnt
+}
+
+//A fundsTx whose lock is not satisfied by the previous block cannot be added to the block following it yet.
+func isLockedTx(tx protocol.Transaction, prevBlock *protocol.Block) bool {
+	fundsTx, ok := tx.(*protocol.FundsTx)
+	if !ok || !fundsTx.IsLocked() {
 		return false
 	}
 
-	return f[i].(*protocol.FundsTx).TxCnt < f[j].(*protocol.FundsTx).TxCnt
+	return prevBlock == nil || !fundsTx.IsUnlocked(prevBlock.Height, prevBlock.Timestamp)
 }
@@ -63,3 +63,115 @@ func TestPrepareAndSortTxs(t *testing.T) {
 		t.Errorf("NrFundsTx (%v) vs. testsize*2 (%v)\n", b.NrFundsTx, testsize*2)
 	}
 }
+
+//A fundsTx with a higher fee replaces the pending fundsTx with the same txCnt and gets included in the block instead.
+func TestReplaceTx(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	pendingTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	lowFeeTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, []byte{1})
+	highFeeTx, _ := protocol.ConstrFundsTx(0x01, 10, 5, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	forgedTx, _ := protocol.ConstrFundsTx(0x01, 10, 9, accA.TxCnt, accAHash, accBHash, PrivKeyAccB, PrivKeyMultiSig, nil)
+
+	storage.WriteOpenTx(pendingTx)
+
+	if err := ReplaceTx(lowFeeTx); err == nil {
+		t.Error("Replacement without a higher fee succeeded.\n")
+	}
+	if err := ReplaceTx(forgedTx); err == nil {
+		t.Error("Replacement with an invalid signature succeeded.\n")
+	}
+	if err := ReplaceTx(highFeeTx); err != nil {
+		t.Errorf("Replacement with a higher fee failed: %v\n", err)
+	}
+
+	if storage.ReadOpenTx(pendingTx.Hash()) != nil || storage.ReadOpenTx(highFeeTx.Hash()) == nil {
+		t.Error("Pending tx has not been replaced.\n")
+	}
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	prepareBlock(b)
+	if len(b.FundsTxData) != 1 || b.FundsTxData[0] != highFeeTx.Hash() {
+		t.Errorf("Block does not contain the replacement: %v\n", b.FundsTxData)
+	}
+}
+
+func TestRevalidateOpenTxs(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	validTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	forgedTx, _ := protocol.ConstrFundsTx(0x01, 10, 2, accA.TxCnt+1, accAHash, accBHash, PrivKeyAccB, PrivKeyMultiSig, nil)
+	closedTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt+2, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+
+	accA.TxCnt++
+	defer func() { accA.TxCnt-- }()
+	staleTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt-1, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, []byte{1})
+	validTx, _ = protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+
+	for _, tx := range []*protocol.FundsTx{validTx, forgedTx, closedTx, staleTx} {
+		storage.WriteOpenTx(tx)
+	}
+	storage.WriteClosedTx(closedTx)
+
+	revalidateOpenTxs()
+
+	if storage.ReadOpenTx(validTx.Hash()) == nil {
+		t.Error("Valid tx has been dropped.\n")
+	}
+	for _, tx := range []*protocol.FundsTx{forgedTx, closedTx, staleTx} {
+		if storage.ReadOpenTx(tx.Hash()) != nil {
+			t.Errorf("Tx (%x) with txCnt %v has not been dropped.\n", tx.Hash(), tx.TxCnt)
+		}
+	}
+}
+
+//Locked txs and the later txs of their sender are held in the mempool until the last block satisfies the lock.
+func TestPrepareLockedTxs(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	heightLockedTx, _ := protocol.ConstrTimeBoundFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, lastBlock.Height+1, 0, 0, PrivKeyAccA, PrivKeyMultiSig, nil)
+	timeLockedTx, _ := protocol.ConstrTimeBoundFundsTx(0x01, 10, 1, accB.TxCnt, accBHash, accAHash, 0, lastBlock.Timestamp+1, 0, PrivKeyAccB, PrivKeyMultiSig, nil)
+	laterTx, _ := protocol.ConstrFundsTx(0x01, 10, 5, accA.TxCnt+1, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	for _, tx := range []*protocol.FundsTx{heightLockedTx, timeLockedTx, laterTx} {
+		storage.WriteOpenTx(tx)
+	}
+
+	if _, err := fundsStateChange([]*protocol.FundsTx{heightLockedTx}, nil, lastBlock); err == nil {
+		t.Error("State change accepted a locked tx.\n")
+	}
+	//The lock only depends on the given previous block.
+	unlockingBlock := newBlock(lastBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, lastBlock.Height+1)
+	applied, err := fundsStateChange([]*protocol.FundsTx{heightLockedTx}, nil, unlockingBlock)
+	if err != nil {
+		t.Errorf("State change rejected a tx unlocked by the previous block: %v\n", err)
+	}
+	fundsStateChangeRollback(applied, nil)
+
+	b := newBlock(lastBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, lastBlock.Height+1)
+	prepareBlock(b)
+	if len(b.FundsTxData) != 0 {
+		t.Errorf("Block contains txs of locked senders: %v\n", b.FundsTxData)
+	}
+	for _, tx := range []*protocol.FundsTx{heightLockedTx, timeLockedTx, laterTx} {
+		if storage.ReadOpenTx(tx.Hash()) == nil || storage.ReadINVALIDOpenTx(tx.Hash()) != nil {
+			t.Errorf("Tx (%x) has not been held in the mempool.\n", tx.Hash())
+		}
+	}
+
+	genesisBlock := lastBlock
+	defer func() { lastBlock = genesisBlock }()
+	lastBlock = newBlock(genesisBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, genesisBlock.Height+1)
+	lastBlock.Timestamp = genesisBlock.Timestamp + 1
+
+	b = newBlock(lastBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, lastBlock.Height+1)
+	prepareBlock(b)
+	if len(b.FundsTxData) != 3 {
+		t.Errorf("Block does not contain the unlocked txs: %v\n", b.FundsTxData)
+	}
+}
@@ -2,6 +2,7 @@ package miner
 
 import (
 	"errors"
+	"github.com/bazo-blockchain/bazo-miner/p2p"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/bazo-blockchain/bazo-miner/storage"
 )
@@ -9,32 +10,44 @@ import (
 //Already validated block but not part of the current longest chain.
 //No need for an additional state mutex, because this function is called while the blockValidation mutex is actively held.
 func rollback(b *protocol.Block) error {
-	accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, err := preValidateRollback(b)
+	data, err := rollbackData(b)
 	if err != nil {
 		return err
 	}
 
-	data := blockData{accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, b}
+	rollbackBlock(data)
 
+	return nil
+}
+
+//Reads the txs and the contract variable changes of a validated block from closed storage.
+func rollbackData(b *protocol.Block) (data blockData, err error) {
+	accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, batchTxSlice, keyTxSlice, err := preValidateRollback(b)
+	if err != nil {
+		return data, err
+	}
+
+	return blockData{accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, batchTxSlice, keyTxSlice, b, storage.ReadContractDiff(b.Hash)}, nil
+}
+
+func rollbackBlock(data blockData) {
 	//Going back to pre-block system parameters before the state is rolled back.
-	configStateChangeRollback(data.configTxSlice, b.Hash)
+	configStateChangeRollback(data.configTxSlice, data.block.Hash)
 
 	//TODO Does not throw error but crashes
 	validateStateRollback(data)
 
 	postValidateRollback(data)
-
-	return nil
 }
 
-func preValidateRollback(b *protocol.Block) (accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsTx, configTxSlice []*protocol.ConfigTx, stakeTxSlice []*protocol.StakeTx, err error) {
+func preValidateRollback(b *protocol.Block) (accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsTx, configTxSlice []*protocol.ConfigTx, stakeTxSlice []*protocol.StakeTx, batchTxSlice []*protocol.BatchTx, keyTxSlice []*protocol.KeyTx, err error) {
 	//Fetch all transactions from closed storage.
 	for _, hash := range b.AccTxData {
 		var accTx *protocol.AccTx
 		tx := storage.ReadClosedTx(hash)
 		if tx == nil {
 			//This should never happen, because all validated transactions are in closed storage.
-			return nil, nil, nil, nil, errors.New("CRITICAL: Validated accTx was not in the confirmed tx storage")
+			return nil, nil, nil, nil, nil, nil, errors.New("CRITICAL: Validated accTx was not in the confirmed tx storage")
 		} else {
 			accTx = tx.(*protocol.AccTx)
 		}
@@ -45,7 +58,7 @@ func preValidateRollback(b *protocol.Block) (accTxSlice []*protocol.AccTx, funds
 		var fundsTx *protocol.FundsTx
 		tx := storage.ReadClosedTx(hash)
 		if tx == nil {
-			return nil, nil, nil, nil, errors.New("CRITICAL: Validated fundsTx was not in the confirmed tx storage")
+			return nil, nil, nil, nil, nil, nil, errors.New("CRITICAL: Validated fundsTx was not in the confirmed tx storage")
 		} else {
 			fundsTx = tx.(*protocol.FundsTx)
 		}
@@ -56,7 +69,7 @@ func preValidateRollback(b *protocol.Block) (accTxSlice []*protocol.AccTx, funds
 		var configTx *protocol.ConfigTx
 		tx := storage.ReadClosedTx(hash)
 		if tx == nil {
-			return nil, nil, nil, nil, errors.New("CRITICAL: Validated configTx was not in the confirmed tx storage")
+			return nil, nil, nil, nil, nil, nil, errors.New("CRITICAL: Validated configTx was not in the confirmed tx storage")
 		} else {
 			configTx = tx.(*protocol.ConfigTx)
 		}
@@ -67,55 +80,115 @@ func preValidateRollback(b *protocol.Block) (accTxSlice []*protocol.AccTx, funds
 		var stakeTx *protocol.StakeTx
 		tx := storage.ReadClosedTx(hash)
 		if tx == nil {
-			return nil, nil, nil, nil, errors.New("CRITICAL: Validated stakeTx was not in the confirmed tx storage")
+			return nil, nil, nil, nil, nil, nil, errors.New("CRITICAL: Validated stakeTx was not in the confirmed tx storage")
 		} else {
 			stakeTx = tx.(*protocol.StakeTx)
 		}
 		stakeTxSlice = append(stakeTxSlice, stakeTx)
 	}
 
-	return accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, nil
+	for _, hash := range b.BatchTxData {
+		var batchTx *protocol.BatchTx
+		tx := storage.ReadClosedTx(hash)
+		if tx == nil {
+			return nil, nil, nil, nil, nil, nil, errors.New("CRITICAL: Validated batchTx was not in the confirmed tx storage")
+		} else {
+			batchTx = tx.(*protocol.BatchTx)
+		}
+		batchTxSlice = append(batchTxSlice, batchTx)
+	}
+
+	for _, hash := range b.KeyTxData {
+		var keyTx *protocol.KeyTx
+		tx := storage.ReadClosedTx(hash)
+		if tx == nil {
+			return nil, nil, nil, nil, nil, nil, errors.New("CRITICAL: Validated keyTx was not in the confirmed tx storage")
+		} else {
+			keyTx = tx.(*protocol.KeyTx)
+		}
+		keyTxSlice = append(keyTxSlice, keyTx)
+	}
+
+	return accTxSlice, fundsTxSlice, configTxSlice, stakeTxSlice, batchTxSlice, keyTxSlice, nil
 }
 
 func validateStateRollback(data blockData) {
 	collectSlashRewardRollback(activeParameters.Slash_reward, data.block)
 	collectBlockRewardRollback(activeParameters.Block_reward, data.block.Beneficiary)
-	collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.block.Beneficiary)
+	collectTxFeesRollback(data.accTxSlice, data.fundsTxSlice, data.configTxSlice, data.stakeTxSlice, data.batchTxSlice, data.keyTxSlice, data.block.Beneficiary)
+	keyStateChangeRollback(data.keyTxSlice)
 	stakeStateChangeRollback(data.stakeTxSlice)
-	fundsStateChangeRollback(data.fundsTxSlice)
+	batchStateChangeRollback(data.batchTxSlice)
+	fundsStateChangeRollback(data.fundsTxSlice, data.contractDiff)
 	accStateChangeRollback(data.accTxSlice)
+
+	stateTree = updateStateTree(stateTree, getStateChangeAccounts(data))
 }
 
 func postValidateRollback(data blockData) {
-	//Put all validated txs into invalidated state.
-	for _, tx := range data.accTxSlice {
+	//Put all validated txs back into the mempool, they are removed from closed storage together with the block.
+	txs := getBlockTxs(data)
+	for _, tx := range txs {
 		storage.WriteOpenTx(tx)
-		storage.DeleteClosedTx(tx)
 	}
 
-	for _, tx := range data.fundsTxSlice {
-		storage.WriteOpenTx(tx)
-		storage.DeleteClosedTx(tx)
-	}
+	collectStatisticsRollback(data.block)
 
-	for _, tx := range data.configTxSlice {
-		storage.WriteOpenTx(tx)
-		storage.DeleteClosedTx(tx)
+	//For transactions we switch from closed to open. However, we do not write back blocks
+	//to open storage, because in case of rollback the chain they belonged to is likely to starve.
+	storage.WriteToReceivedStash(data.block) //Write it to received stash, it will be deleted after X new blocks.
+
+	//Save the previous block as the last closed block and persist the rolled back accounts. The closed txs, the account
+	//history, the contract variable changes and the receipts of the block are deleted in the same bolt transaction.
+	prevBlock := storage.ReadClosedBlock(data.block.PrevHash)
+	if err := storage.DeleteClosedBlockWithState(data.block, prevBlock, getStateChangeAccounts(data), &storage.BlockRecords{Txs: txs}); err != nil {
+		logger.Printf("Could not persist rollback of block (%x): %v\n", data.block.Hash[0:8], err)
 	}
 
-	for _, tx := range data.stakeTxSlice {
-		storage.WriteOpenTx(tx)
-		storage.DeleteClosedTx(tx)
+	publishEvent(EVENT_ROLLBACK, data.block, data.fundsTxSlice)
+
+	rollbackCounter.Inc()
+	if prevBlock != nil {
+		updateChainMetrics(prevBlock)
 	}
+}
 
-	collectStatisticsRollback(data.block)
+//Peers that only know the new chain never saw the txs of the rolled back blocks or dropped them already. Txs that did
+//not make it into the new chain are therefore revalidated against the new state, put back into the mempool (the
+//rollback fails to write them if it is full) and rebroadcast.
+func reinjectTxs(txs []protocol.Transaction) {
+	var toBrdcst []protocol.Transaction
+	var dropped int
+	for _, tx := range txs {
+		if storage.ReadClosedTx(tx.Hash()) != nil {
+			continue
+		}
 
-	//For transactions we switch from closed to open. However, we do not write back blocks
-	//to open storage, because in case of rollback the chain they belonged to is likely to starve.
-	storage.DeleteClosedBlock(data.block.Hash)
-	storage.WriteToReceivedStash(data.block) //Write it to received stash, it will be deleted after X new blocks.
+		if !verify(tx) || isStaleTx(tx) {
+			storage.DeleteOpenTx(tx)
+			dropped++
+			continue
+		}
+
+		if storage.ReadOpenTx(tx.Hash()) == nil {
+			if err := storage.WriteOpenTx(tx); err != nil {
+				logger.Printf("Could not re-inject rolled back tx (%x): %v\n", tx.Hash(), err)
+				continue
+			}
+		}
 
-	//Save the previous block as the last closed block.
-	storage.DeleteAllLastClosedBlock()
-	storage.WriteLastClosedBlock(storage.ReadClosedBlock(data.block.PrevHash))
+		toBrdcst = append(toBrdcst, tx)
+	}
+
+	//BroadcastTx blocks until the p2p package reads the channel. The txs are therefore broadcast in the background,
+	//otherwise the blockValidation mutex would be held until all of them are sent.
+	go func() {
+		for _, tx := range toBrdcst {
+			p2p.BroadcastTx(tx)
+		}
+	}()
+
+	if len(toBrdcst) > 0 || dropped > 0 {
+		logger.Printf("Re-injected %v rolled back transaction(s), %v dropped.\n", len(toBrdcst), dropped)
+	}
 }
@@ -195,3 +195,38 @@ func resetStakingBlockHeight(accounts map[[64]byte]protocol.Account) map[[64]byt
 
 	return accountsNoStakingBlockHeight
 }
+
+func TestReinjectTxs(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	newChainTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt+1, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+
+	accA.TxCnt++
+	defer func() { accA.TxCnt-- }()
+	staleTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt-1, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, []byte{1})
+	droppedTx, _ := protocol.ConstrFundsTx(0x01, 10, 2, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	pendingTx, _ := protocol.ConstrFundsTx(0x01, 10, 3, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	forgedTx, _ := protocol.ConstrFundsTx(0x01, 10, 4, accA.TxCnt, accAHash, accBHash, PrivKeyAccB, PrivKeyMultiSig, nil)
+
+	//The rollback could not write droppedTx back to the mempool, the other txs are pending again.
+	for _, tx := range []*protocol.FundsTx{pendingTx, forgedTx, newChainTx, staleTx} {
+		storage.WriteOpenTx(tx)
+	}
+	storage.WriteClosedTx(newChainTx)
+	storage.DeleteOpenTx(newChainTx)
+
+	reinjectTxs([]protocol.Transaction{droppedTx, pendingTx, forgedTx, newChainTx, staleTx})
+
+	for _, tx := range []*protocol.FundsTx{droppedTx, pendingTx} {
+		if storage.ReadOpenTx(tx.Hash()) == nil {
+			t.Errorf("Tx (%x) with fee %v has not been re-injected.\n", tx.Hash(), tx.Fee)
+		}
+	}
+	for _, tx := range []*protocol.FundsTx{forgedTx, newChainTx, staleTx} {
+		if storage.ReadOpenTx(tx.Hash()) != nil {
+			t.Errorf("Tx (%x) with fee %v has been re-injected.\n", tx.Hash(), tx.Fee)
+		}
+	}
+}
@@ -8,6 +8,12 @@ const (
 	TXFETCH_TIMEOUT    = 5  //Sec
 	BLOCKFETCH_TIMEOUT = 40 //Sec
 
+	//Sync parameters for nodes joining the network
+	SYNC_HEADERS_RANGE = 500 //Headers per request
+	SYNC_PARALLEL_REQS = 16  //Requests sent in parallel
+	SYNC_RETRIES       = 3
+	SYNC_TIP_PEERS     = 3 //Peers asked for the last block, the majority needs to agree
+
 	//Some prominent programming languages (e.g., Java) have not unsigned integer types
 	//Neglecting MSB simplifies compatibility
 	MAX_MONEY = 9223372036854775807 //(2^63)-1
@@ -26,4 +32,6 @@ const (
 	SLASHING_WINDOW_SIZE = 100     //Blocks
 	SLASH_REWARD         = 2       //Coins
 	NUM_INCL_PREV_PROOFS = 5       //Number of previous proofs included in the PoS condition
+	MULTISIG_REQUIRED    = 1       //0 or 1
+	BLOCK_GAS_LIMIT      = 10000000 //Gas
 )
@@ -0,0 +1,116 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
+	"github.com/bazo-blockchain/bazo-vm/vm"
+)
+
+//A fundsTx with data sent to an account with a smart contract calls the contract. The contract is executed when the
+//tx is added to a block and again when the block is validated, so every node applies the same changes to the contract
+//variables. The execution only depends on the account and the tx, hence it is deterministic.
+//Gas is not metered: the VM does not report the gas an execution consumed. The gas limit of a call (at most its fee)
+//is only a cap on the execution and counts against the block gas limit. The tx pays its whole fee like any other
+//fundsTx, no matter how much gas the execution needed, and nothing is refunded. A call running out of gas fails like
+//any other failing call: the tx is still applied and pays its fee, but the contract variables stay the same and the
+//amount is not transferred. This way, the gas of a block is known without executing the contracts.
+func isContractCall(tx *protocol.FundsTx, accReceiver *protocol.Account) bool {
+	return tx.Data != nil && accReceiver.Contract != nil
+}
+
+//Gas the tx uses if it is added to the next block, txs not calling a contract do not use gas.
+func txGas(tx protocol.Transaction) uint64 {
+	fundsTx, ok := tx.(*protocol.FundsTx)
+	if !ok {
+		return 0
+	}
+
+	accReceiver := storage.State[fundsTx.To]
+	if accReceiver == nil || !isContractCall(fundsTx, accReceiver) {
+		return 0
+	}
+
+	return fundsTx.Gas()
+}
+
+//Returns an error if the call does not fit into a block whose contract calls already use blockGas.
+func checkBlockGas(tx *protocol.FundsTx, blockGas uint64) error {
+	//blockGas+tx.Gas() > Block_gas_limit, without overflowing.
+	if tx.Gas() > activeParameters.Block_gas_limit || blockGas > activeParameters.Block_gas_limit-tx.Gas() {
+		return errors.New(fmt.Sprintf("Contract call exceeds the block gas limit: %v (tx gas) + %v (block gas) > %v.", tx.Gas(), blockGas, activeParameters.Block_gas_limit))
+	}
+
+	return nil
+}
+
+//Executes the contract of the receiver account. The changed contract variables are written to the account only if
+//the execution succeeded. The revert changes of the returned call restore the previous values of the variables.
+func execContract(tx *protocol.FundsTx, accReceiver *protocol.Account) protocol.ContractCallDiff {
+	call := protocol.ContractCallDiff{TxHash: tx.Hash(), Account: tx.To, GasLimit: tx.Gas()}
+
+	context, _, err := runContract(tx, accReceiver)
+	if err != nil {
+		logger.Printf("Contract call (%x) failed: %v\n", call.TxHash[0:8], err)
+		call.Failed = true
+		return call
+	}
+
+	//Update changes vm has made to the contract variables
+	call.RevertChanges = context.GetRevertChanges()
+	context.PersistChanges()
+	accReceiver.ContractVariables = context.ContractVariables
+
+	return call
+}
+
+//Runs the contract of the receiver account, the changes of the contract variables are only recorded in the returned
+//context. The result is the top of the evaluation stack after the execution, nil if the stack is empty.
+func runContract(tx *protocol.FundsTx, accReceiver *protocol.Account) (context *protocol.Context, result []byte, err error) {
+	context = protocol.NewContext(*accReceiver, *tx)
+	virtualMachine := vm.NewVM(context)
+
+	//Check if vm execution run without error
+	if !virtualMachine.Exec(false) {
+		return context, nil, errors.New(virtualMachine.GetErrorMsg())
+	}
+
+	result, _ = virtualMachine.PeekResult()
+	return context, result, nil
+}
+
+//Receipts of all txs of a block in the order of the merkle tree leaves. The outcome of the contract calls is taken
+//from the contract diff the block has been applied with.
+func blockReceipts(block *protocol.Block, contractDiff *protocol.ContractDiff) (receipts []*protocol.Receipt) {
+	for _, txHash := range block.TxHashes() {
+		receipt := protocol.NewReceipt(txHash)
+		if call := contractDiff.Call(txHash); call != nil {
+			receipt.Success = !call.Failed
+			receipt.GasLimit = call.GasLimit
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts
+}
+
+//Restores the contract variables of the account to the values before the call.
+func revertContract(call *protocol.ContractCallDiff, acc *protocol.Account) {
+	for cnt := len(call.RevertChanges) - 1; cnt >= 0; cnt-- {
+		index, value := call.RevertChanges[cnt].GetChange()
+		acc.ContractVariables[index] = value
+	}
+}
+
+//Copy of an account whose contract variables can be changed without affecting the original account.
+func copyAccount(acc *protocol.Account) *protocol.Account {
+	accCopy := *acc
+	accCopy.ContractVariables = make([][]byte, len(acc.ContractVariables))
+	for i, variable := range acc.ContractVariables {
+		accCopy.ContractVariables[i] = append([]byte(nil), variable...)
+	}
+
+	return &accCopy
+}
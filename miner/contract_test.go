@@ -3,6 +3,7 @@ package miner
 import (
 	"fmt"
 	"github.com/bazo-blockchain/bazo-miner/crypto"
+	"math"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -262,6 +263,310 @@ func TestMultipleBlocksWithTokenizationContractTxWhichAddsKey(t *testing.T) {
 	}
 }
 
+//Building a block must not change the contract variables in the state, they are only changed when the block is
+//validated. This way, every node validating the block executes the contract the same way.
+func TestContractExecutedOnValidation(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	contract := []byte{
+		35,    // CALLDATA
+		29, 0, // SLOAD
+		4,     // ADD
+		27, 0, // SSTORE
+		50, // HALT
+	}
+	createBlockWithSingleContractDeployTx(b, contract, [][]byte{{0, 2}})
+	finalizeBlock(b)
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation for (%v) failed: %v\n", b, err)
+	}
+
+	b2 := newBlock(b.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 2)
+	hash := createBlockWithSingleContractCallTx(b2, []byte{1, 0, 15})
+	acc, _ := storage.GetAccount(hash)
+	if expected := [][]byte{{0, 2}}; !reflect.DeepEqual(acc.ContractVariables, expected) {
+		t.Errorf("Contract variables changed while building the block, expected: '%v', is '%v'.", expected, acc.ContractVariables)
+	}
+	if expected := [][]byte{{0, 17}}; !reflect.DeepEqual(b2.StateCopy[hash].ContractVariables, expected) {
+		t.Errorf("Contract not executed on the state copy, expected: '%v', is '%v'.", expected, b2.StateCopy[hash].ContractVariables)
+	}
+
+	finalizeBlock(b2)
+	if err := validate(b2, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	acc, _ = storage.GetAccount(hash)
+	if expected := [][]byte{{0, 17}}; !reflect.DeepEqual(acc.ContractVariables, expected) {
+		t.Errorf("State change not persisted, expected: '%v', is '%v'.", expected, acc.ContractVariables)
+	}
+}
+
+//Rolling back blocks with contract calls restores the contract variables of every block.
+func TestContractRollback(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	contract := []byte{
+		35,    // CALLDATA
+		29, 0, // SLOAD
+		4,     // ADD
+		27, 0, // SSTORE
+		50, // HALT
+	}
+	createBlockWithSingleContractDeployTx(b, contract, [][]byte{{0, 2}})
+	finalizeBlock(b)
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation for (%v) failed: %v\n", b, err)
+	}
+
+	b2 := newBlock(b.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 2)
+	hash := createBlockWithSingleContractCallTx(b2, []byte{1, 0, 15})
+	finalizeBlock(b2)
+	if err := validate(b2, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	b3 := newBlock(b2.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 3)
+	createBlockWithSingleContractCallTx(b3, []byte{1, 0, 15})
+	finalizeBlock(b3)
+	if err := validate(b3, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	acc, _ := storage.GetAccount(hash)
+	if expected := [][]byte{{0, 32}}; !reflect.DeepEqual(acc.ContractVariables, expected) {
+		t.Errorf("State change not persisted, expected: '%v', is '%v'.", expected, acc.ContractVariables)
+	}
+
+	if err := rollback(b3); err != nil {
+		t.Errorf("Rollback failed: %v\n", err)
+	}
+	if expected := [][]byte{{0, 17}}; !reflect.DeepEqual(acc.ContractVariables, expected) {
+		t.Errorf("Contract variables not rolled back, expected: '%v', is '%v'.", expected, acc.ContractVariables)
+	}
+	if storage.ReadContractDiff(b3.Hash) != nil {
+		t.Error("Contract diff of the rolled back block has not been deleted.")
+	}
+
+	if err := rollback(b2); err != nil {
+		t.Errorf("Rollback failed: %v\n", err)
+	}
+	if expected := [][]byte{{0, 2}}; !reflect.DeepEqual(acc.ContractVariables, expected) {
+		t.Errorf("Contract variables not rolled back, expected: '%v', is '%v'.", expected, acc.ContractVariables)
+	}
+}
+
+//A call running out of gas fails but pays its fee, the gas of all calls of a block is bounded by the block gas limit.
+func TestContractGasLimit(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	createBlockWithSingleContractDeployTx(b, []byte{
+		19, 0, 0, // JMP 0
+	}, nil)
+	finalizeBlock(b)
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation for (%v) failed: %v\n", b, err)
+	}
+
+	var contractHash [32]byte
+	for _, acc := range getAccountsWithContracts() {
+		contractHash = acc.Hash()
+	}
+	accAHash := protocol.SerializeHashContent(accA.Address)
+
+	b2 := newBlock(b.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 2)
+	loopTx, _ := protocol.ConstrContractCallTx(0x01, 1, 1000, 100, accA.TxCnt, accAHash, contractHash, PrivKeyAccA, PrivKeyMultiSig, []byte{1})
+	if err := addTx(b2, loopTx); err != nil || b2.ContractGas != 100 {
+		t.Errorf("Adding contract call running out of gas failed: %v\n", err)
+	}
+	storage.WriteOpenTx(loopTx)
+
+	overpricedTx, _ := protocol.ConstrContractCallTx(0x01, 1, 100, 1000, accA.TxCnt, accAHash, contractHash, PrivKeyAccA, PrivKeyMultiSig, []byte{1})
+	if verify(overpricedTx) {
+		t.Error("Contract call with a gas limit exceeding the fee has been verified.\n")
+	}
+
+	//Calls of a contract which halts immediately, only two of them fit into a block.
+	createBlockWithSingleContractDeployTx(b2, []byte{50}, nil)
+	txCnt, balance := accA.TxCnt, storage.State[contractHash].Balance
+	finalizeBlock(b2)
+	if err := validate(b2, false); err != nil {
+		t.Errorf("Block validation for (%v) failed: %v\n", b2, err)
+	}
+
+	if receipt := storage.ReadReceipt(loopTx.Hash()); receipt == nil || receipt.Success || receipt.GasLimit != 100 {
+		t.Errorf("Wrong receipt of the call running out of gas: %v\n", receipt)
+	}
+	if accA.TxCnt != txCnt+1 || storage.State[contractHash].Balance != balance {
+		t.Error("The amount of the failed call has been transferred.\n")
+	}
+	for _, acc := range getAccountsWithContracts() {
+		if acc.Contract[0] == 50 {
+			contractHash = acc.Hash()
+		}
+	}
+
+	activeParameters.Block_gas_limit = 2500
+	var txs []*protocol.FundsTx
+	for cnt := uint32(0); cnt < 3; cnt++ {
+		tx, _ := protocol.ConstrContractCallTx(0x01, 1, 1000, 1000, accA.TxCnt+cnt, accAHash, contractHash, PrivKeyAccA, PrivKeyMultiSig, []byte{1})
+		txs = append(txs, tx)
+	}
+
+	b3 := newBlock(b2.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 3)
+	if err := addTx(b3, txs[0]); err != nil {
+		t.Errorf("Adding contract call failed: %v\n", err)
+	}
+	if err := addTx(b3, txs[1]); err != nil {
+		t.Errorf("Adding contract call failed: %v\n", err)
+	}
+	if err := addTx(b3, txs[2]); err == nil || b3.ContractGas != 2000 {
+		t.Errorf("Contract call exceeding the block gas limit has been added to the block: %v (block gas)\n", b3.ContractGas)
+	}
+
+	txCnt = accA.TxCnt
+	contractDiff := new(protocol.ContractDiff)
+	applied, err := fundsStateChange(txs, contractDiff, lastBlock)
+	if err == nil || len(applied) != 2 {
+		t.Error("Contract calls exceeding the block gas limit have been applied.\n")
+	}
+	fundsStateChangeRollback(applied, contractDiff)
+	if accA.TxCnt != txCnt {
+		t.Errorf("Rolling back the applied contract calls failed: %v (txCnt)\n", accA.TxCnt)
+	}
+	if _, err := fundsStateChange(txs[:2], new(protocol.ContractDiff), lastBlock); err != nil || accA.TxCnt != txCnt+2 {
+		t.Errorf("Applying contract calls within the block gas limit failed: %v\n", err)
+	}
+}
+
+//Every tx of a block gets a receipt, the block commits to them with the receipts root.
+func TestCheckBlockGas(t *testing.T) {
+	cleanAndPrepare()
+
+	limit := activeParameters.Block_gas_limit
+	tx := &protocol.FundsTx{Fee: 100, GasLimit: 100}
+	if err := checkBlockGas(tx, limit-100); err != nil {
+		t.Errorf("Call that fits into the block was rejected: %v\n", err)
+	}
+	if err := checkBlockGas(tx, limit-99); err == nil {
+		t.Error("Call exceeding the block gas limit was accepted.")
+	}
+	//The sum would overflow.
+	tx = &protocol.FundsTx{Fee: ^uint64(0), GasLimit: ^uint64(0)}
+	if err := checkBlockGas(tx, 1); err == nil {
+		t.Error("Call whose gas overflows the block gas was accepted.")
+	}
+	if err := checkBlockGas(&protocol.FundsTx{Fee: 1}, limit+1); err == nil {
+		t.Error("Call was accepted although the block gas exceeds the limit already.")
+	}
+}
+
+func TestContractReceipts(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	contract := []byte{
+		35,    // CALLDATA
+		29, 0, // SLOAD
+		4,     // ADD
+		27, 0, // SSTORE
+		50, // HALT
+	}
+	createBlockWithSingleContractDeployTx(b, contract, [][]byte{{0, 2}})
+	finalizeBlock(b)
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation for (%v) failed: %v\n", b, err)
+	}
+
+	b2 := newBlock(b.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 2)
+	createBlockWithSingleContractCallTx(b2, []byte{1, 0, 15})
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	fundsTx, _ := protocol.ConstrFundsTx(0x01, 5, 1, accA.TxCnt+1, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	if err := addTx(b2, fundsTx); err != nil {
+		t.Errorf("Adding fundsTx failed: %v\n", err)
+	}
+	storage.WriteOpenTx(fundsTx)
+	finalizeBlock(b2)
+	if err := validate(b2, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	var receipts []*protocol.Receipt
+	for _, txHash := range b2.TxHashes() {
+		receipts = append(receipts, storage.ReadReceipt(txHash))
+	}
+	if len(receipts) != 2 || receipts[0] == nil || receipts[1] == nil {
+		t.Fatalf("Receipts of the block have not been stored: %v\n", receipts)
+	}
+	if !receipts[0].Success || receipts[0].GasLimit != 100000 || !receipts[1].Success || receipts[1].GasLimit != 0 {
+		t.Errorf("Wrong receipts: %v\n", receipts)
+	}
+	if b2.ReceiptsRoot == [32]byte{} || protocol.ReceiptsRoot(receipts) != b2.ReceiptsRoot {
+		t.Errorf("Receipts root does not commit to the receipts: %x\n", b2.ReceiptsRoot)
+	}
+
+	if err := rollback(b2); err != nil {
+		t.Errorf("Rollback failed: %v\n", err)
+	}
+	if storage.ReadReceipt(fundsTx.Hash()) != nil {
+		t.Error("Receipt of the rolled back block has not been deleted.\n")
+	}
+}
+
+//A simulated call returns the result and the changes of the contract without changing the state.
+func TestCallContract(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	contract := []byte{
+		35,    // CALLDATA
+		29, 0, // SLOAD
+		4,     // ADD
+		27, 0, // SSTORE
+		29, 0, // SLOAD
+		50, // HALT
+	}
+	createBlockWithSingleContractDeployTx(b, contract, [][]byte{{0, 2}})
+	finalizeBlock(b)
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation for (%v) failed: %v\n", b, err)
+	}
+
+	contractHash := getAccountsWithContracts()[0].Hash()
+	result, err := CallContract(protocol.FundsTx{To: contractHash, Data: []byte{1, 0, 15}})
+	if err != nil {
+		t.Fatalf("Contract call failed: %v\n", err)
+	}
+
+	if expected := []byte{0, 17}; !reflect.DeepEqual(result.Result, expected) {
+		t.Errorf("Wrong result, expected: '%v', is '%v'.", expected, result.Result)
+	}
+	if expected := []protocol.Change{protocol.NewChange(0, []byte{0, 17})}; !reflect.DeepEqual(result.Changes, expected) {
+		t.Errorf("Wrong changes, expected: '%v', is '%v'.", expected, result.Changes)
+	}
+	if acc, _ := storage.GetAccount(contractHash); !reflect.DeepEqual(acc.ContractVariables, [][]byte{{0, 2}}) {
+		t.Errorf("Simulated call changed the contract variables: %v\n", acc.ContractVariables)
+	}
+
+	if _, err := CallContract(protocol.FundsTx{To: contractHash, GasLimit: 1, Data: []byte{1, 0, 15}}); err == nil {
+		t.Error("Contract call running out of gas succeeded.\n")
+	}
+	//The gas of a call is capped at the block gas limit.
+	blockGasLimit := activeParameters.Block_gas_limit
+	activeParameters.Block_gas_limit = 1
+	if _, err := CallContract(protocol.FundsTx{To: contractHash, GasLimit: math.MaxUint64, Data: []byte{1, 0, 15}}); err == nil {
+		t.Error("Contract call exceeding the block gas limit succeeded.\n")
+	}
+	activeParameters.Block_gas_limit = blockGasLimit
+	if _, err := CallContract(protocol.FundsTx{To: protocol.SerializeHashContent(accA.Address), Data: []byte{1}}); err == nil {
+		t.Error("Account without a contract has been called.\n")
+	}
+}
+
 func createBlockWithSingleContractDeployTx(b *protocol.Block, contract []byte, contractVariables [][]byte) [32]byte {
 	tx, _, _ := protocol.ConstrAccTx(0, 1000000, [64]byte{}, PrivKeyRoot, contract, contractVariables)
 	if err := addTx(b, tx); err == nil {
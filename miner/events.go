@@ -0,0 +1,70 @@
+package miner
+
+import (
+	"sync"
+
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+//Events about changes of the chain, consumed by subscribers such as the rpc package. Events are published while the
+//block is validated, hence publishing must never block. A subscriber that does not keep up gets its channel closed and
+//has to subscribe again (and check for events it may have missed).
+
+const (
+	EVENT_BLOCK    = iota //A block has been appended to the chain
+	EVENT_ROLLBACK        //A block has been rolled back
+)
+
+const EVENT_BUFFER_SIZE = 100
+
+type Event struct {
+	Type     uint8
+	Block    *protocol.Block
+	FundsTxs []*protocol.FundsTx //FundsTxs of the block
+}
+
+var (
+	subscribers     = make(map[chan Event]bool)
+	subscriberMutex = &sync.Mutex{}
+)
+
+func Subscribe() chan Event {
+	subscriberMutex.Lock()
+	defer subscriberMutex.Unlock()
+
+	events := make(chan Event, EVENT_BUFFER_SIZE)
+	subscribers[events] = true
+
+	return events
+}
+
+//Safe to call for channels that have already been closed because the subscriber fell behind.
+func Unsubscribe(events chan Event) {
+	subscriberMutex.Lock()
+	defer subscriberMutex.Unlock()
+
+	if subscribers[events] {
+		delete(subscribers, events)
+		close(events)
+	}
+}
+
+func publishEvent(eventType uint8, block *protocol.Block, fundsTxs []*protocol.FundsTx) {
+	subscriberMutex.Lock()
+	defer subscriberMutex.Unlock()
+
+	//The block's StateCopy is still changed by the miner, the subscribers get their own copy of the block.
+	blockCopy := *block
+	blockCopy.StateCopy = nil
+	event := Event{eventType, &blockCopy, append([]*protocol.FundsTx(nil), fundsTxs...)}
+
+	for events := range subscribers {
+		select {
+		case events <- event:
+		default:
+			logger.Printf("Subscriber did not keep up with the events, closing subscription.\n")
+			delete(subscribers, events)
+			close(events)
+		}
+	}
+}
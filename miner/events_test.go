@@ -0,0 +1,35 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/bazo-blockchain/bazo-miner/crypto"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+func TestPublishEvent(t *testing.T) {
+
+	events := Subscribe()
+	defer Unsubscribe(events)
+
+	block := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	publishEvent(EVENT_ROLLBACK, block, nil)
+
+	event := <-events
+	if event.Type != EVENT_ROLLBACK || event.Block.Hash != block.Hash || event.Block == block {
+		t.Errorf("Wrong event received: %v\n", event)
+	}
+
+	//A subscriber that does not consume its events gets unsubscribed.
+	for i := 0; i <= EVENT_BUFFER_SIZE; i++ {
+		publishEvent(EVENT_BLOCK, block, []*protocol.FundsTx{})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != EVENT_BUFFER_SIZE {
+		t.Errorf("Received %v events before the subscription was closed, expected %v.\n", received, EVENT_BUFFER_SIZE)
+	}
+}
@@ -239,6 +239,8 @@ func cleanAndPrepare() {
 	accB.Balance = 823237654321
 	accA.TxCnt = 0
 	accB.TxCnt = 0
+
+	stateTree = protocol.BuildStateTree(storage.State)
 }
 
 func TestMain(m *testing.M) {
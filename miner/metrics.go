@@ -0,0 +1,21 @@
+package miner
+
+import (
+	"github.com/bazo-blockchain/bazo-miner/metrics"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+var (
+	heightGauge       = metrics.NewGauge("bazo_chain_height", "Height of the last closed block.")
+	difficultyGauge   = metrics.NewGauge("bazo_difficulty", "Current difficulty of the proof of stake.")
+	validationLatency = metrics.NewHistogram("bazo_block_validation_seconds", "Time to validate a block including rollbacks and tx fetching.",
+		[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60})
+	rollbackCounter = metrics.NewCounter("bazo_block_rollbacks_total", "Number of rolled back blocks.")
+	txFetchTimeouts = metrics.NewCounterVec("bazo_tx_fetch_timeouts_total", "Number of txs that could not be fetched from the network in time.", "type")
+)
+
+//Called whenever the last closed block changes.
+func updateChainMetrics(lastClosedBlock *protocol.Block) {
+	heightGauge.Set(float64(lastClosedBlock.Height))
+	difficultyGauge.Set(float64(getDifficulty()))
+}
@@ -1,6 +1,9 @@
 package miner
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/bazo-blockchain/bazo-miner/p2p"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/bazo-blockchain/bazo-miner/storage"
@@ -16,6 +19,68 @@ func incomingData() {
 	}
 }
 
+//Constantly listen to FundsTxs from the network that conflict with a pending tx
+func incomingTxReplacements() {
+	for {
+		tx := <-p2p.TxReplacementIn
+		if err := ReplaceTx(tx); err != nil {
+			logger.Printf("Received fundsTx (%x) did not replace the pending transaction: %v\n", tx.Hash(), err)
+		}
+	}
+}
+
+//Constantly answer account proof requests from the network
+func incomingAccProofReqs() {
+	for {
+		req := <-p2p.AccProofReqIn
+		proof, err := GetAccountProof(req.BlockHash, req.AccHash)
+		req.Res <- p2p.AccProofRes{Proof: proof, Err: err}
+	}
+}
+
+//Proofs are only built against the state root of the last closed block, the state of previous blocks is not kept.
+func GetAccountProof(blockHash, accHash [32]byte) (proof *protocol.StateProof, err error) {
+	blockValidation.Lock()
+	defer blockValidation.Unlock()
+
+	lastClosedBlock := storage.ReadLastClosedBlock()
+	if lastClosedBlock == nil || lastClosedBlock.Hash != blockHash {
+		return nil, errors.New(fmt.Sprintf("Account proofs are only built for the last closed block, not for block (%x).", blockHash[0:8]))
+	}
+
+	if stateTree.Root() != lastClosedBlock.StateRoot {
+		return nil, errors.New(fmt.Sprintf("State does not correspond to the state root of block (%x).", blockHash[0:8]))
+	}
+
+	proof = stateTree.Proof(accHash)
+	proof.BlockHash = blockHash
+	proof.Height = lastClosedBlock.Height
+	if acc, exists := storage.State[accHash]; exists {
+		proof.Account = copyAccount(acc)
+	}
+
+	return proof, nil
+}
+
+//Replace-by-fee: a fundsTx replaces the pending fundsTxs with the same sender and txCnt if it pays a higher fee. The
+//signature is verified first, otherwise anybody could replace the pending txs of an account. Replacements are relayed.
+func ReplaceTx(tx *protocol.FundsTx) error {
+	blockValidation.Lock()
+	valid := verifyFundsTx(tx)
+	blockValidation.Unlock()
+
+	if !valid {
+		return errors.New("Transaction could not be verified.")
+	}
+
+	if err := storage.ReplaceOpenTx(tx); err != nil {
+		return err
+	}
+
+	logger.Printf("Replaced pending transaction(s) of sender (%x) with txCnt %v by fundsTx (%x).\n", tx.From[0:8], tx.TxCnt, tx.Hash())
+	return p2p.BroadcastTx(tx)
+}
+
 //ReceivedBlockStash is a stash with all Blocks received such that we can prevent forking
 func processBlock(payload []byte) {
 	var block *protocol.Block
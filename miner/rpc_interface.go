@@ -0,0 +1,112 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
+)
+
+//Read access to the miner's data for the rpc package. The state and the last block are changed during block
+//validation, so all accesses claim the same mutex and return copies.
+
+//Outcome of a contract call simulated on the current state.
+type ContractCallResult struct {
+	Result  []byte            //Top of the evaluation stack after the execution, nil if the stack is empty
+	Changes []protocol.Change //Changes the call would make to the contract variables
+}
+
+type SyncStatus struct {
+	Syncing   bool //True as long as the initial state is being built
+	UpToDate  bool //False if the last received block was more than DELAYED_BLOCKS ahead
+	Height    uint32
+	BlockHash [32]byte
+}
+
+func GetActiveParameters() (parameters Parameters, err error) {
+	blockValidation.Lock()
+	defer blockValidation.Unlock()
+
+	if activeParameters == nil {
+		return parameters, errors.New("Parameters not initialized yet.")
+	}
+
+	return *activeParameters, nil
+}
+
+func GetAccount(accHash [32]byte) (acc protocol.Account, err error) {
+	blockValidation.Lock()
+	defer blockValidation.Unlock()
+
+	stateAcc, exists := storage.State[accHash]
+	if !exists {
+		return acc, errors.New(fmt.Sprintf("Account (%x) not in the state.", accHash[0:8]))
+	}
+
+	acc = *stateAcc
+	acc.ContractVariables = make([][]byte, len(stateAcc.ContractVariables))
+	for i, variable := range stateAcc.ContractVariables {
+		acc.ContractVariables[i] = append([]byte(nil), variable...)
+	}
+
+	return acc, nil
+}
+
+//Runs the contract of the receiver of the tx on a copy of its account, nothing is persisted. The tx does not need to
+//be signed or valid, it only provides the context of the call. A call may use at most the gas of a whole block, a call
+//without gas uses all of it.
+func CallContract(tx protocol.FundsTx) (result ContractCallResult, err error) {
+	acc, blockGasLimit, err := readContractAccount(tx.To)
+	if err != nil {
+		return result, err
+	}
+
+	if tx.Gas() == 0 || tx.Gas() > blockGasLimit {
+		tx.GasLimit = blockGasLimit
+	}
+
+	//The contract runs on the copy without holding the lock, it does not stall the block validation.
+	context, output, err := runContract(&tx, acc)
+	if err != nil {
+		return result, err
+	}
+
+	return ContractCallResult{output, context.GetChanges()}, nil
+}
+
+//Returns a copy of the account with the contract together with the current block gas limit.
+func readContractAccount(accHash [32]byte) (acc *protocol.Account, blockGasLimit uint64, err error) {
+	blockValidation.Lock()
+	defer blockValidation.Unlock()
+
+	stateAcc, exists := storage.State[accHash]
+	if !exists {
+		return nil, 0, errors.New(fmt.Sprintf("Account (%x) not in the state.", accHash[0:8]))
+	}
+	if stateAcc.Contract == nil {
+		return nil, 0, errors.New(fmt.Sprintf("Account (%x) has no contract.", accHash[0:8]))
+	}
+
+	blockGasLimit = BLOCK_GAS_LIMIT
+	if activeParameters != nil {
+		blockGasLimit = activeParameters.Block_gas_limit
+	}
+
+	return copyAccount(stateAcc), blockGasLimit, nil
+}
+
+func GetSyncStatus() (status SyncStatus) {
+	blockValidation.Lock()
+	defer blockValidation.Unlock()
+
+	if lastBlock == nil {
+		status.Syncing = true
+		return status
+	}
+
+	status.UpToDate = uptodate
+	status.Height = lastBlock.Height
+	status.BlockHash = lastBlock.Hash
+
+	return status
+}
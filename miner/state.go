@@ -8,7 +8,6 @@ import (
 	"strconv"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/bazo-blockchain/bazo-miner/storage"
-	"time"
 )
 
 //Separate function to reuse mechanism in client implementation
@@ -71,6 +70,16 @@ func CheckAndChangeParameters(parameters *Parameters, configTxSlice *[]*protocol
 				parameters.Slash_reward = tx.Payload
 				change = true
 			}
+		case protocol.MULTISIG_REQUIRED_ID:
+			if parameterBoundsChecking(protocol.MULTISIG_REQUIRED_ID, tx.Payload) {
+				parameters.Multisig_required = tx.Payload
+				change = true
+			}
+		case protocol.BLOCK_GAS_LIMIT_ID:
+			if parameterBoundsChecking(protocol.BLOCK_GAS_LIMIT_ID, tx.Payload) {
+				parameters.Block_gas_limit = tx.Payload
+				change = true
+			}
 		}
 	}
 
@@ -86,55 +95,26 @@ func getState() (state string) {
 }
 
 func initState() (initialBlock *protocol.Block, err error) {
-	var allClosedBlocks []*protocol.Block
-	if p2p.IsBootstrap() {
-		allClosedBlocks = storage.ReadAllClosedBlocks()
-	} else {
-		p2p.LastBlockReq()
-		var lastBlock *protocol.Block
-		//Blocking wait
-		select {
-		case encodedBlock := <-p2p.BlockReqChan:
-			lastBlock = lastBlock.Decode(encodedBlock)
-			//Limit waiting time to BLOCKFETCH_TIMEOUT seconds before aborting.
-		case <-time.After(BLOCKFETCH_TIMEOUT * time.Second):
-			return nil, nil
-		}
-
-		storage.WriteClosedBlock(lastBlock)
-		storage.WriteLastClosedBlock(lastBlock)
-		if len(allClosedBlocks) > 0 && allClosedBlocks[len(allClosedBlocks)-1].Hash == lastBlock.Hash {
-			fmt.Printf("Block with height %v already exists", lastBlock.Height)
-		} else {
-			allClosedBlocks = append(allClosedBlocks, lastBlock)
+	//If the state has been persisted before, there is no need to replay all closed blocks.
+	if state, rootKeys := storage.ReadState(); len(state) > 0 && storage.ReadLastClosedBlock() != nil {
+		if initialBlock, err = restoreState(state, rootKeys); err == nil {
+			return initialBlock, nil
 		}
+		logger.Printf("Could not restore the persisted state, replaying all blocks: %v\n", err)
+	}
 
-		for {
-			p2p.BlockReq(lastBlock.PrevHash)
-			select {
-			case encodedBlock := <-p2p.BlockReqChan:
-				lastBlock = lastBlock.Decode(encodedBlock)
-				//Limit waiting time to BLOCKFETCH_TIMEOUT seconds before aborting.
-			case <-time.After(BLOCKFETCH_TIMEOUT * time.Second):
-				logger.Println("Timed out")
-			}
-
-			storage.WriteClosedBlock(lastBlock)
-			if len(allClosedBlocks) > 0 && allClosedBlocks[len(allClosedBlocks)-1].Hash == lastBlock.Hash {
-				fmt.Printf("Block with height %v already exists", lastBlock.Height)
-			} else {
-				allClosedBlocks = append(allClosedBlocks, lastBlock)
-			}
-			fmt.Println("Last block: ", lastBlock.Height)
-			if lastBlock.Height == 0 {
-				break;
-			}
+	//Synced blocks are only written to storage once they have been validated.
+	synced := !p2p.IsBootstrap()
+	if synced {
+		defer clearSyncedTxs()
+		if storage.AllClosedBlocksAsc, err = syncBlocks(); err != nil {
+			return nil, err
 		}
+	} else {
+		//Switch array order to validate genesis block first
+		storage.AllClosedBlocksAsc = InvertBlockArray(storage.ReadAllClosedBlocks())
 	}
 
-	//Switch array order to validate genesis block first
-	storage.AllClosedBlocksAsc = InvertBlockArray(allClosedBlocks)
-
 	if len(storage.AllClosedBlocksAsc) > 0 {
 		//Set the last closed block as the initial block
 		initialBlock = storage.AllClosedBlocksAsc[len(storage.AllClosedBlocksAsc)-1]
@@ -154,6 +134,9 @@ func initState() (initialBlock *protocol.Block, err error) {
 		storage.WriteClosedBlock(initialBlock)
 	}
 
+	//The state tree is built once and updated with the accounts changed by each block.
+	stateTree = protocol.BuildStateTree(storage.State)
+
 	//Validate all closed blocks and update state
 	for _, blockToValidate := range storage.AllClosedBlocksAsc {
 		//Prepare datastructure to fill tx payloads
@@ -162,12 +145,12 @@ func initState() (initialBlock *protocol.Block, err error) {
 		//Do not validate the genesis block, since a lot of properties are set to nil
 		if blockToValidate.Hash != [32]byte{} {
 			//Fetching payload data from the txs (if necessary, ask other miners)
-			accTxs, fundsTxs, configTxs, stakeTxs, err := preValidate(blockToValidate, true)
+			accTxs, fundsTxs, configTxs, stakeTxs, batchTxs, keyTxs, err := preValidate(blockToValidate, true)
 			if err != nil {
 				return nil, errors.New(fmt.Sprintf("Block (%x) could not be prevalidated: %v\n", blockToValidate.Hash[0:8], err))
 			}
 
-			blockDataMap[blockToValidate.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, blockToValidate}
+			blockDataMap[blockToValidate.Hash] = blockData{accTxs, fundsTxs, configTxs, stakeTxs, batchTxs, keyTxs, blockToValidate, new(protocol.ContractDiff)}
 
 			err = validateState(blockDataMap[blockToValidate.Hash])
 			if err != nil {
@@ -176,11 +159,17 @@ func initState() (initialBlock *protocol.Block, err error) {
 
 			postValidate(blockDataMap[blockToValidate.Hash], true)
 		} else {
-			blockDataMap[blockToValidate.Hash] = blockData{nil, nil, nil, nil, blockToValidate}
+			blockDataMap[blockToValidate.Hash] = blockData{nil, nil, nil, nil, nil, nil, blockToValidate, nil}
 
 			postValidate(blockDataMap[blockToValidate.Hash], true)
 		}
 
+		if synced {
+			if err := storage.WriteClosedBlock(blockToValidate); err != nil {
+				return nil, err
+			}
+		}
+
 		logger.Printf("Validated block with height %v\n", blockToValidate.Height)
 
 		//calculate the blockchain size for all validated blocks.
@@ -190,15 +179,217 @@ func initState() (initialBlock *protocol.Block, err error) {
 		lastBlock = blockToValidate
 	}
 
+	//Persist the whole state, subsequent restarts can restore it instead of replaying all blocks.
+	if err := storage.WriteClosedBlockWithState(lastBlock, getAllAccounts(), nil); err != nil {
+		return nil, err
+	}
+	if err := storage.WriteBlockIndex(storage.AllClosedBlocksAsc); err != nil {
+		return nil, err
+	}
+
 	logger.Printf("%v block(s) validated. Chain good to go.", len(storage.AllClosedBlocksAsc))
 
 	return initialBlock, nil
 }
 
+//Restores the persisted state. The account balances are taken as they are, only the system parameters and the
+//difficulty are recalculated from the closed blocks. The state is set after replaying the config txs, such that
+//parameter changes (e.g., staking minimum) are not applied a second time to the accounts.
+func restoreState(state, rootKeys map[[32]byte]*protocol.Account) (initialBlock *protocol.Block, err error) {
+	lastClosedBlock := storage.ReadLastClosedBlock()
+	restoredStateTree := protocol.BuildStateTree(state)
+	if stateRoot := restoredStateTree.Root(); lastClosedBlock.Hash != [32]byte{} && stateRoot != lastClosedBlock.StateRoot {
+		return nil, errors.New(fmt.Sprintf("Persisted state root (%x) does not match block (%x).", stateRoot[0:8], lastClosedBlock.Hash[0:8]))
+	}
+
+	blocks := InvertBlockArray(storage.ReadAllClosedBlocks())
+
+	//All checks are done before the parameters and statistics are changed, if the restore fails, initState replays
+	//the blocks from scratch and must not apply them a second time.
+	configTxSlices := make([][]*protocol.ConfigTx, len(blocks))
+	for i, block := range blocks {
+		for _, txHash := range block.ConfigTxData {
+			tx, ok := storage.ReadClosedTx(txHash).(*protocol.ConfigTx)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("ConfigTx (%x) of block (%x) not in closed storage.", txHash[0:8], block.Hash[0:8]))
+			}
+			configTxSlices[i] = append(configTxSlices[i], tx)
+		}
+	}
+
+	//Databases written before the block index existed get indexed here.
+	if err := storage.WriteBlockIndex(blocks); err != nil {
+		return nil, err
+	}
+
+	storage.AllClosedBlocksAsc = blocks
+	for i, block := range blocks {
+		configStateChange(configTxSlices[i], block.Hash)
+		collectStatistics(block)
+		CalculateBlockchainSize(block.GetSize())
+	}
+
+	for accHash, acc := range state {
+		storage.State[accHash] = acc
+	}
+	for accHash, acc := range rootKeys {
+		storage.RootKeys[accHash] = acc
+	}
+	stateTree = restoredStateTree
+
+	initialBlock = lastBlock
+	updateChainMetrics(initialBlock)
+	logger.Printf("State of %v account(s) restored at block height %v.", len(state), initialBlock.Height)
+
+	return initialBlock, nil
+}
+
+//Calculates the state root and the receipts root of a block by applying its txs on a copy of the state. All txs need
+//to be in open storage.
+func calculateRoots(block *protocol.Block) (stateRoot, receiptsRoot [32]byte, err error) {
+	data, err := readOpenBlockData(block)
+	if err != nil {
+		return stateRoot, receiptsRoot, err
+	}
+
+	//The global state is swapped with a deep copy and set back afterwards, root accounts point to the copied accounts.
+	state, rootKeys := storage.State, storage.RootKeys
+	storage.State = make(map[[32]byte]*protocol.Account)
+	storage.RootKeys = make(map[[32]byte]*protocol.Account)
+	for accHash, acc := range state {
+		storage.State[accHash] = copyAccount(acc)
+	}
+	for accHash := range rootKeys {
+		storage.RootKeys[accHash] = storage.State[accHash]
+	}
+	defer func() {
+		storage.State, storage.RootKeys = state, rootKeys
+	}()
+
+	if err = blockStateChange(data); err != nil {
+		return stateRoot, receiptsRoot, err
+	}
+
+	return updateStateTree(stateTree, getStateChangeAccounts(data)).Root(), protocol.ReceiptsRoot(blockReceipts(block, data.contractDiff)), nil
+}
+
+//Reads the txs of a block from open storage. The txs of each type keep the order of the block.
+func readOpenBlockData(block *protocol.Block) (data blockData, err error) {
+	data = blockData{block: block, contractDiff: new(protocol.ContractDiff)}
+
+	for _, txHash := range block.TxHashes() {
+		switch tx := storage.ReadOpenTx(txHash).(type) {
+		case *protocol.AccTx:
+			data.accTxSlice = append(data.accTxSlice, tx)
+		case *protocol.FundsTx:
+			data.fundsTxSlice = append(data.fundsTxSlice, tx)
+		case *protocol.ConfigTx:
+			data.configTxSlice = append(data.configTxSlice, tx)
+		case *protocol.StakeTx:
+			data.stakeTxSlice = append(data.stakeTxSlice, tx)
+		case *protocol.BatchTx:
+			data.batchTxSlice = append(data.batchTxSlice, tx)
+		case *protocol.KeyTx:
+			data.keyTxSlice = append(data.keyTxSlice, tx)
+		default:
+			return data, errors.New(fmt.Sprintf("Transaction (%x) not in open storage.", txHash[0:8]))
+		}
+	}
+
+	return data, nil
+}
+
+//Returns the state tree with the given accounts set to their current state, accounts that no longer exist are removed.
+func updateStateTree(tree *protocol.StateTree, accHashes [][32]byte) *protocol.StateTree {
+	for _, accHash := range accHashes {
+		tree = tree.Update(accHash, storage.State[accHash])
+	}
+
+	return tree
+}
+
+//Returns all txs of a block.
+func getBlockTxs(data blockData) (txs []protocol.Transaction) {
+	for _, tx := range data.accTxSlice {
+		txs = append(txs, tx)
+	}
+	for _, tx := range data.fundsTxSlice {
+		txs = append(txs, tx)
+	}
+	for _, tx := range data.configTxSlice {
+		txs = append(txs, tx)
+	}
+	for _, tx := range data.stakeTxSlice {
+		txs = append(txs, tx)
+	}
+	for _, tx := range data.batchTxSlice {
+		txs = append(txs, tx)
+	}
+	for _, tx := range data.keyTxSlice {
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+//Returns the hashes of all accounts a block has changed (or rolled back). These accounts need to be persisted.
+func getStateChangeAccounts(data blockData) (accHashes [][32]byte) {
+	//Accounts created by the block are listed in any case, after a rollback they are no longer part of the state.
+	for _, tx := range data.accTxSlice {
+		accHashes = append(accHashes, protocol.SerializeHashContent(tx.PubKey))
+	}
+
+	//A changed staking minimum may remove any account from the validator set.
+	for _, tx := range data.configTxSlice {
+		if tx.Id == protocol.STAKING_MINIMUM_ID {
+			return append(accHashes, getAllAccounts()...)
+		}
+	}
+
+	for _, tx := range data.fundsTxSlice {
+		accHashes = append(accHashes, tx.From, tx.To)
+	}
+
+	for _, tx := range data.stakeTxSlice {
+		accHashes = append(accHashes, tx.Account)
+	}
+
+	for _, tx := range data.batchTxSlice {
+		accHashes = append(accHashes, tx.From)
+		for _, payment := range tx.Payments {
+			accHashes = append(accHashes, payment.To)
+		}
+	}
+
+	for _, tx := range data.keyTxSlice {
+		accHashes = append(accHashes, tx.Account)
+	}
+
+	accHashes = append(accHashes, data.block.Beneficiary)
+	if data.block.SlashedAddress != [32]byte{} {
+		accHashes = append(accHashes, data.block.SlashedAddress)
+	}
+
+	return accHashes
+}
+
+func getAllAccounts() (accHashes [][32]byte) {
+	for accHash := range storage.State {
+		accHashes = append(accHashes, accHash)
+	}
+
+	return accHashes
+}
+
 func accStateChange(txSlice []*protocol.AccTx) error {
 	for _, tx := range txSlice {
-		if tx.Header != 2 {
+		if tx.BaseHeader() != 2 {
 			newAcc := protocol.NewAccount(tx.PubKey, tx.Issuer, 0, false, [crypto.COMM_KEY_LENGTH]byte{}, tx.Contract, tx.ContractVariables)
+			if tx.BaseHeader() == protocol.ACCTX_MULTISIG_HEADER {
+				newAcc.MultiSigKeys = tx.MultiSigKeys
+				newAcc.MultiSigThreshold = tx.MultiSigThreshold
+			}
+			newAcc.Sig2Required = tx.Header&protocol.ACCTX_SIG2_HEADER != 0
 			newAccHash := newAcc.Hash()
 
 			acc, _ := storage.GetAccount(newAccHash)
@@ -210,13 +401,13 @@ func accStateChange(txSlice []*protocol.AccTx) error {
 			//If acc does not exist, write to state
 			storage.State[newAccHash] = &newAcc
 
-			if tx.Header == 1 {
+			if tx.BaseHeader() == 1 {
 				//First bit set, given account will be a new root account
 				//It might be cleaner to move this to the storage package (e.g., storage.Delete(...))
 				//leave it here for now (not fully convinced yet)
 				storage.RootKeys[newAccHash] = &newAcc
 			}
-		} else if tx.Header == 2 {
+		} else if tx.BaseHeader() == 2 {
 			accHash := protocol.SerializeHashContent(tx.PubKey)
 			_, err := storage.GetAccount(accHash)
 			if err != nil {
@@ -231,16 +422,22 @@ func accStateChange(txSlice []*protocol.AccTx) error {
 	return nil
 }
 
-func fundsStateChange(txSlice []*protocol.FundsTx) (err error) {
-	for _, tx := range txSlice {
+//The changes of contract calls are recorded in the contract diff, a nil diff does not record them. The locks of the
+//txs are checked against the given previous block. If one of the txs fails, the previously applied fundsTxs are
+//returned so that the caller can roll them back.
+func fundsStateChange(txSlice []*protocol.FundsTx, contractDiff *protocol.ContractDiff, prevBlock *protocol.Block) (applied []*protocol.FundsTx, err error) {
+	//Gas of the contract calls of the block
+	var blockGas uint64
+
+	for cnt, tx := range txSlice {
 		var rootAcc *protocol.Account
 		//Check if we have to issue new coins (in case a root account signed the tx)
 		if rootAcc, err = storage.GetRootAccount(tx.From); err != nil {
-			return err
+			return txSlice[:cnt], err
 		}
 
 		if rootAcc != nil && rootAcc.Balance+tx.Amount+tx.Fee > MAX_MONEY {
-			return errors.New("Transaction amount would lead to balance overflow at the receiver (root) account.")
+			return txSlice[:cnt], errors.New("Transaction amount would lead to balance overflow at the receiver (root) account.")
 		}
 
 		//Will not be reached if errors occured
@@ -258,6 +455,11 @@ func fundsStateChange(txSlice []*protocol.FundsTx) (err error) {
 			err = errors.New(fmt.Sprintf("Sender txCnt does not match: %v (tx.txCnt) vs. %v (state txCnt).", tx.TxCnt, accSender.TxCnt))
 		}
 
+		//Check the lock against the previous block
+		if isLockedTx(tx, prevBlock) {
+			err = errors.New(fmt.Sprintf("Transaction is locked until height %v and time %v.", tx.LockHeight, tx.LockTime))
+		}
+
 		//Check sender balance
 		if (tx.Amount + tx.Fee) > accSender.Balance {
 			err = errors.New(fmt.Sprintf("Sender does not have enough funds for the transaction: Balance = %v, Amount = %v, Fee = %v.", accSender.Balance, tx.Amount, tx.Fee))
@@ -268,11 +470,26 @@ func fundsStateChange(txSlice []*protocol.FundsTx) (err error) {
 			err = errors.New("Sender is staking and does not have enough funds in order to fulfill the required staking minimum.")
 		}
 
+		//A configTx may have changed the Sig2 requirement since the tx was verified.
+		if !verifySig2(accSender, tx.Hash(), tx.Sig2) {
+			err = errors.New("Sig2 is required but invalid.")
+		}
+
 		//Overflow protection
 		if tx.Amount+accReceiver.Balance > MAX_MONEY {
 			err = errors.New("Transaction amount would lead to balance overflow at the receiver account.")
 		}
 
+		//The contract runs on the balance before the transfer, the same way as when the tx was added to the block.
+		var call *protocol.ContractCallDiff
+		if err == nil && isContractCall(tx, accReceiver) {
+			if err = checkBlockGas(tx, blockGas); err == nil {
+				contractCall := execContract(tx, accReceiver)
+				call = &contractCall
+				blockGas += call.GasLimit
+			}
+		}
+
 		if err != nil {
 			if rootAcc != nil {
 				//Rollback root's credits if error occurs
@@ -280,16 +497,153 @@ func fundsStateChange(txSlice []*protocol.FundsTx) (err error) {
 				rootAcc.Balance -= tx.Fee
 			}
 
-			return err
+			return txSlice[:cnt], err
+		}
+
+		//The amount of a failed call is not transferred, coins issued for it are taken back.
+		amount := tx.Amount
+		if call != nil {
+			contractDiff.Add(*call)
+			if call.Failed {
+				amount = 0
+				if rootAcc != nil {
+					rootAcc.Balance -= tx.Amount
+				}
+			}
 		}
 
 		//We're manipulating pointer, no need to write back
 		accSender.TxCnt += 1
-		accSender.Balance -= tx.Amount
-		accReceiver.Balance += tx.Amount
+		accSender.Balance -= amount
+		accReceiver.Balance += amount
 	}
 
-	return nil
+	return txSlice, nil
+}
+
+//A batchTx is applied as a whole. If one of them fails, the previously applied batchTxs are returned so that the caller
+//can roll them back.
+func batchStateChange(txSlice []*protocol.BatchTx) (applied []*protocol.BatchTx, err error) {
+	for cnt, tx := range txSlice {
+		total := tx.TotalAmount()
+
+		var rootAcc, accSender *protocol.Account
+		if rootAcc, err = storage.GetRootAccount(tx.From); err != nil {
+			return txSlice[:cnt], err
+		}
+		if accSender, err = storage.GetAccount(tx.From); err != nil {
+			return txSlice[:cnt], err
+		}
+
+		//Root accounts issue new coins, the sender balance is checked as if they had been credited already.
+		available := accSender.Balance
+		if rootAcc != nil {
+			if rootAcc.Balance+total+tx.Fee > MAX_MONEY {
+				err = errors.New("Transaction amount would lead to balance overflow at the receiver (root) account.")
+			}
+			available += total + tx.Fee
+		}
+
+		//Check transaction counter
+		if tx.TxCnt != accSender.TxCnt {
+			err = errors.New(fmt.Sprintf("Sender txCnt does not match: %v (tx.txCnt) vs. %v (state txCnt).", tx.TxCnt, accSender.TxCnt))
+		}
+
+		//Check sender balance
+		if (total + tx.Fee) > available {
+			err = errors.New(fmt.Sprintf("Sender does not have enough funds for the transaction: Balance = %v, Amount = %v, Fee = %v.", accSender.Balance, total, tx.Fee))
+		}
+
+		//After Tx fees, account must still have more than the minimum staking amount
+		if accSender.IsStaking && ((tx.Fee + protocol.MIN_STAKING_MINIMUM + total) > available) {
+			err = errors.New("Sender is staking and does not have enough funds in order to fulfill the required staking minimum.")
+		}
+
+		//A configTx may have changed the Sig2 requirement since the tx was verified.
+		if !verifySig2(accSender, tx.Hash(), tx.Sig2) {
+			err = errors.New("Sig2 is required but invalid.")
+		}
+
+		//Overflow protection, a receiver may be paid several times.
+		received := make(map[[32]byte]uint64)
+		for _, payment := range tx.Payments {
+			accReceiver, accErr := storage.GetAccount(payment.To)
+			if accErr != nil {
+				err = accErr
+				break
+			}
+
+			received[payment.To] += payment.Amount
+			if received[payment.To]+accReceiver.Balance > MAX_MONEY {
+				err = errors.New("Transaction amount would lead to balance overflow at the receiver account.")
+			}
+		}
+
+		if err != nil {
+			return txSlice[:cnt], err
+		}
+
+		//We're manipulating pointer, no need to write back
+		if rootAcc != nil {
+			rootAcc.Balance += total
+			rootAcc.Balance += tx.Fee
+		}
+
+		accSender.TxCnt += 1
+		accSender.Balance -= total
+		for _, payment := range tx.Payments {
+			accReceiver, _ := storage.GetAccount(payment.To)
+			accReceiver.Balance += payment.Amount
+		}
+	}
+
+	return txSlice, nil
+}
+
+//The signing key of an account is replaced, its address and hence its hash stay the same. If one of the keyTxs fails,
+//the previously applied keyTxs are returned so that the caller can roll them back.
+func keyStateChange(txSlice []*protocol.KeyTx) (applied []*protocol.KeyTx, err error) {
+	for cnt, tx := range txSlice {
+		var acc *protocol.Account
+		if acc, err = storage.GetAccount(tx.Account); err != nil {
+			return txSlice[:cnt], err
+		}
+
+		//Check transaction counter
+		if tx.TxCnt != acc.TxCnt {
+			err = errors.New(fmt.Sprintf("Sender txCnt does not match: %v (tx.txCnt) vs. %v (state txCnt).", tx.TxCnt, acc.TxCnt))
+		}
+
+		//Check the key that is replaced
+		if tx.OldKey != acc.PubKey() {
+			err = errors.New(fmt.Sprintf("Old key does not match the signing key of the account: %x.", tx.OldKey[0:8]))
+		}
+
+		//Check sender balance
+		if tx.Fee > acc.Balance {
+			err = errors.New(fmt.Sprintf("Sender does not have enough funds for the transaction: Balance = %v, Amount = %v, Fee = %v.", acc.Balance, 0, tx.Fee))
+		}
+
+		//After Tx fees, account must still have more than the minimum staking amount
+		if acc.IsStaking && (tx.Fee+protocol.MIN_STAKING_MINIMUM) > acc.Balance {
+			err = errors.New("Sender is staking and does not have enough funds in order to fulfill the required staking minimum.")
+		}
+
+		//A configTx may have changed the Sig2 requirement since the tx was verified.
+		if !verifySig2(acc, tx.Hash(), tx.Sig2) {
+			err = errors.New("Sig2 is required but invalid.")
+		}
+
+		if err != nil {
+			return txSlice[:cnt], err
+		}
+
+		//We're manipulating pointer, no need to write back
+		acc.TxCnt += 1
+		acc.SetPubKey(tx.NewKey)
+	}
+
+	return txSlice, nil
 }
 
 //We accept config slices with unknown id, but don't act on the payload. This is in case we have not updated to a new
@@ -345,11 +699,13 @@ func stakeStateChange(txSlice []*protocol.StakeTx, height uint32) (err error) {
 	return nil
 }
 
-func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsTx, configTxSlice []*protocol.ConfigTx, stakeTxSlice []*protocol.StakeTx, minerHash [32]byte) (err error) {
+func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsTx, configTxSlice []*protocol.ConfigTx, stakeTxSlice []*protocol.StakeTx, batchTxSlice []*protocol.BatchTx, keyTxSlice []*protocol.KeyTx, minerHash [32]byte) (err error) {
 	var tmpAccTx []*protocol.AccTx
 	var tmpFundsTx []*protocol.FundsTx
 	var tmpConfigTx []*protocol.ConfigTx
 	var tmpStakeTx []*protocol.StakeTx
+	var tmpBatchTx []*protocol.BatchTx
+	var tmpKeyTx []*protocol.KeyTx
 
 	minerAcc, err := storage.GetAccount(minerHash)
 	if err != nil {
@@ -365,7 +721,7 @@ func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsT
 
 		if err != nil {
 			//Rollback of all perviously transferred transaction fees to the protocol's account
-			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, minerHash)
+			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, tmpBatchTx, tmpKeyTx, minerHash)
 			return err
 		}
 
@@ -385,7 +741,7 @@ func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsT
 
 		if err != nil {
 			//Rollback of all perviously transferred transaction fees to the protocol's account
-			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, minerHash)
+			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, tmpBatchTx, tmpKeyTx, minerHash)
 			return err
 		}
 
@@ -401,7 +757,7 @@ func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsT
 
 		if err != nil {
 			//Rollback of all perviously transferred transaction fees to the protocol's account
-			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, minerHash)
+			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, tmpBatchTx, tmpKeyTx, minerHash)
 			return err
 		}
 
@@ -419,7 +775,7 @@ func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsT
 
 		if err != nil {
 			//Rollback of all perviously transferred transaction fees to the protocol's account
-			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, minerHash)
+			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, tmpBatchTx, tmpKeyTx, minerHash)
 			return err
 		}
 
@@ -428,6 +784,42 @@ func collectTxFees(accTxSlice []*protocol.AccTx, fundsTxSlice []*protocol.FundsT
 		tmpStakeTx = append(tmpStakeTx, tx)
 	}
 
+	for _, tx := range batchTxSlice {
+		if minerAcc.Balance+tx.Fee > MAX_MONEY {
+			err = errors.New("Fee amount would lead to balance overflow at the miner account.")
+		} else {
+			senderAcc, err = storage.GetAccount(tx.From)
+		}
+
+		if err != nil {
+			//Rollback of all perviously transferred transaction fees to the protocol's account
+			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, tmpBatchTx, tmpKeyTx, minerHash)
+			return err
+		}
+
+		senderAcc.Balance -= tx.Fee
+		minerAcc.Balance += tx.Fee
+		tmpBatchTx = append(tmpBatchTx, tx)
+	}
+
+	for _, tx := range keyTxSlice {
+		if minerAcc.Balance+tx.Fee > MAX_MONEY {
+			err = errors.New("Fee amount would lead to balance overflow at the miner account.")
+		} else {
+			senderAcc, err = storage.GetAccount(tx.Account)
+		}
+
+		if err != nil {
+			//Rollback of all perviously transferred transaction fees to the protocol's account
+			collectTxFeesRollback(tmpAccTx, tmpFundsTx, tmpConfigTx, tmpStakeTx, tmpBatchTx, tmpKeyTx, minerHash)
+			return err
+		}
+
+		senderAcc.Balance -= tx.Fee
+		minerAcc.Balance += tx.Fee
+		tmpKeyTx = append(tmpKeyTx, tx)
+	}
+
 	return nil
 }
 
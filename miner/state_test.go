@@ -57,13 +57,13 @@ func TestFundsTxStateChange(t *testing.T) {
 		}
 	}
 
-	fundsStateChange(funds)
+	fundsStateChange(funds, nil, lastBlock)
 
 	if accA.Balance != balanceA || accB.Balance != balanceB {
 		t.Errorf("State update failed: %v != %v or %v != %v\n", accA.Balance, balanceA, accB.Balance, balanceB)
 	}
 
-	collectTxFees(nil, funds, nil, nil, minerAccHash)
+	collectTxFees(nil, funds, nil, nil, nil, nil, minerAccHash)
 	if feeA+feeB != validatorAcc.Balance-minerBal {
 		t.Error("Fee Collection failed!")
 	}
@@ -91,7 +91,7 @@ func TestAccountOverflow(t *testing.T) {
 		return
 	}
 	accSlice = append(accSlice, tx)
-	err = fundsStateChange(accSlice)
+	_, err = fundsStateChange(accSlice, nil, lastBlock)
 
 	//Err shouldn't be nil, because the tx can't have been successful
 	//Also, the balance of A shouldn't have changed
@@ -225,9 +225,9 @@ func TestConfigTxStateChangeUnknown(t *testing.T) {
 
 	//Issuing configTxs with unknown Id
 	var configs []*protocol.ConfigTx
-	tx, _ := protocol.ConstrConfigTx(uint8(rand.Uint32()%256), 11, 1000, rand.Uint64(), 0, PrivKeyRoot)
-	tx2, _ := protocol.ConstrConfigTx(uint8(rand.Uint32()%256), 11, 2000, rand.Uint64(), 0, PrivKeyRoot)
-	tx3, _ := protocol.ConstrConfigTx(uint8(rand.Uint32()%256), 11, 3000, rand.Uint64(), 0, PrivKeyRoot)
+	tx, _ := protocol.ConstrConfigTx(uint8(rand.Uint32()%256), 20, 1000, rand.Uint64(), 0, PrivKeyRoot)
+	tx2, _ := protocol.ConstrConfigTx(uint8(rand.Uint32()%256), 20, 2000, rand.Uint64(), 0, PrivKeyRoot)
+	tx3, _ := protocol.ConstrConfigTx(uint8(rand.Uint32()%256), 20, 3000, rand.Uint64(), 0, PrivKeyRoot)
 
 	//save parameter state
 	tmpParameter := parameterSlice[len(parameterSlice)-1]
@@ -309,3 +309,114 @@ func TestStakeTxStateChange(t *testing.T) {
 	}
 
 }
+
+//Tests whether the persisted state corresponds to the in-memory state after block validation and rollback
+func TestPersistedState(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+
+	b := newBlock(genesisBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	createBlockWithTxs(b)
+	if err := finalizeBlock(b); err != nil {
+		t.Errorf("Block finalization failed: %v\n", err)
+	}
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	state, rootKeys := storage.ReadState()
+	for _, accHash := range [][32]byte{accAHash, accBHash, b.Beneficiary} {
+		if state[accHash] == nil || !reflect.DeepEqual(*state[accHash], *storage.State[accHash]) {
+			t.Errorf("Persisted account does not correspond to the state: %v vs. %v\n", state[accHash], storage.State[accHash])
+		}
+	}
+	for _, txHash := range b.AccTxData {
+		accTx := storage.ReadClosedTx(txHash).(*protocol.AccTx)
+		if _, exists := state[protocol.SerializeHashContent(accTx.PubKey)]; !exists {
+			t.Errorf("Account created by accTx (%x) was not persisted.\n", txHash[0:8])
+		}
+	}
+	if storage.ReadLastClosedBlock().Hash != b.Hash {
+		t.Error("Last closed block does not correspond to the persisted state.")
+	}
+
+	if err := rollback(b); err != nil {
+		t.Errorf("Block rollback failed: %v\n", err)
+	}
+
+	state, _ = storage.ReadState()
+	if !reflect.DeepEqual(*state[accAHash], *storage.State[accAHash]) || !reflect.DeepEqual(*state[accBHash], *storage.State[accBHash]) {
+		t.Error("Persisted state was not rolled back.")
+	}
+	if len(state) > len(storage.State) {
+		t.Errorf("Accounts of rolled back accTxs are still persisted: %v vs. %v\n", len(state), len(storage.State))
+	}
+	if storage.ReadLastClosedBlock().Hash != genesisBlock.Hash {
+		t.Error("Last closed block was not rolled back.")
+	}
+	if len(rootKeys) > len(storage.RootKeys) {
+		t.Errorf("Persisted root keys do not correspond to the state: %v vs. %v\n", len(rootKeys), len(storage.RootKeys))
+	}
+}
+
+func TestRestoreStateFailure(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock(genesisBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	tx, _ := protocol.ConstrConfigTx(0, protocol.FEE_MINIMUM_ID, 2, 1, 0, PrivKeyRoot)
+	storage.WriteOpenTx(tx)
+	if err := addTx(b, tx); err != nil {
+		t.Errorf("Adding configTx failed: %v\n", err)
+	}
+	if err := finalizeBlock(b); err != nil {
+		t.Errorf("Block finalization failed: %v\n", err)
+	}
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	//Without the configTx the restore fails and must leave the parameters and statistics untouched for the replay.
+	storage.DeleteClosedTx(tx)
+	paramCnt, blockCnt := len(parameterSlice), globalBlockCount
+
+	if _, err := restoreState(storage.State, storage.RootKeys); err == nil {
+		t.Error("Restoring the state without the configTx of the block succeeded.")
+	}
+	if len(parameterSlice) != paramCnt || globalBlockCount != blockCnt {
+		t.Errorf("Failed restore changed the parameters or statistics: %v/%v vs. %v/%v\n", len(parameterSlice), globalBlockCount, paramCnt, blockCnt)
+	}
+}
+
+func TestGetAccountProof(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock(genesisBlock.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	createBlockWithTxs(b)
+	if err := finalizeBlock(b); err != nil {
+		t.Errorf("Block finalization failed: %v\n", err)
+	}
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	proof, err := GetAccountProof(b.Hash, accAHash)
+	if err != nil {
+		t.Fatalf("Account proof could not be built: %v\n", err)
+	}
+	if err := protocol.VerifyStateProof(b.StateRoot, accAHash, proof); err != nil {
+		t.Errorf("Account proof could not be verified: %v\n", err)
+	}
+	if proof.BlockHash != b.Hash || proof.Height != b.Height {
+		t.Errorf("Account proof refers to block (%x) at height %v instead of block (%x) at height %v.\n", proof.BlockHash[0:8], proof.Height, b.Hash[0:8], b.Height)
+	}
+	if proof.Account == storage.State[accAHash] {
+		t.Error("Account proof refers to the account of the state instead of a copy.")
+	}
+
+	if _, err := GetAccountProof(genesisBlock.Hash, accAHash); err == nil {
+		t.Error("Account proof was built for a block that is not the last closed block.")
+	}
+}
@@ -7,7 +7,8 @@ import (
 
 func accStateChangeRollback(txSlice []*protocol.AccTx) {
 	for _, tx := range txSlice {
-		if tx.Header == 0 || tx.Header == 1 || tx.Header == 2 {
+		header := tx.BaseHeader()
+		if header == 0 || header == 1 || header == 2 || header == protocol.ACCTX_MULTISIG_HEADER {
 			accHash := protocol.SerializeHashContent(tx.PubKey)
 
 			acc, err := storage.GetAccount(accHash)
@@ -17,7 +18,7 @@ func accStateChangeRollback(txSlice []*protocol.AccTx) {
 
 			delete(storage.State, accHash)
 
-			switch tx.Header {
+			switch header {
 			case 1:
 				delete(storage.RootKeys, accHash)
 			case 2:
@@ -27,7 +28,8 @@ func accStateChangeRollback(txSlice []*protocol.AccTx) {
 	}
 }
 
-func fundsStateChangeRollback(txSlice []*protocol.FundsTx) {
+//Contract calls are reverted with the changes recorded in the contract diff of the block.
+func fundsStateChangeRollback(txSlice []*protocol.FundsTx, contractDiff *protocol.ContractDiff) {
 	//Rollback in reverse order than original state change
 	for cnt := len(txSlice) - 1; cnt >= 0; cnt-- {
 		tx := txSlice[cnt]
@@ -35,18 +37,60 @@ func fundsStateChangeRollback(txSlice []*protocol.FundsTx) {
 		accSender, _ := storage.GetAccount(tx.From)
 		accReceiver, _ := storage.GetAccount(tx.To)
 
+		amount := tx.Amount
+		if call := contractDiff.PopCall(tx.Hash()); call != nil {
+			revertContract(call, accReceiver)
+			if call.Failed {
+				amount = 0
+			}
+		}
+
 		accSender.TxCnt -= 1
-		accSender.Balance += tx.Amount
-		accReceiver.Balance -= tx.Amount
+		accSender.Balance += amount
+		accReceiver.Balance -= amount
+
+		//If new coins were issued, revert
+		if rootAcc, _ := storage.GetRootAccount(tx.From); rootAcc != nil {
+			rootAcc.Balance -= amount
+			rootAcc.Balance -= tx.Fee
+		}
+	}
+}
+
+func batchStateChangeRollback(txSlice []*protocol.BatchTx) {
+	//Rollback in reverse order than original state change
+	for cnt := len(txSlice) - 1; cnt >= 0; cnt-- {
+		tx := txSlice[cnt]
+		total := tx.TotalAmount()
+
+		accSender, _ := storage.GetAccount(tx.From)
+		accSender.TxCnt -= 1
+		accSender.Balance += total
+
+		for _, payment := range tx.Payments {
+			accReceiver, _ := storage.GetAccount(payment.To)
+			accReceiver.Balance -= payment.Amount
+		}
 
 		//If new coins were issued, revert
 		if rootAcc, _ := storage.GetRootAccount(tx.From); rootAcc != nil {
-			rootAcc.Balance -= tx.Amount
+			rootAcc.Balance -= total
 			rootAcc.Balance -= tx.Fee
 		}
 	}
 }
 
+func keyStateChangeRollback(txSlice []*protocol.KeyTx) {
+	//Rollback in reverse order than original state change
+	for cnt := len(txSlice) - 1; cnt >= 0; cnt-- {
+		tx := txSlice[cnt]
+
+		acc, _ := storage.GetAccount(tx.Account)
+		acc.TxCnt -= 1
+		acc.SetPubKey(tx.OldKey)
+	}
+}
+
 func configStateChangeRollback(txSlice []*protocol.ConfigTx, blockHash [32]byte) {
 	if len(txSlice) == 0 {
 		return
@@ -76,7 +120,7 @@ func stakeStateChangeRollback(txSlice []*protocol.StakeTx) {
 	}
 }
 
-func collectTxFeesRollback(accTx []*protocol.AccTx, fundsTx []*protocol.FundsTx, configTx []*protocol.ConfigTx, stakeTx []*protocol.StakeTx, minerHash [32]byte) {
+func collectTxFeesRollback(accTx []*protocol.AccTx, fundsTx []*protocol.FundsTx, configTx []*protocol.ConfigTx, stakeTx []*protocol.StakeTx, batchTx []*protocol.BatchTx, keyTx []*protocol.KeyTx, minerHash [32]byte) {
 	minerAcc, _ := storage.GetAccount(minerHash)
 
 	//Subtract fees from sender (check if that is allowed has already been done in the block validation)
@@ -103,6 +147,20 @@ func collectTxFeesRollback(accTx []*protocol.AccTx, fundsTx []*protocol.FundsTx,
 		senderAcc, _ := storage.GetAccount(tx.Account)
 		senderAcc.Balance += tx.Fee
 	}
+
+	for _, tx := range batchTx {
+		minerAcc.Balance -= tx.Fee
+
+		senderAcc, _ := storage.GetAccount(tx.From)
+		senderAcc.Balance += tx.Fee
+	}
+
+	for _, tx := range keyTx {
+		minerAcc.Balance -= tx.Fee
+
+		senderAcc, _ := storage.GetAccount(tx.Account)
+		senderAcc.Balance += tx.Fee
+	}
 }
 
 func collectBlockRewardRollback(reward uint64, minerHash [32]byte) {
@@ -61,11 +61,11 @@ func TestFundsStateChangeRollback(t *testing.T) {
 			t.Errorf("Block rejected a valid transaction: %v\n", ftx2)
 		}
 	}
-	fundsStateChange(funds)
+	fundsStateChange(funds, nil, lastBlock)
 	if accA.Balance != balanceA || accB.Balance != balanceB {
 		t.Error("State update failed!")
 	}
-	fundsStateChangeRollback(funds)
+	fundsStateChangeRollback(funds, nil)
 	if accA.Balance != rollBackA || accB.Balance != rollBackB {
 		t.Error("Rollback failed!")
 	}
@@ -172,11 +172,11 @@ func TestCollectTxFeesRollback(t *testing.T) {
 		fee += tx.Fee
 	}
 
-	collectTxFees(nil, funds, nil, nil, minerHash)
+	collectTxFees(nil, funds, nil, nil, nil, nil, minerHash)
 	if minerBal+fee != validatorAcc.Balance {
 		t.Errorf("%v + %v != %v\n", minerBal, fee, validatorAcc.Balance)
 	}
-	collectTxFeesRollback(nil, funds, nil, nil, minerHash)
+	collectTxFeesRollback(nil, funds, nil, nil, nil, nil, minerHash)
 	if minerBal != validatorAcc.Balance {
 		t.Errorf("Tx fees rollback failed: %v != %v\n", minerBal, validatorAcc.Balance)
 	}
@@ -196,7 +196,7 @@ func TestCollectTxFeesRollback(t *testing.T) {
 	//Should throw an error and result in a rollback, because of acc balance overflow
 	tmpBlock := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
 	tmpBlock.Beneficiary = minerHash
-	data := blockData{nil, funds2, nil, nil, tmpBlock}
+	data := blockData{nil, funds2, nil, nil, nil, nil, tmpBlock, nil}
 	if err := validateState(data); err == nil ||
 		minerBal != validatorAcc.Balance ||
 		accA.Balance != accABal ||
@@ -204,3 +204,95 @@ func TestCollectTxFeesRollback(t *testing.T) {
 		t.Errorf("No rollback resulted, %v != %v\n", minerBal, validatorAcc.Balance)
 	}
 }
+
+func TestBatchStateChangeRollback(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	validatorHash := protocol.SerializeHashContent(validatorAcc.Address)
+
+	balanceA, balanceB, balanceValidator, txCntA := accA.Balance, accB.Balance, validatorAcc.Balance, accA.TxCnt
+
+	payments := []protocol.BatchPayment{{To: accBHash, Amount: 10}, {To: validatorHash, Amount: 20}, {To: accBHash, Amount: 30}}
+	tx, _ := protocol.ConstrBatchTx(0x01, 1, txCntA, accAHash, payments, 0, PrivKeyAccA, PrivKeyMultiSig)
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	if err := addTx(b, tx); err != nil {
+		t.Errorf("Block rejected a valid transaction: %v\n", err)
+	}
+
+	if _, err := batchStateChange([]*protocol.BatchTx{tx}); err != nil {
+		t.Errorf("BatchTx could not be applied: %v\n", err)
+	}
+	if accA.Balance != balanceA-60 || accB.Balance != balanceB+40 || validatorAcc.Balance != balanceValidator+20 || accA.TxCnt != txCntA+1 {
+		t.Error("State update failed!")
+	}
+
+	batchStateChangeRollback([]*protocol.BatchTx{tx})
+	if accA.Balance != balanceA || accB.Balance != balanceB || validatorAcc.Balance != balanceValidator || accA.TxCnt != txCntA {
+		t.Error("Rollback failed!")
+	}
+
+	//The second tx reuses the txCnt, only the first one has been applied and is rolled back.
+	replayTx, _ := protocol.ConstrBatchTx(0x01, 2, txCntA, accAHash, payments, 0, PrivKeyAccA, PrivKeyMultiSig)
+	applied, err := batchStateChange([]*protocol.BatchTx{tx, replayTx})
+	if err == nil || len(applied) != 1 {
+		t.Error("BatchTx with a reused txCnt has been applied.")
+	}
+	batchStateChangeRollback(applied)
+	if accA.Balance != balanceA || accB.Balance != balanceB || validatorAcc.Balance != balanceValidator || accA.TxCnt != txCntA {
+		t.Error("Failed batchStateChange has not been rolled back!")
+	}
+}
+
+func TestKeyStateChangeRollback(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	balanceA, txCntA, isStakingA := accA.Balance, accA.TxCnt, accA.IsStaking
+
+	//AccA hands over its account to the key of accB.
+	tx, _ := protocol.ConstrKeyTx(0x01, 1, txCntA, accAHash, accA.Address, accB.Address, PrivKeyAccA, PrivKeyMultiSig)
+	if !verify(tx) {
+		t.Error("KeyTx could not be verified.")
+	}
+
+	forgedTx, _ := protocol.ConstrKeyTx(0x01, 1, txCntA, accAHash, accA.Address, accB.Address, PrivKeyAccB, PrivKeyMultiSig)
+	if verify(forgedTx) {
+		t.Error("KeyTx signed with another key has been verified.")
+	}
+
+	if _, err := keyStateChange([]*protocol.KeyTx{tx}); err != nil {
+		t.Errorf("KeyTx could not be applied: %v\n", err)
+	}
+	if storage.State[accAHash] != accA || accA.PubKey() != accB.Address || accA.Balance != balanceA || accA.TxCnt != txCntA+1 || accA.IsStaking != isStakingA {
+		t.Error("State update failed!")
+	}
+
+	//Txs of accA have to be signed with the new key now.
+	fundsTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccB, PrivKeyMultiSig, nil)
+	if !verify(fundsTx) {
+		t.Error("FundsTx signed with the new key could not be verified.")
+	}
+	fundsTx, _ = protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	if verify(fundsTx) {
+		t.Error("FundsTx signed with the old key has been verified.")
+	}
+
+	keyStateChangeRollback([]*protocol.KeyTx{tx})
+	if accA.PubKey() != accA.Address || accA.SigningKey != [64]byte{} || accA.TxCnt != txCntA {
+		t.Error("Rollback failed!")
+	}
+
+	//The second tx reuses the txCnt, only the first one has been applied and is rolled back.
+	replayTx, _ := protocol.ConstrKeyTx(0x01, 2, txCntA, accAHash, accA.Address, accB.Address, PrivKeyAccA, PrivKeyMultiSig)
+	applied, err := keyStateChange([]*protocol.KeyTx{tx, replayTx})
+	if err == nil || len(applied) != 1 {
+		t.Error("KeyTx with a reused txCnt has been applied.")
+	}
+	keyStateChangeRollback(applied)
+	if accA.PubKey() != accA.Address || accA.TxCnt != txCntA {
+		t.Error("Failed keyStateChange has not been rolled back!")
+	}
+}
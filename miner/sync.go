@@ -0,0 +1,431 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bazo-blockchain/bazo-miner/p2p"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
+	"sync"
+	"time"
+)
+
+//Headers-first sync for nodes that join the network. Headers are fetched in ranges by height from several peers in
+//parallel and checked for their hashes and linkage. Afterwards, the bodies are downloaded and checked against the headers, while
+//the txs of the already downloaded bodies are fetched at the same time. All blocks are fully validated when the
+//state is built, this only makes sure that the download itself is fast. In particular, the PoS of the headers is not
+//checked during the sync, since it depends on the stake of the validators at that height. It is checked by validate.
+//Neither the blocks nor the txs are written to storage during the sync. The txs are kept in a staging area and are
+//only taken from there (and verified) when their block is validated.
+
+type syncTx struct {
+	hash    [32]byte
+	reqType uint8
+}
+
+var (
+	syncedTxs      = make(map[[32]byte]protocol.Transaction)
+	syncedTxsMutex = &sync.Mutex{}
+)
+
+// Returns all blocks of the chain in ascending order, starting with the genesis block.
+func syncBlocks() (blocks []*protocol.Block, err error) {
+	tip, err := syncTip()
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := syncHeaders(tip)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkHeaderChain(headers); err != nil {
+		return nil, err
+	}
+	logger.Printf("Synced %v headers up to height %v\n", len(headers), tip.Height)
+
+	//Txs are fetched while the next bodies are downloaded.
+	blocksToFetch := make(chan []*protocol.Block, len(headers)/SYNC_PARALLEL_REQS+1)
+	txsFetched := make(chan bool)
+	go syncTxs(blocksToFetch, txsFetched)
+
+	blocks, err = syncBodies(headers, blocksToFetch)
+	close(blocksToFetch)
+	<-txsFetched
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// Asks several peers for the last block. The last block reported by the majority of them is synced, if there is no
+// majority (e.g., because a new block has been added in the meantime), they are asked again.
+func syncTip() (*protocol.Block, error) {
+	for retry := 0; retry <= SYNC_RETRIES; retry++ {
+		sent, err := p2p.LastBlockReq(SYNC_TIP_PEERS)
+		if err != nil {
+			return nil, err
+		}
+
+		tips := make(map[[32]byte]*protocol.Block)
+		votes := make(map[[32]byte]int)
+	receive:
+		for received := 0; received < sent; received++ {
+			var block *protocol.Block
+			select {
+			case encodedBlock := <-p2p.BlockReqChan:
+				block = block.Decode(encodedBlock)
+			//Limit waiting time to BLOCKFETCH_TIMEOUT seconds before aborting.
+			case <-time.After(BLOCKFETCH_TIMEOUT * time.Second):
+				break receive
+			}
+
+			if block == nil || checkBlockHash(block) != nil {
+				continue
+			}
+			tips[block.Hash] = block
+			votes[block.Hash]++
+		}
+
+		for hash, cnt := range votes {
+			if cnt > sent/2 {
+				return tips[hash], nil
+			}
+		}
+		logger.Printf("%v peer(s) did not agree on the last block, asking again.\n", sent)
+	}
+
+	return nil, errors.New("Peers did not agree on the last block.")
+}
+
+// Fetches all headers up to the tip, in batches of SYNC_PARALLEL_REQS parallel requests. The headers need to link to
+// the tip, ranges that do not are requested again from other peers.
+func syncHeaders(tip *protocol.Block) (headers []*protocol.Block, err error) {
+	headers = make([]*protocol.Block, tip.Height+1)
+	headers[tip.Height] = tip
+	//The peer each header has been received from.
+	headerPeers := make([]string, tip.Height+1)
+	badPeers := make(map[string]bool)
+
+	var missing []uint32
+	for height := uint32(0); height < tip.Height; height += SYNC_HEADERS_RANGE {
+		missing = append(missing, height)
+	}
+
+	for retry := 0; len(missing) > 0 && retry <= SYNC_RETRIES; retry++ {
+		for start := 0; start < len(missing); start += SYNC_PARALLEL_REQS {
+			batch := missing[start:minInt(start+SYNC_PARALLEL_REQS, len(missing))]
+			for _, height := range batch {
+				if _, err = p2p.BlockHeadersReq(height, headersRangeLen(height, tip.Height), badPeers); err != nil {
+					return nil, err
+				}
+			}
+
+		receive:
+			for !headersComplete(headers, batch) {
+				select {
+				case res := <-p2p.BlockHeadersChan:
+					received := protocol.DecodeBlocks(res.Payload)
+					//Ranges that are not linked properly are dropped and requested again from other peers.
+					if checkHeaderChain(received) != nil {
+						badPeers[res.Peer] = true
+						continue
+					}
+					for _, header := range received {
+						if header.Height < tip.Height && headers[header.Height] == nil {
+							headers[header.Height] = header
+							headerPeers[header.Height] = res.Peer
+						}
+					}
+				case <-time.After(BLOCKFETCH_TIMEOUT * time.Second):
+					logger.Printf("Header sync timed out at height %v\n", batch[0])
+					break receive
+				}
+			}
+		}
+
+		dropUnlinkedHeaders(headers, headerPeers, badPeers)
+
+		var stillMissing []uint32
+		for _, height := range missing {
+			if !headersComplete(headers, []uint32{height}) {
+				stillMissing = append(stillMissing, height)
+			}
+		}
+		missing = stillMissing
+	}
+
+	if len(missing) > 0 {
+		return nil, errors.New(fmt.Sprintf("Could not fetch headers starting at heights %v.", missing))
+	}
+
+	return headers, nil
+}
+
+// Follows the headers from the tip down to the first header that does not link to its successor. The range of this
+// header is dropped and its peer is not asked again. Headers below cannot be checked until the range is fetched again.
+func dropUnlinkedHeaders(headers []*protocol.Block, headerPeers []string, badPeers map[string]bool) {
+	for height := len(headers) - 1; height > 0; height-- {
+		if headers[height-1] == nil {
+			return
+		}
+		if headers[height-1].Hash == headers[height].PrevHash {
+			continue
+		}
+
+		logger.Printf("Header (%x) does not link to the next header, requesting its range again.\n", headers[height-1].Hash[0:8])
+		badPeers[headerPeers[height-1]] = true
+
+		start := (height - 1) - (height-1)%SYNC_HEADERS_RANGE
+		for i := start; i < height; i++ {
+			headers[i] = nil
+		}
+		return
+	}
+}
+
+// Headers need to be ordered by height, match their hash and every header needs to link to the previous one. The PoS is
+// checked when the blocks are validated.
+func checkHeaderChain(headers []*protocol.Block) error {
+	for i, header := range headers {
+		if header == nil {
+			return errors.New("Header chain is incomplete.")
+		}
+		if err := checkBlockHash(header); err != nil {
+			return err
+		}
+		if i == 0 {
+			continue
+		}
+
+		prevHeader := headers[i-1]
+		if header.Height != prevHeader.Height+1 {
+			return errors.New(fmt.Sprintf("Header (%x) has height %v, expected %v.", header.Hash[0:8], header.Height, prevHeader.Height+1))
+		}
+		if header.PrevHash != prevHeader.Hash {
+			return errors.New(fmt.Sprintf("Header (%x) does not link to the previous header (%x).", header.Hash[0:8], prevHeader.Hash[0:8]))
+		}
+	}
+
+	return nil
+}
+
+// Fetches the bodies of all headers, verified bodies are passed on to fetch their txs.
+func syncBodies(headers []*protocol.Block, blocksToFetch chan<- []*protocol.Block) (blocks []*protocol.Block, err error) {
+	blocks = make([]*protocol.Block, len(headers))
+	//The last block has been fetched as a whole already.
+	blocks[len(headers)-1] = headers[len(headers)-1]
+	blocksToFetch <- blocks[len(headers)-1:]
+
+	for start := 0; start < len(headers)-1; start += SYNC_PARALLEL_REQS {
+		end := minInt(start+SYNC_PARALLEL_REQS, len(headers)-1)
+
+		for retry := 0; !blocksComplete(blocks[start:end]) && retry <= SYNC_RETRIES; retry++ {
+			pending := make(map[[32]byte]uint32)
+			for height := start; height < end; height++ {
+				if blocks[height] == nil {
+					pending[headers[height].Hash] = uint32(height)
+					if err = p2p.SyncBlockReq(headers[height].Hash); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+		receive:
+			for len(pending) > 0 {
+				var block *protocol.Block
+				select {
+				case encodedBlock := <-p2p.BlockReqChan:
+					block = block.Decode(encodedBlock)
+				case <-time.After(BLOCKFETCH_TIMEOUT * time.Second):
+					logger.Printf("Body sync timed out, %v bodies remaining\n", len(pending))
+					break receive
+				}
+
+				if block == nil {
+					continue
+				}
+				height, requested := pending[block.Hash]
+				if !requested || checkBody(headers[height], block) != nil {
+					continue
+				}
+
+				blocks[height] = block
+				delete(pending, block.Hash)
+			}
+		}
+
+		if !blocksComplete(blocks[start:end]) {
+			return nil, errors.New(fmt.Sprintf("Could not fetch the bodies between height %v and %v.", start, end))
+		}
+
+		blocksToFetch <- blocks[start:end]
+	}
+
+	return blocks, nil
+}
+
+// The body needs to match the header and the tx hashes need to correspond to the merkle root.
+func checkBody(header, block *protocol.Block) error {
+	if block.Hash != header.Hash || block.PrevHash != header.PrevHash || block.Height != header.Height {
+		return errors.New(fmt.Sprintf("Block (%x) does not match its header.", block.Hash[0:8]))
+	}
+	if err := checkBlockHash(block); err != nil {
+		return err
+	}
+
+	if block.MerkleRoot != header.MerkleRoot ||
+		protocol.BuildMerkleTree(block).MerkleRoot() != block.MerkleRoot {
+		return errors.New(fmt.Sprintf("Tx hashes of block (%x) do not match the merkle root.", block.Hash[0:8]))
+	}
+
+	return nil
+}
+
+// Fetches the txs of all blocks received on the channel and keeps them in the staging area. Txs that could not be
+// fetched are requested again when the blocks are validated.
+func syncTxs(blocksToFetch <-chan []*protocol.Block, done chan<- bool) {
+	for blocks := range blocksToFetch {
+		var txs []syncTx
+		for _, block := range blocks {
+			txs = append(txs, missingTxs(block.AccTxData, p2p.ACCTX_REQ)...)
+			txs = append(txs, missingTxs(block.FundsTxData, p2p.FUNDSTX_REQ)...)
+			txs = append(txs, missingTxs(block.ConfigTxData, p2p.CONFIGTX_REQ)...)
+			txs = append(txs, missingTxs(block.StakeTxData, p2p.STAKETX_REQ)...)
+			txs = append(txs, missingTxs(block.BatchTxData, p2p.BATCHTX_REQ)...)
+			txs = append(txs, missingTxs(block.KeyTxData, p2p.KEYTX_REQ)...)
+		}
+
+		for start := 0; start < len(txs); start += SYNC_PARALLEL_REQS {
+			if err := fetchSyncTxs(txs[start:minInt(start+SYNC_PARALLEL_REQS, len(txs))]); err != nil {
+				logger.Printf("Tx sync failed: %v\n", err)
+			}
+		}
+	}
+
+	done <- true
+}
+
+func missingTxs(txHashes [][32]byte, reqType uint8) (txs []syncTx) {
+	syncedTxsMutex.Lock()
+	defer syncedTxsMutex.Unlock()
+
+	for _, txHash := range txHashes {
+		if syncedTxs[txHash] == nil && storage.ReadClosedTx(txHash) == nil {
+			txs = append(txs, syncTx{txHash, reqType})
+		}
+	}
+
+	return txs
+}
+
+func fetchSyncTxs(txs []syncTx) error {
+	pending := make(map[[32]byte]bool)
+	for _, tx := range txs {
+		pending[tx.hash] = true
+		if err := p2p.SyncTxReq(tx.hash, tx.reqType); err != nil {
+			return err
+		}
+	}
+
+	for len(pending) > 0 {
+		var tx protocol.Transaction
+		select {
+		case accTx := <-p2p.AccTxChan:
+			tx = accTx
+		case fundsTx := <-p2p.FundsTxChan:
+			tx = fundsTx
+		case configTx := <-p2p.ConfigTxChan:
+			tx = configTx
+		case stakeTx := <-p2p.StakeTxChan:
+			tx = stakeTx
+		case batchTx := <-p2p.BatchTxChan:
+			tx = batchTx
+		case keyTx := <-p2p.KeyTxChan:
+			tx = keyTx
+		case <-time.After(TXFETCH_TIMEOUT * time.Second):
+			txFetchTimeouts.Inc("sync")
+			return errors.New(fmt.Sprintf("Fetching %v txs timed out.", len(pending)))
+		}
+
+		//Only txs that have been requested are accepted.
+		if pending[tx.Hash()] {
+			syncedTxsMutex.Lock()
+			syncedTxs[tx.Hash()] = tx
+			syncedTxsMutex.Unlock()
+			delete(pending, tx.Hash())
+		}
+	}
+
+	return nil
+}
+
+// Returns a synced tx if it can be verified against the current state. Txs that cannot be verified are fetched again.
+func readSyncedTx(txHash [32]byte) protocol.Transaction {
+	syncedTxsMutex.Lock()
+	tx := syncedTxs[txHash]
+	syncedTxsMutex.Unlock()
+
+	if tx == nil || !verify(tx) {
+		return nil
+	}
+
+	return tx
+}
+
+// The staging area is cleared once all synced blocks have been validated.
+func clearSyncedTxs() {
+	syncedTxsMutex.Lock()
+	defer syncedTxsMutex.Unlock()
+
+	syncedTxs = make(map[[32]byte]protocol.Transaction)
+}
+
+// The hash needs to be calculated over the header fields. The genesis block has no hash and is not validated either.
+func checkBlockHash(block *protocol.Block) error {
+	if block.Hash != [32]byte{} && blockHash(block) != block.Hash {
+		return errors.New(fmt.Sprintf("Block (%x) does not match its hash.", block.Hash[0:8]))
+	}
+
+	return nil
+}
+
+func headersRangeLen(height, lastHeight uint32) uint16 {
+	if lastHeight-height < SYNC_HEADERS_RANGE {
+		return uint16(lastHeight - height)
+	}
+
+	return SYNC_HEADERS_RANGE
+}
+
+func headersComplete(headers []*protocol.Block, heights []uint32) bool {
+	lastHeight := uint32(len(headers) - 1)
+	for _, height := range heights {
+		for i := height; i < height+uint32(headersRangeLen(height, lastHeight)); i++ {
+			if headers[i] == nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func blocksComplete(blocks []*protocol.Block) bool {
+	for _, block := range blocks {
+		if block == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,116 @@
+package miner
+
+import (
+	"github.com/bazo-blockchain/bazo-miner/crypto"
+	"testing"
+
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+//Headers need to link to each other
+func TestCheckHeaderChain(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	createBlockWithTxs(b)
+	finalizeBlock(b)
+	if err := validate(b, false); err != nil {
+		t.Errorf("Block validation failed: %v\n", err)
+	}
+
+	b2 := newBlock(b.Hash, [crypto.COMM_PROOF_LENGTH]byte{}, 2)
+	createBlockWithTxs(b2)
+	finalizeBlock(b2)
+
+	if err := checkHeaderChain([]*protocol.Block{b, b2}); err != nil {
+		t.Errorf("Linked headers got rejected: %v\n", err)
+	}
+	if err := checkHeaderChain([]*protocol.Block{b2, b}); err == nil {
+		t.Error("Headers in the wrong order got accepted.\n")
+	}
+
+	b3 := newBlock([32]byte{'0'}, [crypto.COMM_PROOF_LENGTH]byte{}, 3)
+	if err := checkHeaderChain([]*protocol.Block{b, b2, b3}); err == nil {
+		t.Error("Header that does not link to the previous one got accepted.\n")
+	}
+	if err := checkHeaderChain([]*protocol.Block{b, nil, b2}); err == nil {
+		t.Error("Incomplete headers got accepted.\n")
+	}
+
+	tampered := *b2
+	tampered.StateRoot = [32]byte{'0'}
+	if err := checkHeaderChain([]*protocol.Block{b, &tampered}); err == nil {
+		t.Error("Header that does not match its hash got accepted.\n")
+	}
+}
+
+//Bodies need to match the header and the merkle root
+func TestCheckBody(t *testing.T) {
+	cleanAndPrepare()
+
+	b := newBlock([32]byte{}, [crypto.COMM_PROOF_LENGTH]byte{}, 1)
+	createBlockWithTxs(b)
+	finalizeBlock(b)
+
+	header := *b
+	header.AccTxData, header.FundsTxData, header.ConfigTxData, header.StakeTxData = nil, nil, nil, nil
+
+	if err := checkBody(&header, b); err != nil {
+		t.Errorf("Valid body got rejected: %v\n", err)
+	}
+
+	body := *b
+	body.FundsTxData = append([][32]byte{{'0'}}, body.FundsTxData...)
+	if err := checkBody(&header, &body); err == nil {
+		t.Error("Body with tx hashes that do not match the merkle root got accepted.\n")
+	}
+
+	body = *b
+	body.Height++
+	if err := checkBody(&header, &body); err == nil {
+		t.Error("Body that does not match the header got accepted.\n")
+	}
+
+	body = *b
+	body.Beneficiary = [32]byte{'0'}
+	if err := checkBody(&header, &body); err == nil {
+		t.Error("Body that does not match its hash got accepted.\n")
+	}
+}
+
+//The range of a header that does not link to the tip is dropped and its peer is not asked again
+func TestDropUnlinkedHeaders(t *testing.T) {
+	headers := make([]*protocol.Block, 5)
+	headerPeers := make([]string, 5)
+	for height := range headers {
+		headers[height] = &protocol.Block{Hash: [32]byte{byte(height + 1)}, Height: uint32(height)}
+		if height > 0 {
+			headers[height].PrevHash = headers[height-1].Hash
+		}
+		headerPeers[height] = "good"
+	}
+
+	badPeers := make(map[string]bool)
+	dropUnlinkedHeaders(headers, headerPeers, badPeers)
+	for height, header := range headers {
+		if header == nil {
+			t.Errorf("Linked header at height %v got dropped.\n", height)
+		}
+	}
+	if len(badPeers) > 0 {
+		t.Errorf("Peers of linked headers are excluded: %v\n", badPeers)
+	}
+
+	headers[1] = &protocol.Block{Hash: [32]byte{'0'}, Height: 1}
+	headerPeers[1] = "bad"
+	dropUnlinkedHeaders(headers, headerPeers, badPeers)
+	if headers[0] != nil || headers[1] != nil {
+		t.Error("Range of the header that does not link to the tip was not dropped.\n")
+	}
+	if headers[2] == nil || headers[4] == nil {
+		t.Error("Headers linked to the tip got dropped.\n")
+	}
+	if !badPeers["bad"] || badPeers["good"] {
+		t.Errorf("Wrong peers are excluded: %v\n", badPeers)
+	}
+}
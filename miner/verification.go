@@ -26,6 +26,10 @@ func verify(tx protocol.Transaction) bool {
 		verified = verifyConfigTx(tx.(*protocol.ConfigTx))
 	case *protocol.StakeTx:
 		verified = verifyStakeTx(tx.(*protocol.StakeTx))
+	case *protocol.BatchTx:
+		verified = verifyBatchTx(tx.(*protocol.BatchTx))
+	case *protocol.KeyTx:
+		verified = verifyKeyTx(tx.(*protocol.KeyTx))
 	}
 
 	return verified
@@ -45,6 +49,12 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 		return false
 	}
 
+	//The gas limit of a contract call is covered by the fee, which is charged as a whole.
+	if tx.GasLimit > tx.Fee {
+		logger.Printf("Gas limit exceeds the fee: %v (gas limit) vs. %v (fee)\n", tx.GasLimit, tx.Fee)
+		return false
+	}
+
 	//Check if accounts are present in the actual state
 	accFrom := storage.State[tx.From]
 	accTo := storage.State[tx.To]
@@ -58,8 +68,10 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 	accFromHash := protocol.SerializeHashContent(accFrom.Address)
 	accToHash := protocol.SerializeHashContent(accTo.Address)
 
-	pubKey1Sig1.SetBytes(accFrom.Address[:32])
-	pubKey2Sig1.SetBytes(accFrom.Address[32:])
+	//The account may have rotated its signing key with a keyTx.
+	signingKey := accFrom.PubKey()
+	pubKey1Sig1.SetBytes(signingKey[:32])
+	pubKey2Sig1.SetBytes(signingKey[32:])
 
 	r.SetBytes(tx.Sig1[:32])
 	s.SetBytes(tx.Sig1[32:])
@@ -71,8 +83,15 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 
 	var validSig1, validSig2 bool
 
-	pubKey := ecdsa.PublicKey{elliptic.P256(), pubKey1Sig1, pubKey2Sig1}
-	if ecdsa.Verify(&pubKey, txHash[:], r, s) && !reflect.DeepEqual(accFrom, accTo) {
+	//Spends of a multisig account are signed with the keys of the account instead of Sig1.
+	if accFrom.IsMultiSig() {
+		validSig1 = verifyMultiSigs(accFrom, txHash, tx.MultiSigs)
+	} else {
+		pubKey := ecdsa.PublicKey{elliptic.P256(), pubKey1Sig1, pubKey2Sig1}
+		validSig1 = len(tx.MultiSigs) == 0 && ecdsa.Verify(&pubKey, txHash[:], r, s)
+	}
+
+	if validSig1 && !reflect.DeepEqual(accFrom, accTo) {
 		tx.From = accFromHash
 		tx.To = accToHash
 		validSig1 = true
@@ -81,10 +100,7 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 		return false
 	}
 
-	r.SetBytes(tx.Sig2[:32])
-	s.SetBytes(tx.Sig2[32:])
-
-	if ecdsa.Verify(multisigPubKey, txHash[:], r, s) {
+	if verifySig2(accFrom, txHash, tx.Sig2) {
 		validSig2 = true
 	} else {
 		logger.Printf("Sig2 invalid. FromHash: %x\nToHash: %x\n", accFromHash[0:8], accToHash[0:8])
@@ -94,11 +110,219 @@ func verifyFundsTx(tx *protocol.FundsTx) bool {
 	return validSig1 && validSig2
 }
 
+func verifyBatchTx(tx *protocol.BatchTx) bool {
+	if tx == nil {
+		return false
+	}
+
+	if len(tx.Payments) == 0 || len(tx.Payments) > protocol.MAX_BATCHTX_PAYMENTS {
+		logger.Printf("Invalid number of payments: %v\n", len(tx.Payments))
+		return false
+	}
+
+	//Every payment only makes sense if amount > 0, the total must not overflow either.
+	var total uint64
+	for _, payment := range tx.Payments {
+		if payment.Amount == 0 || payment.Amount > MAX_MONEY || total+payment.Amount > MAX_MONEY {
+			logger.Printf("Invalid payment amount: %v\n", payment.Amount)
+			return false
+		}
+		total += payment.Amount
+	}
+
+	accFrom := storage.State[tx.From]
+	if accFrom == nil {
+		logger.Printf("Sender account non existent: %x\n", tx.From[0:8])
+		return false
+	}
+
+	for _, payment := range tx.Payments {
+		if storage.State[payment.To] == nil || payment.To == tx.From {
+			logger.Printf("Invalid receiver account: %x\n", payment.To[0:8])
+			return false
+		}
+	}
+
+	pubKey1Sig1, pubKey2Sig1 := new(big.Int), new(big.Int)
+	r, s := new(big.Int), new(big.Int)
+
+	signingKey := accFrom.PubKey()
+	pubKey1Sig1.SetBytes(signingKey[:32])
+	pubKey2Sig1.SetBytes(signingKey[32:])
+
+	r.SetBytes(tx.Sig1[:32])
+	s.SetBytes(tx.Sig1[32:])
+
+	txHash := tx.Hash()
+
+	//Spends of a multisig account are signed with the keys of the account instead of Sig1.
+	var validSig1 bool
+	if accFrom.IsMultiSig() {
+		validSig1 = verifyMultiSigs(accFrom, txHash, tx.MultiSigs)
+	} else {
+		pubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: pubKey1Sig1, Y: pubKey2Sig1}
+		validSig1 = len(tx.MultiSigs) == 0 && ecdsa.Verify(&pubKey, txHash[:], r, s)
+	}
+
+	if !validSig1 {
+		logger.Printf("Sig1 invalid. FromHash: %x\n", tx.From[0:8])
+		return false
+	}
+
+	if !verifySig2(accFrom, txHash, tx.Sig2) {
+		logger.Printf("Sig2 invalid. FromHash: %x\n", tx.From[0:8])
+		return false
+	}
+
+	return true
+}
+
+//A keyTx is signed with the current signing key of the account. The new key has to be a valid key other than the
+//current one. Multisig accounts have no signing key of their own and can therefore not rotate it.
+func verifyKeyTx(tx *protocol.KeyTx) bool {
+	if tx == nil {
+		return false
+	}
+
+	acc := storage.State[tx.Account]
+	if acc == nil {
+		logger.Printf("Account non existent: %x\n", tx.Account[0:8])
+		return false
+	}
+
+	if acc.IsMultiSig() {
+		logger.Printf("Multisig account cannot rotate its key: %x\n", tx.Account[0:8])
+		return false
+	}
+
+	pub1, pub2 := new(big.Int), new(big.Int)
+	pub1.SetBytes(tx.NewKey[:32])
+	pub2.SetBytes(tx.NewKey[32:])
+
+	if tx.NewKey == tx.OldKey || !elliptic.P256().IsOnCurve(pub1, pub2) {
+		logger.Printf("Invalid new key: %x\n", tx.NewKey[0:8])
+		return false
+	}
+
+	if tx.OldKey != acc.PubKey() {
+		logger.Printf("Old key does not match the signing key of the account: %x\n", tx.OldKey[0:8])
+		return false
+	}
+
+	r, s := new(big.Int), new(big.Int)
+	pub1.SetBytes(tx.OldKey[:32])
+	pub2.SetBytes(tx.OldKey[32:])
+
+	r.SetBytes(tx.Sig[:32])
+	s.SetBytes(tx.Sig[32:])
+
+	txHash := tx.Hash()
+
+	pubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: pub1, Y: pub2}
+	if !ecdsa.Verify(&pubKey, txHash[:], r, s) {
+		logger.Printf("Sig invalid. Account: %x\n", tx.Account[0:8])
+		return false
+	}
+
+	//A key rotation needs the co-signature the same way as the other txs of the account.
+	if !verifySig2(acc, txHash, tx.Sig2) {
+		logger.Printf("Sig2 invalid. Account: %x\n", tx.Account[0:8])
+		return false
+	}
+
+	return true
+}
+
+//The co-signature of the multisig server (Sig2) is only checked if the system parameter or the sender account
+//requires it. Without a multisig server, it cannot be required.
+func verifySig2(accFrom *protocol.Account, txHash [32]byte, sig2 [64]byte) bool {
+	if activeParameters.Multisig_required == 0 && !accFrom.Sig2Required {
+		return true
+	}
+
+	if multisigPubKey == nil {
+		return false
+	}
+
+	r, s := new(big.Int), new(big.Int)
+	r.SetBytes(sig2[:32])
+	s.SetBytes(sig2[32:])
+
+	return ecdsa.Verify(multisigPubKey, txHash[:], r, s)
+}
+
+//A multisig spend needs valid signatures of at least MultiSigThreshold distinct keys of the account.
+func verifyMultiSigs(acc *protocol.Account, txHash [32]byte, sigs [][64]byte) bool {
+	if len(sigs) > len(acc.MultiSigKeys) {
+		return false
+	}
+
+	signers := make(map[int]bool)
+	r, s := new(big.Int), new(big.Int)
+	pub1, pub2 := new(big.Int), new(big.Int)
+
+	for _, sig := range sigs {
+		r.SetBytes(sig[:32])
+		s.SetBytes(sig[32:])
+
+		for i, key := range acc.MultiSigKeys {
+			if signers[i] {
+				continue
+			}
+
+			pub1.SetBytes(key[:32])
+			pub2.SetBytes(key[32:])
+
+			pubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: pub1, Y: pub2}
+			if ecdsa.Verify(&pubKey, txHash[:], r, s) {
+				signers[i] = true
+				break
+			}
+		}
+	}
+
+	return len(signers) >= int(acc.MultiSigThreshold)
+}
+
+//A multisig account needs a threshold 1 <= M <= N and N <= MAX_MULTISIG_KEYS distinct keys. Its address has to be
+//derived from them, so it cannot be used as a key on its own.
+func verifyMultiSigAccTx(tx *protocol.AccTx) bool {
+	if tx.BaseHeader() != protocol.ACCTX_MULTISIG_HEADER || tx.MultiSigThreshold == 0 ||
+		int(tx.MultiSigThreshold) > len(tx.MultiSigKeys) || len(tx.MultiSigKeys) > protocol.MAX_MULTISIG_KEYS {
+		logger.Printf("Invalid multisig threshold: %v of %v\n", tx.MultiSigThreshold, len(tx.MultiSigKeys))
+		return false
+	}
+
+	keys := make(map[[64]byte]bool)
+	pub1, pub2 := new(big.Int), new(big.Int)
+	for _, key := range tx.MultiSigKeys {
+		pub1.SetBytes(key[:32])
+		pub2.SetBytes(key[32:])
+
+		if keys[key] || !elliptic.P256().IsOnCurve(pub1, pub2) {
+			logger.Printf("Invalid multisig key: %x\n", key[0:8])
+			return false
+		}
+		keys[key] = true
+	}
+
+	if tx.PubKey != protocol.MultiSigAddress(tx.MultiSigKeys, tx.MultiSigThreshold) {
+		logger.Printf("Multisig address does not match the keys: %x\n", tx.PubKey[0:8])
+		return false
+	}
+
+	return true
+}
+
 func verifyAccTx(tx *protocol.AccTx) bool {
 	if tx == nil {
 		return false
 	}
 
+	if (tx.BaseHeader() == protocol.ACCTX_MULTISIG_HEADER || tx.IsMultiSig()) && !verifyMultiSigAccTx(tx) {
+		return false
+	}
+
 	r, s := new(big.Int), new(big.Int)
 	pub1, pub2 := new(big.Int), new(big.Int)
 
@@ -106,8 +330,9 @@ func verifyAccTx(tx *protocol.AccTx) bool {
 	s.SetBytes(tx.Sig[32:])
 
 	for _, rootAcc := range storage.RootKeys {
-		pub1.SetBytes(rootAcc.Address[:32])
-		pub2.SetBytes(rootAcc.Address[32:])
+		signingKey := rootAcc.PubKey()
+		pub1.SetBytes(signingKey[:32])
+		pub2.SetBytes(signingKey[32:])
 
 		pubKey := ecdsa.PublicKey{elliptic.P256(), pub1, pub2}
 		txHash := tx.Hash()
@@ -134,8 +359,9 @@ func verifyConfigTx(tx *protocol.ConfigTx) bool {
 	s.SetBytes(tx.Sig[32:])
 
 	for _, rootAcc := range storage.RootKeys {
-		pub1.SetBytes(rootAcc.Address[:32])
-		pub2.SetBytes(rootAcc.Address[32:])
+		signingKey := rootAcc.PubKey()
+		pub1.SetBytes(signingKey[:32])
+		pub2.SetBytes(signingKey[32:])
 
 		pubKey := ecdsa.PublicKey{elliptic.P256(), pub1, pub2}
 		txHash := tx.Hash()
@@ -167,8 +393,9 @@ func verifyStakeTx(tx *protocol.StakeTx) bool {
 	pub1, pub2 := new(big.Int), new(big.Int)
 	r, s := new(big.Int), new(big.Int)
 
-	pub1.SetBytes(accFrom.Address[:32])
-	pub2.SetBytes(accFrom.Address[32:])
+	signingKey := accFrom.PubKey()
+	pub1.SetBytes(signingKey[:32])
+	pub2.SetBytes(signingKey[32:])
 
 	r.SetBytes(tx.Sig[:32])
 	s.SetBytes(tx.Sig[32:])
@@ -226,6 +453,14 @@ func parameterBoundsChecking(id uint8, payload uint64) bool {
 		if payload >= protocol.MIN_SLASHING_REWARD && payload <= protocol.MAX_SLASHING_REWARD {
 			return true
 		}
+	case protocol.MULTISIG_REQUIRED_ID:
+		if payload >= protocol.MIN_MULTISIG_REQUIRED && payload <= protocol.MAX_MULTISIG_REQUIRED {
+			return true
+		}
+	case protocol.BLOCK_GAS_LIMIT_ID:
+		if payload >= protocol.MIN_BLOCK_GAS_LIMIT && payload <= protocol.MAX_BLOCK_GAS_LIMIT {
+			return true
+		}
 	}
 
 	return false
@@ -1,11 +1,16 @@
 package miner
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/bazo-blockchain/bazo-miner/crypto"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
 )
 
 func TestFundsTxVerification(t *testing.T) {
@@ -58,3 +63,143 @@ func TestConfigTx(t *testing.T) {
 		t.Error("ConfigTx verification malfunctioning!")
 	}
 }
+
+func TestBatchTxVerification(t *testing.T) {
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	validatorHash := protocol.SerializeHashContent(validatorAcc.Address)
+
+	payments := []protocol.BatchPayment{{To: accBHash, Amount: 10}, {To: validatorHash, Amount: 20}, {To: accBHash, Amount: 30}}
+	tx, _ := protocol.ConstrBatchTx(0x01, 1, 0, accAHash, payments, 0, PrivKeyAccA, PrivKeyMultiSig)
+	if !verifyBatchTx(tx) {
+		t.Errorf("BatchTx could not be verified: \n%v", tx)
+	}
+
+	forgedTx, _ := protocol.ConstrBatchTx(0x01, 1, 0, accAHash, payments, 0, PrivKeyAccB, PrivKeyMultiSig)
+	emptyTx, _ := protocol.ConstrBatchTx(0x01, 1, 0, accAHash, nil, 0, PrivKeyAccA, PrivKeyMultiSig)
+	zeroTx, _ := protocol.ConstrBatchTx(0x01, 1, 0, accAHash, []protocol.BatchPayment{{To: accBHash, Amount: 0}}, 0, PrivKeyAccA, PrivKeyMultiSig)
+	selfTx, _ := protocol.ConstrBatchTx(0x01, 1, 0, accAHash, []protocol.BatchPayment{{To: accAHash, Amount: 10}}, 0, PrivKeyAccA, PrivKeyMultiSig)
+	overflowTx, _ := protocol.ConstrBatchTx(0x01, 1, 0, accAHash, []protocol.BatchPayment{{To: accBHash, Amount: MAX_MONEY}, {To: validatorHash, Amount: 1}}, 0, PrivKeyAccA, PrivKeyMultiSig)
+
+	for _, invalidTx := range []*protocol.BatchTx{forgedTx, emptyTx, zeroTx, selfTx, overflowTx} {
+		if verifyBatchTx(invalidTx) {
+			t.Errorf("Invalid BatchTx has been verified: \n%v", invalidTx)
+		}
+	}
+}
+
+func TestMultiSigFundsTxVerification(t *testing.T) {
+	cleanAndPrepare()
+
+	keys := []*ecdsa.PrivateKey{PrivKeyAccA, PrivKeyAccB, PrivKeyRoot}
+	var pubKeys [][64]byte
+	for _, key := range keys {
+		pubKeys = append(pubKeys, crypto.GetAddressFromPubKey(&key.PublicKey))
+	}
+
+	accTx, _ := protocol.ConstrMultiSigAccTx(1, pubKeys, 2, PrivKeyRoot)
+	if !verifyAccTx(accTx) {
+		t.Fatalf("Multisig AccTx could not be verified: %v\n", accTx)
+	}
+	if err := accStateChange([]*protocol.AccTx{accTx}); err != nil {
+		t.Fatalf("Multisig account could not be created: %v\n", err)
+	}
+
+	multiSigHash := protocol.SerializeHashContent(accTx.PubKey)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	if acc := storage.State[multiSigHash]; acc == nil || !acc.IsMultiSig() {
+		t.Fatalf("Multisig account has not been added to the state: %v\n", acc)
+	}
+
+	tx, _ := protocol.ConstrMultiSigFundsTx(0x01, 10, 1, 0, multiSigHash, accBHash, []*ecdsa.PrivateKey{PrivKeyRoot, PrivKeyAccA}, PrivKeyMultiSig, nil)
+	if !verifyFundsTx(tx) {
+		t.Errorf("Multisig FundsTx could not be verified: \n%v", tx)
+	}
+
+	oneSigTx, _ := protocol.ConstrMultiSigFundsTx(0x01, 10, 1, 0, multiSigHash, accBHash, keys[:1], PrivKeyMultiSig, nil)
+	sameSigTx, _ := protocol.ConstrMultiSigFundsTx(0x01, 10, 1, 0, multiSigHash, accBHash, []*ecdsa.PrivateKey{PrivKeyAccA, PrivKeyAccA}, PrivKeyMultiSig, nil)
+	foreignSigTx, _ := protocol.ConstrMultiSigFundsTx(0x01, 10, 1, 0, multiSigHash, accBHash, []*ecdsa.PrivateKey{PrivKeyAccA, PrivKeyMultiSig}, PrivKeyMultiSig, nil)
+	sig1Tx, _ := protocol.ConstrFundsTx(0x01, 10, 1, 0, multiSigHash, accBHash, PrivKeyAccA, PrivKeyMultiSig, nil)
+	for _, invalidTx := range []*protocol.FundsTx{oneSigTx, sameSigTx, foreignSigTx, sig1Tx} {
+		if verifyFundsTx(invalidTx) {
+			t.Errorf("Multisig FundsTx without enough signatures has been verified: \n%v", invalidTx)
+		}
+	}
+
+	payments := []protocol.BatchPayment{{To: accBHash, Amount: 10}}
+	batchTx, _ := protocol.ConstrMultiSigBatchTx(0x01, 1, 0, multiSigHash, payments, 0, []*ecdsa.PrivateKey{PrivKeyRoot, PrivKeyAccA}, PrivKeyMultiSig)
+	if !verifyBatchTx(batchTx) {
+		t.Errorf("Multisig BatchTx could not be verified: \n%v", batchTx)
+	}
+
+	oneSigBatchTx, _ := protocol.ConstrMultiSigBatchTx(0x01, 1, 0, multiSigHash, payments, 0, keys[:1], PrivKeyMultiSig)
+	sig1BatchTx, _ := protocol.ConstrBatchTx(0x01, 1, 0, multiSigHash, payments, 0, PrivKeyAccA, PrivKeyMultiSig)
+	for _, invalidTx := range []*protocol.BatchTx{oneSigBatchTx, sig1BatchTx} {
+		if verifyBatchTx(invalidTx) {
+			t.Errorf("Multisig BatchTx without enough signatures has been verified: \n%v", invalidTx)
+		}
+	}
+
+	zeroThresholdTx, _ := protocol.ConstrMultiSigAccTx(1, pubKeys, 0, PrivKeyRoot)
+	highThresholdTx, _ := protocol.ConstrMultiSigAccTx(1, pubKeys, 4, PrivKeyRoot)
+	sameKeysTx, _ := protocol.ConstrMultiSigAccTx(1, [][64]byte{pubKeys[0], pubKeys[0]}, 1, PrivKeyRoot)
+	keyAddressTx, _ := protocol.ConstrMultiSigAccTx(1, pubKeys, 2, PrivKeyRoot)
+	keyAddressTx.PubKey = pubKeys[0]
+	for _, invalidTx := range []*protocol.AccTx{zeroThresholdTx, highThresholdTx, sameKeysTx, keyAddressTx} {
+		if verifyAccTx(invalidTx) {
+			t.Errorf("Invalid multisig AccTx has been verified: %v\n", invalidTx)
+		}
+	}
+}
+
+//Sig2 is only required if the system parameter or the sender account asks for it.
+func TestOptionalSig2(t *testing.T) {
+	cleanAndPrepare()
+
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+	tx, _ := protocol.ConstrFundsTx(0x01, 10, 1, accA.TxCnt, accAHash, accBHash, PrivKeyAccA, nil, nil)
+	keyTx, _ := protocol.ConstrKeyTx(0x01, 1, accA.TxCnt, accAHash, accA.Address, accB.Address, PrivKeyAccA, nil)
+	if verifyFundsTx(tx) || verifyKeyTx(keyTx) {
+		t.Error("Tx without Sig2 has been verified although the system parameter requires it.\n")
+	}
+
+	configTx, _ := protocol.ConstrConfigTx(0, protocol.MULTISIG_REQUIRED_ID, 0, 1, 0, PrivKeyRoot)
+	if !verifyConfigTx(configTx) {
+		t.Fatalf("ConfigTx could not be verified: %v\n", configTx)
+	}
+	configStateChange([]*protocol.ConfigTx{configTx}, [32]byte{'1'})
+	if activeParameters.Multisig_required != 0 || !verifyFundsTx(tx) || !verifyKeyTx(keyTx) {
+		t.Error("Tx without Sig2 has not been verified although the system parameter does not require it.\n")
+	}
+
+	//The requirement is checked again when a tx verified before the parameter changed is applied.
+	configStateChangeRollback([]*protocol.ConfigTx{configTx}, [32]byte{'1'})
+	if _, err := fundsStateChange([]*protocol.FundsTx{tx}, nil, lastBlock); err == nil {
+		t.Error("FundsTx without Sig2 has been applied although the system parameter requires it.\n")
+	}
+	if _, err := keyStateChange([]*protocol.KeyTx{keyTx}); err == nil {
+		t.Error("KeyTx without Sig2 has been applied although the system parameter requires it.\n")
+	}
+
+	configStateChange([]*protocol.ConfigTx{configTx}, [32]byte{'1'})
+	defer configStateChangeRollback([]*protocol.ConfigTx{configTx}, [32]byte{'1'})
+
+	//An account created with the sig2 header still requires it.
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	address := crypto.GetAddressFromPubKey(&key.PublicKey)
+	accTx, _, _ := protocol.ConstrAccTx(protocol.ACCTX_SIG2_HEADER, 1, address, PrivKeyRoot, nil, nil)
+	if err := accStateChange([]*protocol.AccTx{accTx}); err != nil {
+		t.Fatalf("Account could not be created: %v\n", err)
+	}
+	accHash := protocol.SerializeHashContent(address)
+	if acc := storage.State[accHash]; acc == nil || !acc.Sig2Required || storage.IsRootKey(accHash) {
+		t.Fatalf("Account has not been created with the sig2 flag: %v\n", acc)
+	}
+
+	unsignedTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, 0, accHash, accBHash, key, nil, nil)
+	signedTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, 0, accHash, accBHash, key, PrivKeyMultiSig, nil)
+	if verifyFundsTx(unsignedTx) || !verifyFundsTx(signedTx) {
+		t.Error("Sig2 of an account requiring it is not checked.\n")
+	}
+}
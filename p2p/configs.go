@@ -17,6 +17,19 @@ const (
 	//Calculate system time every UPDATE_SYS_TIME seconds
 	UPDATE_SYS_TIME = 90
 
+	//Maximum number of headers sent in response to a single BLOCK_HEADERS_REQ
+	MAX_HEADERS_PER_RES = 500
+	//Maximum number of blocks sent in response to a single BLOCK_RANGE_REQ
+	MAX_BLOCKS_PER_RES = 50
+	//Maximum number of tx hashes sent in response to a single ACC_TXS_REQ
+	MAX_TXS_PER_RES = 500
+	//Seconds an ACC_PROOF_REQ waits for the miner, which is busy while validating blocks
+	ACC_PROOF_TIMEOUT = 5
+	//Responses to requests of the miner that are buffered, further responses are dropped until the miner reads them
+	MINER_RES_BUFFER = 512
+	//FundsTxs buffered for the miner to decide on their replacement, further replacements are dropped
+	TX_REPLACEMENT_BUFFER = 256
+
 	//Protocol constants
 	IPV4ADDR_SIZE = 4
 	PORT_SIZE     = 2
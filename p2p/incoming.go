@@ -13,6 +13,10 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		processTxBrdcst(p, payload, CONFIGTX_BRDCST)
 	case STAKETX_BRDCST:
 		processTxBrdcst(p, payload, STAKETX_BRDCST)
+	case BATCHTX_BRDCST:
+		processTxBrdcst(p, payload, BATCHTX_BRDCST)
+	case KEYTX_BRDCST:
+		processTxBrdcst(p, payload, KEYTX_BRDCST)
 	case BLOCK_BRDCST:
 		forwardBlockToMiner(p, payload)
 	case TIME_BRDCST:
@@ -27,6 +31,10 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		txRes(p, payload, CONFIGTX_REQ)
 	case STAKETX_REQ:
 		txRes(p, payload, STAKETX_REQ)
+	case BATCHTX_REQ:
+		txRes(p, payload, BATCHTX_REQ)
+	case KEYTX_REQ:
+		txRes(p, payload, KEYTX_REQ)
 	case BLOCK_REQ:
 		blockRes(p, payload)
 	case BLOCK_HEADER_REQ:
@@ -35,6 +43,8 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		accRes(p, payload)
 	case ROOTACC_REQ:
 		rootAccRes(p, payload)
+	case ACC_PROOF_REQ:
+		accProofRes(p, payload)
 	case MINER_PING:
 		pongRes(p, payload, MINER_PING)
 	case CLIENT_PING:
@@ -43,12 +53,26 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		neighborRes(p)
 	case INTERMEDIATE_NODES_REQ:
 		intermediateNodesRes(p, payload)
+	case BLOCK_HEADERS_REQ:
+		blockHeadersRes(p, payload)
+	case BLOCK_RANGE_REQ:
+		blockRangeRes(p, payload)
+	case TX_PROOF_REQ:
+		txProofRes(p, payload)
+	case ACC_TXS_REQ:
+		accTxsRes(p, payload)
+	case RECEIPT_REQ:
+		receiptRes(p, payload)
 
 		//RESPONSES
 	case NEIGHBOR_RES:
 		processNeighborRes(p, payload)
 	case BLOCK_RES:
 		forwardBlockReqToMiner(p, payload)
+	case BLOCK_HEADERS_RES:
+		forwardBlockHeadersToMiner(p, payload)
+	case BLOCK_RANGE_RES:
+		forwardBlockRangeToMiner(p, payload)
 	case FUNDSTX_RES:
 		forwardTxReqToMiner(p, payload, FUNDSTX_RES)
 	case ACCTX_RES:
@@ -57,5 +81,9 @@ func processIncomingMsg(p *peer, header *Header, payload []byte) {
 		forwardTxReqToMiner(p, payload, CONFIGTX_RES)
 	case STAKETX_RES:
 		forwardTxReqToMiner(p, payload, STAKETX_RES)
+	case BATCHTX_RES:
+		forwardTxReqToMiner(p, payload, BATCHTX_RES)
+	case KEYTX_RES:
+		forwardTxReqToMiner(p, payload, KEYTX_RES)
 	}
 }
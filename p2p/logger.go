@@ -24,6 +24,7 @@ func InitLogging() {
 	LogMapping[6] = "BLOCK_BRDCST"
 	LogMapping[7] = "BLOCK_HEADER_BRDCST"
 	LogMapping[8] = "TX_BRDCST_ACK"
+	LogMapping[9] = "BATCHTX_BRDCST"
 
 	LogMapping[10] = "FUNDSTX_REQ"
 	LogMapping[11] = "ACCTX_REQ"
@@ -34,6 +35,7 @@ func InitLogging() {
 	LogMapping[16] = "ACC_REQ"
 	LogMapping[17] = "ROOTACC_REQ"
 	LogMapping[18] = "INTERMEDIATE_NODES_REQ"
+	LogMapping[19] = "ACC_PROOF_REQ"
 
 	LogMapping[20] = "FUNDSTX_RES"
 	LogMapping[21] = "ACCTX_RES"
@@ -44,6 +46,7 @@ func InitLogging() {
 	LogMapping[26] = "ACC_RES"
 	LogMapping[27] = "ROOTACC_RES"
 	LogMapping[28] = "INTERMEDIATE_NODES_RES"
+	LogMapping[29] = "ACC_PROOF_RES"
 
 	LogMapping[30] = "NEIGHBOR_REQ"
 
@@ -51,6 +54,22 @@ func InitLogging() {
 
 	LogMapping[50] = "TIME_BRDCST"
 
+	LogMapping[60] = "BLOCK_HEADERS_REQ"
+	LogMapping[61] = "BLOCK_HEADERS_RES"
+	LogMapping[62] = "BLOCK_RANGE_REQ"
+	LogMapping[63] = "BLOCK_RANGE_RES"
+	LogMapping[64] = "TX_PROOF_REQ"
+	LogMapping[65] = "TX_PROOF_RES"
+	LogMapping[66] = "ACC_TXS_REQ"
+	LogMapping[67] = "ACC_TXS_RES"
+	LogMapping[68] = "BATCHTX_REQ"
+	LogMapping[69] = "BATCHTX_RES"
+	LogMapping[70] = "KEYTX_BRDCST"
+	LogMapping[71] = "KEYTX_REQ"
+	LogMapping[72] = "KEYTX_RES"
+	LogMapping[73] = "RECEIPT_REQ"
+	LogMapping[74] = "RECEIPT_RES"
+
 	LogMapping[100] = "MINER_PING"
 	LogMapping[101] = "MINER_PONG"
 	LogMapping[102] = "CLIENT_PING"
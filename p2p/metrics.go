@@ -0,0 +1,15 @@
+package p2p
+
+import (
+	"github.com/bazo-blockchain/bazo-miner/metrics"
+)
+
+var (
+	minerPeersGauge = metrics.NewGaugeFunc("bazo_miner_peers", "Number of connected miners.", func() float64 {
+		return float64(len(peers.getAllPeers(PEERTYPE_MINER)))
+	})
+	clientPeersGauge = metrics.NewGaugeFunc("bazo_client_peers", "Number of connected clients.", func() float64 {
+		return float64(len(peers.getAllPeers(PEERTYPE_CLIENT)))
+	})
+	timeOffsetGauge = metrics.NewGauge("bazo_system_time_offset_seconds", "Offset of the median network time to the local time.")
+)
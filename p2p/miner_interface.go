@@ -1,7 +1,10 @@
 package p2p
 
 import (
+	"errors"
+	"fmt"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
 )
 
 var (
@@ -14,17 +17,48 @@ var (
 
 	VerifiedTxsOut chan []byte = make(chan []byte)
 
-	//Data requested by miner, to allow parallelism, we have a chan for every tx type.
-	FundsTxChan  = make(chan *protocol.FundsTx)
-	AccTxChan    = make(chan *protocol.AccTx)
-	ConfigTxChan = make(chan *protocol.ConfigTx)
-	StakeTxChan  = make(chan *protocol.StakeTx)
+	//Data requested by miner, to allow parallelism, we have a chan for every tx type. Responses are buffered, such
+	//that late responses to requests the miner has given up on do not block the peer.
+	FundsTxChan  = make(chan *protocol.FundsTx, MINER_RES_BUFFER)
+	AccTxChan    = make(chan *protocol.AccTx, MINER_RES_BUFFER)
+	ConfigTxChan = make(chan *protocol.ConfigTx, MINER_RES_BUFFER)
+	StakeTxChan  = make(chan *protocol.StakeTx, MINER_RES_BUFFER)
+	BatchTxChan  = make(chan *protocol.BatchTx, MINER_RES_BUFFER)
+	KeyTxChan    = make(chan *protocol.KeyTx, MINER_RES_BUFFER)
 
-	BlockReqChan = make(chan []byte)
+	BlockReqChan = make(chan []byte, MINER_RES_BUFFER)
+	//Ranges of headers requested during the sync.
+	BlockHeadersChan = make(chan *BlockHeadersRes, MINER_RES_BUFFER)
+	//Ranges of blocks requested by height.
+	BlockRangeChan = make(chan []byte, MINER_RES_BUFFER)
+
+	//FundsTxs from the network with the same sender and txCnt as a pending tx, the miner decides on the replacement.
+	TxReplacementIn = make(chan *protocol.FundsTx, TX_REPLACEMENT_BUFFER)
+
+	//Account proofs requested by peers, the miner builds them because the state changes during block validation.
+	AccProofReqIn = make(chan *AccProofReq)
 
 	receivedTXStash = make([]*protocol.FundsTx, 0)
 )
 
+//Request for the proof of an account against the state root of a block, the miner answers on Res.
+type AccProofReq struct {
+	BlockHash [32]byte
+	AccHash   [32]byte
+	Res       chan AccProofRes
+}
+
+//Headers received during the sync. The peer is kept, such that invalid headers can be requested from another peer.
+type BlockHeadersRes struct {
+	Peer    string
+	Payload []byte
+}
+
+type AccProofRes struct {
+	Proof *protocol.StateProof
+	Err   error
+}
+
 //This is for blocks and txs that the miner successfully validated.
 func forwardBlockBrdcstToMiner() {
 	for {
@@ -81,7 +115,11 @@ func forwardTxReqToMiner(p *peer, payload []byte, txType uint8) {
 		// our request." error
 		if !txAlreadyInStash(receivedTXStash, fundsTx.Hash()) {
 			receivedTXStash = append(receivedTXStash, fundsTx)
-			FundsTxChan <- fundsTx
+			select {
+			case FundsTxChan <- fundsTx:
+			default:
+				logDroppedRes(txType)
+			}
 			if len(receivedTXStash) > 1000 {
 				receivedTXStash = append(receivedTXStash[:0], receivedTXStash[1:]...)
 			}
@@ -92,28 +130,153 @@ func forwardTxReqToMiner(p *peer, payload []byte, txType uint8) {
 		if accTx == nil {
 			return
 		}
-		AccTxChan <- accTx
+		select {
+		case AccTxChan <- accTx:
+		default:
+			logDroppedRes(txType)
+		}
 	case CONFIGTX_RES:
 		var configTx *protocol.ConfigTx
 		configTx = configTx.Decode(payload)
 		if configTx == nil {
 			return
 		}
-		ConfigTxChan <- configTx
+		select {
+		case ConfigTxChan <- configTx:
+		default:
+			logDroppedRes(txType)
+		}
 	case STAKETX_RES:
 		var stakeTx *protocol.StakeTx
 		stakeTx = stakeTx.Decode(payload)
 		if stakeTx == nil {
 			return
 		}
-		StakeTxChan <- stakeTx
+		select {
+		case StakeTxChan <- stakeTx:
+		default:
+			logDroppedRes(txType)
+		}
+	case BATCHTX_RES:
+		var batchTx *protocol.BatchTx
+		batchTx = batchTx.Decode(payload)
+		if batchTx == nil {
+			return
+		}
+		select {
+		case BatchTxChan <- batchTx:
+		default:
+			logDroppedRes(txType)
+		}
+	case KEYTX_RES:
+		var keyTx *protocol.KeyTx
+		keyTx = keyTx.Decode(payload)
+		if keyTx == nil {
+			return
+		}
+		select {
+		case KeyTxChan <- keyTx:
+		default:
+			logDroppedRes(txType)
+		}
 	}
 }
 
 func forwardBlockReqToMiner(p *peer, payload []byte) {
-	BlockReqChan <- payload
+	select {
+	case BlockReqChan <- payload:
+	default:
+		logDroppedRes(BLOCK_RES)
+	}
+}
+
+func forwardBlockHeadersToMiner(p *peer, payload []byte) {
+	select {
+	case BlockHeadersChan <- &BlockHeadersRes{p.getIPPort(), payload}:
+	default:
+		logDroppedRes(BLOCK_HEADERS_RES)
+	}
+}
+
+func forwardBlockRangeToMiner(p *peer, payload []byte) {
+	select {
+	case BlockRangeChan <- payload:
+	default:
+		logDroppedRes(BLOCK_RANGE_RES)
+	}
+}
+
+//Responses are dropped if the buffer is full, the miner requests them again if it still needs them.
+func logDroppedRes(resType uint8) {
+	logger.Printf("Dropped %v response, the miner did not read the previous responses.\n", LogMapping[resType])
 }
 
 func ReadSystemTime() int64 {
 	return systemTime
 }
+
+//Writes a tx that has not been received over the network (e.g., over rpc) to the mempool and broadcasts it.
+func SubmitTx(tx protocol.Transaction) error {
+	if _, err := getBrdcstType(tx); err != nil {
+		return err
+	}
+
+	if storage.ReadOpenTx(tx.Hash()) != nil {
+		return errors.New(fmt.Sprintf("Transaction (%x) already in the mempool.", tx.Hash()))
+	}
+	if storage.ReadClosedTx(tx.Hash()) != nil {
+		return errors.New(fmt.Sprintf("Transaction (%x) already validated.", tx.Hash()))
+	}
+
+	logger.Printf("Writing submitted transaction (%x) in the mempool.\n", tx.Hash())
+	if err := storage.WriteOpenTx(tx); err != nil {
+		return err
+	}
+
+	return BroadcastTx(tx)
+}
+
+//Relays a tx to the other miners.
+func BroadcastTx(tx protocol.Transaction) error {
+	brdcstType, err := getBrdcstType(tx)
+	if err != nil {
+		return err
+	}
+
+	minerBrdcstMsg <- BuildPacket(brdcstType, tx.Encode())
+
+	return nil
+}
+
+func getBrdcstType(tx protocol.Transaction) (brdcstType uint8, err error) {
+	switch tx.(type) {
+	case *protocol.FundsTx:
+		brdcstType = FUNDSTX_BRDCST
+	case *protocol.AccTx:
+		brdcstType = ACCTX_BRDCST
+	case *protocol.ConfigTx:
+		brdcstType = CONFIGTX_BRDCST
+	case *protocol.StakeTx:
+		brdcstType = STAKETX_BRDCST
+	case *protocol.BatchTx:
+		brdcstType = BATCHTX_BRDCST
+	case *protocol.KeyTx:
+		brdcstType = KEYTX_BRDCST
+	default:
+		return 0, errors.New("Transaction type not recognized.")
+	}
+
+	return brdcstType, nil
+}
+
+//Returns the IP:Port of all connected miners and clients.
+func GetPeers() (miners, clients []string) {
+	for _, p := range peers.getAllPeers(PEERTYPE_MINER) {
+		miners = append(miners, p.getIPPort())
+	}
+	for _, p := range peers.getAllPeers(PEERTYPE_CLIENT) {
+		clients = append(clients, p.getIPPort())
+	}
+
+	return miners, clients
+}
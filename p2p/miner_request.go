@@ -1,7 +1,9 @@
 package p2p
 
 import (
+	"encoding/binary"
 	"errors"
+	"math/rand"
 )
 
 //Both block and tx requests are handled asymmetricaly, using channels as inter-communication
@@ -22,14 +24,62 @@ func BlockReq(hash [32]byte) error {
 	return nil
 }
 
-func LastBlockReq() error {
+//Requests the last block from up to count different peers, such that the answers can be compared. Returns the
+//number of peers that have been asked.
+func LastBlockReq(count int) (sent int, err error) {
+	peerList := peers.getAllPeers(PEERTYPE_MINER)
+	if len(peerList) == 0 {
+		return 0, errors.New("Couldn't get a connection, request not transmitted.")
+	}
+
+	packet := BuildPacket(BLOCK_REQ, nil)
+	for _, i := range rand.Perm(len(peerList)) {
+		if sent == count {
+			break
+		}
+		sendData(peerList[i], packet)
+		sent++
+	}
 
+	return sent, nil
+}
+
+//Requests a block from a single peer. Used during the sync, where a lot of blocks are requested in parallel and
+//broadcasting every request would multiply the responses.
+func SyncBlockReq(hash [32]byte) error {
 	p := peers.getRandomPeer(PEERTYPE_MINER)
 	if p == nil {
 		return errors.New("Couldn't get a connection, request not transmitted.")
 	}
 
-	packet := BuildPacket(BLOCK_REQ, nil)
+	packet := BuildPacket(BLOCK_REQ, hash[:])
+	sendData(p, packet)
+	return nil
+}
+
+//Requests count headers starting at the given height. Every request goes to a random peer, this way the headers are
+//fetched from several peers in parallel. Peers that sent invalid headers before are excluded. Returns the address of
+//the peer that has been asked.
+func BlockHeadersReq(height uint32, count uint16, excluded map[string]bool) (string, error) {
+	p := peers.getRandomPeerExcept(PEERTYPE_MINER, excluded)
+	if p == nil {
+		return "", errors.New("Couldn't get a connection, request not transmitted.")
+	}
+
+	packet := BuildPacket(BLOCK_HEADERS_REQ, encodeHeadersReq(height, count))
+	sendData(p, packet)
+	return p.getIPPort(), nil
+}
+
+//Requests count blocks starting at the given height from a random peer. Peers answer with at most
+//MAX_BLOCKS_PER_RES blocks, larger ranges need to be paged through.
+func BlockRangeReq(height uint32, count uint16) error {
+	p := peers.getRandomPeer(PEERTYPE_MINER)
+	if p == nil {
+		return errors.New("Couldn't get a connection, request not transmitted.")
+	}
+
+	packet := BuildPacket(BLOCK_RANGE_REQ, encodeHeadersReq(height, count))
 	sendData(p, packet)
 	return nil
 }
@@ -50,3 +100,31 @@ func TxReq(hash [32]byte, reqType uint8) error {
 
 	return nil
 }
+
+//Requests a tx from a single peer, used during the sync.
+func SyncTxReq(hash [32]byte, reqType uint8) error {
+	p := peers.getRandomPeer(PEERTYPE_MINER)
+	if p == nil {
+		return errors.New("Couldn't get a connection, request not transmitted.")
+	}
+
+	packet := BuildPacket(reqType, hash[:])
+	sendData(p, packet)
+	return nil
+}
+
+//Payload of a BLOCK_HEADERS_REQ and BLOCK_RANGE_REQ: start height (4 bytes) and number of headers (2 bytes), both big endian encoded.
+func encodeHeadersReq(height uint32, count uint16) []byte {
+	payload := make([]byte, 6)
+	binary.BigEndian.PutUint32(payload[0:4], height)
+	binary.BigEndian.PutUint16(payload[4:6], count)
+	return payload
+}
+
+func decodeHeadersReq(payload []byte) (height uint32, count uint16) {
+	if len(payload) != 6 {
+		return 0, 0
+	}
+
+	return binary.BigEndian.Uint32(payload[0:4]), binary.BigEndian.Uint16(payload[4:6])
+}
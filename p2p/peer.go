@@ -117,6 +117,22 @@ func (peers peersStruct) getRandomPeer(peerType uint) (p *peer) {
 	}
 }
 
+//Returns a random peer whose address is not excluded.
+func (peers *peersStruct) getRandomPeerExcept(peerType uint, excluded map[string]bool) (p *peer) {
+	var peerList []*peer
+	for _, p := range peers.getAllPeers(peerType) {
+		if !excluded[p.getIPPort()] {
+			peerList = append(peerList, p)
+		}
+	}
+
+	if len(peerList) == 0 {
+		return nil
+	}
+
+	return peerList[int(rand.Uint32())%len(peerList)]
+}
+
 func (peers peersStruct) getAllPeers(peerType uint) []*peer {
 	peers.peerMutex.Lock()
 	defer peers.peerMutex.Unlock()
@@ -41,6 +41,20 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 			return
 		}
 		tx = sTx
+	case BATCHTX_BRDCST:
+		var bTx *protocol.BatchTx
+		bTx = bTx.Decode(payload)
+		if bTx == nil {
+			return
+		}
+		tx = bTx
+	case KEYTX_BRDCST:
+		var kTx *protocol.KeyTx
+		kTx = kTx.Decode(payload)
+		if kTx == nil {
+			return
+		}
+		tx = kTx
 	}
 
 	//Response tx acknowledgment if the peer is a client
@@ -58,9 +72,26 @@ func processTxBrdcst(p *peer, payload []byte, brdcstType uint8) {
 		return
 	}
 
+	//Only a tx with a higher fee replaces a pending FundsTx of the same sender and txCnt, which requires the miner to
+	//verify the signature. The miner rebroadcasts the tx if it replaced the pending one.
+	if fundsTx, isFundsTx := tx.(*protocol.FundsTx); isFundsTx && len(storage.ReadOpenFundsTxs(fundsTx.From, fundsTx.TxCnt)) > 0 {
+		//Replacements are dropped if the miner cannot keep up, this must not block the peer.
+		select {
+		case TxReplacementIn <- fundsTx:
+			logger.Printf("Received transaction (%x) conflicts with a pending transaction, forwarding it to the miner.\n", tx.Hash())
+		default:
+			logger.Printf("Received transaction (%x) conflicts with a pending transaction, dropped it since the miner is busy.\n", tx.Hash())
+		}
+		return
+	}
+
 	//Write to mempool and rebroadcast
 	logger.Printf("Writing transaction (%x) in the mempool.\n", tx.Hash())
-	storage.WriteOpenTx(tx)
+	if err := storage.WriteOpenTx(tx); err != nil {
+		//Txs that do not make it into the mempool are not rebroadcast.
+		logger.Printf("%v\n", err)
+		return
+	}
 	toBrdcst := BuildPacket(brdcstType, payload)
 	minerBrdcstMsg <- toBrdcst
 }
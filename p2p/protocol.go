@@ -14,6 +14,7 @@ const (
 	BLOCK_BRDCST        = 6
 	BLOCK_HEADER_BRDCST = 7
 	TX_BRDCST_ACK       = 8
+	BATCHTX_BRDCST      = 9
 
 	FUNDSTX_REQ            = 10
 	ACCTX_REQ              = 11
@@ -24,6 +25,7 @@ const (
 	ACC_REQ                = 16
 	ROOTACC_REQ            = 17
 	INTERMEDIATE_NODES_REQ = 18
+	ACC_PROOF_REQ          = 19
 
 	FUNDSTX_RES            = 20
 	ACCTX_RES              = 21
@@ -34,12 +36,29 @@ const (
 	ACC_RES                = 26
 	ROOTACC_RES            = 27
 	INTERMEDIATE_NODES_RES = 28
+	ACC_PROOF_RES          = 29
 
 	NEIGHBOR_REQ = 30
 	NEIGHBOR_RES = 40
 
 	TIME_BRDCST = 50
 
+	BLOCK_HEADERS_REQ = 60
+	BLOCK_HEADERS_RES = 61
+	BLOCK_RANGE_REQ   = 62
+	BLOCK_RANGE_RES   = 63
+	TX_PROOF_REQ      = 64
+	TX_PROOF_RES      = 65
+	ACC_TXS_REQ       = 66
+	ACC_TXS_RES       = 67
+	BATCHTX_REQ       = 68
+	BATCHTX_RES       = 69
+	KEYTX_BRDCST      = 70
+	KEYTX_REQ         = 71
+	KEYTX_RES         = 72
+	RECEIPT_REQ       = 73
+	RECEIPT_RES       = 74
+
 	MINER_PING  = 100
 	MINER_PONG  = 101
 	CLIENT_PING = 102
@@ -3,10 +3,12 @@ package p2p
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/bazo-blockchain/bazo-miner/storage"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //This file responds to incoming requests from miners in a synchronous fashion
@@ -42,6 +44,10 @@ func txRes(p *peer, payload []byte, txKind uint8) {
 		packet = BuildPacket(CONFIGTX_RES, tx.Encode())
 	case STAKETX_REQ:
 		packet = BuildPacket(STAKETX_RES, tx.Encode())
+	case BATCHTX_REQ:
+		packet = BuildPacket(BATCHTX_RES, tx.Encode())
+	case KEYTX_REQ:
+		packet = BuildPacket(KEYTX_RES, tx.Encode())
 	}
 
 	sendData(p, packet)
@@ -100,6 +106,58 @@ func blockHeaderRes(p *peer, payload []byte) {
 	sendData(p, packet)
 }
 
+//Responds with a range of headers. The headers are blocks without tx hashes, this way they contain all fields needed
+//to link them, while the bodies (tx hashes) can be checked against the merkle root later on.
+func blockHeadersRes(p *peer, payload []byte) {
+	var packet []byte
+
+	if headers := _blockHeadersRes(decodeHeadersReq(payload)); len(headers) > 0 {
+		packet = BuildPacket(BLOCK_HEADERS_RES, protocol.EncodeBlocks(headers))
+	} else {
+		packet = BuildPacket(NOT_FOUND, nil)
+	}
+
+	sendData(p, packet)
+}
+
+//Decouple the function for testing. Headers are returned in ascending order.
+func _blockHeadersRes(height uint32, count uint16) (headers []*protocol.Block) {
+	if count > MAX_HEADERS_PER_RES {
+		count = MAX_HEADERS_PER_RES
+	}
+
+	for _, block := range storage.ReadClosedBlockRange(height, int(count)) {
+		headers = append(headers, blockHeader(block))
+	}
+
+	return headers
+}
+
+//The header is the block without tx hashes, which still contains the merkle root and the number of txs.
+func blockHeader(block *protocol.Block) *protocol.Block {
+	header := *block
+	header.AccTxData, header.FundsTxData, header.ConfigTxData, header.StakeTxData, header.BatchTxData, header.KeyTxData = nil, nil, nil, nil, nil, nil
+	return &header
+}
+
+//Responds with a range of blocks by height, the counterpart of blockHeadersRes for whole blocks.
+func blockRangeRes(p *peer, payload []byte) {
+	var packet []byte
+
+	height, count := decodeHeadersReq(payload)
+	if count > MAX_BLOCKS_PER_RES {
+		count = MAX_BLOCKS_PER_RES
+	}
+
+	if blocks := storage.ReadClosedBlockRange(height, int(count)); len(blocks) > 0 {
+		packet = BuildPacket(BLOCK_RANGE_RES, protocol.EncodeBlocks(blocks))
+	} else {
+		packet = BuildPacket(NOT_FOUND, nil)
+	}
+
+	sendData(p, packet)
+}
+
 //Responds to an account request from another miner
 func accRes(p *peer, payload []byte) {
 	var packet []byte
@@ -112,6 +170,68 @@ func accRes(p *peer, payload []byte) {
 	sendData(p, packet)
 }
 
+//Responds with the account and a proof of (non-)inclusion against the state root of the requested block. The payload
+//consists of the block hash followed by the account hash. Proofs can only be built for the last closed block, because
+//the state of previous blocks is not kept. Requests for any other block are answered with NOT_FOUND.
+func accProofRes(p *peer, payload []byte) {
+	var packet []byte
+
+	if proof, err := _accProofRes(payload); err == nil {
+		packet = BuildPacket(ACC_PROOF_RES, proof.Encode())
+	} else {
+		logger.Printf("Account proof for %v could not be built: %v\n", p.getIPPort(), err)
+		packet = BuildPacket(NOT_FOUND, nil)
+	}
+
+	sendData(p, packet)
+}
+
+//Decouple the function for testing. The proof is built by the miner, which holds the state during block validation.
+func _accProofRes(payload []byte) (*protocol.StateProof, error) {
+	if len(payload) < 64 {
+		return nil, errors.New("Account proof request too short.")
+	}
+
+	req := &AccProofReq{Res: make(chan AccProofRes, 1)}
+	copy(req.BlockHash[:], payload[0:32])
+	copy(req.AccHash[:], payload[32:64])
+
+	select {
+	case AccProofReqIn <- req:
+	case <-time.After(ACC_PROOF_TIMEOUT * time.Second):
+		return nil, errors.New("Miner did not accept the account proof request.")
+	}
+
+	res := <-req.Res
+	return res.Proof, res.Err
+}
+
+//Responds with a page of the tx history of an account. The payload consists of the account hash (32 bytes), the
+//offset (4 bytes) and the page size (2 bytes), both big endian encoded. The response contains the tx hashes only.
+func accTxsRes(p *peer, payload []byte) {
+	var packet []byte
+
+	if len(payload) != 38 {
+		packet = BuildPacket(NOT_FOUND, nil)
+	} else {
+		var accHash [32]byte
+		copy(accHash[:], payload[0:32])
+		offset := int(binary.BigEndian.Uint32(payload[32:36]))
+		count := int(binary.BigEndian.Uint16(payload[36:38]))
+		if count > MAX_TXS_PER_RES {
+			count = MAX_TXS_PER_RES
+		}
+
+		var txHashes [][]byte
+		for _, txHash := range storage.ReadAccountTxs(accHash, offset, count) {
+			txHashes = append(txHashes, txHash[:])
+		}
+		packet = BuildPacket(ACC_TXS_RES, protocol.Encode(txHashes, 32))
+	}
+
+	sendData(p, packet)
+}
+
 func rootAccRes(p *peer, payload []byte) {
 	var packet []byte
 	var hash [32]byte
@@ -213,6 +333,74 @@ func _neighborRes(ipportList []string) (payload []byte) {
 	return payload
 }
 
+//Responds with a closed tx, the header of the block that included it and the merkle path to the merkle root.
+func txProofRes(p *peer, payload []byte) {
+	var packet []byte
+	var txHash [32]byte
+	copy(txHash[:], payload)
+
+	if proof := _txProofRes(txHash); proof != nil {
+		packet = BuildPacket(TX_PROOF_RES, proof.Encode())
+	} else {
+		packet = BuildPacket(NOT_FOUND, nil)
+	}
+
+	sendData(p, packet)
+}
+
+//Decouple the function for testing.
+func _txProofRes(txHash [32]byte) *protocol.TxProof {
+	location := storage.ReadTxLocation(txHash)
+	if location == nil {
+		return nil
+	}
+
+	tx := storage.ReadClosedTx(txHash)
+	block := storage.ReadClosedBlock(location.BlockHash)
+	if tx == nil || block == nil {
+		return nil
+	}
+
+	merkleTree := protocol.BuildMerkleTree(block)
+	if merkleTree == nil {
+		return nil
+	}
+	leaf := protocol.GetLeaf(merkleTree, txHash)
+	if leaf == nil {
+		return nil
+	}
+	intermediates, err := protocol.GetIntermediate(leaf)
+	if err != nil {
+		return nil
+	}
+
+	proof := &protocol.TxProof{
+		Tx:     tx.Encode(),
+		Header: blockHeader(block),
+		Index:  location.Index,
+	}
+	for _, node := range intermediates {
+		proof.Intermediates = append(proof.Intermediates, node.Hash)
+	}
+
+	return proof
+}
+
+//Responds with the receipt of a tx applied by a closed block, the payload is the tx hash.
+func receiptRes(p *peer, payload []byte) {
+	var packet []byte
+	var txHash [32]byte
+	copy(txHash[:], payload)
+
+	if receipt := storage.ReadReceipt(txHash); receipt != nil {
+		packet = BuildPacket(RECEIPT_RES, receipt.Encode())
+	} else {
+		packet = BuildPacket(NOT_FOUND, nil)
+	}
+
+	sendData(p, packet)
+}
+
 func intermediateNodesRes(p *peer, payload []byte) {
 	var blockHash, txHash [32]byte
 	var nodeHashes [][]byte
@@ -61,3 +61,14 @@ func Test_PongRes(t *testing.T) {
 		t.Errorf("Failed to extract IP:Port: (%v) vs. (%v)\n", "8000", ipportRet)
 	}
 }
+
+func Test_HeadersReq(t *testing.T) {
+	height, count := decodeHeadersReq(encodeHeadersReq(100000, MAX_HEADERS_PER_RES))
+	if height != 100000 || count != MAX_HEADERS_PER_RES {
+		t.Errorf("Headers request deserialization failed: %v, %v\n", height, count)
+	}
+
+	if height, count = decodeHeadersReq([]byte{1, 2}); height != 0 || count != 0 {
+		t.Error("Malformed headers request got accepted.\n")
+	}
+}
@@ -36,10 +36,12 @@ func writeSystemTime() {
 	//If we don't have at least MIN_PEERS_FOR_TIME different time values, we take our own system time for reference
 	if len(ipeerTimes) < MIN_PEERS_FOR_TIME {
 		systemTime = time.Now().Unix()
+		timeOffsetGauge.Set(0)
 		return
 	}
 
 	systemTime = calcMedian(ipeerTimes)
+	timeOffsetGauge.Set(float64(systemTime - time.Now().Unix()))
 }
 
 //To protect against outliers, get the median
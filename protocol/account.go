@@ -16,7 +16,11 @@ type Account struct {
 	CommitmentKey      [crypto.COMM_KEY_LENGTH]byte // represents the modulus N of the RSA public key
 	StakingBlockHeight uint32                // 4 Byte
 	Contract           []byte                // Arbitrary length
-	ContractVariables  [][]byte           // Arbitrary length
+	ContractVariables  [][]byte           // Arbitrary length
+	MultiSigKeys       [][64]byte         // Only set for multisig accounts
+	MultiSigThreshold  uint8              // 1 Byte
+	Sig2Required       bool               // 1 Byte
+	SigningKey         [64]byte           // Only set if the key has been rotated
 }
 
 func NewAccount(address [64]byte,
@@ -37,6 +41,10 @@ func NewAccount(address [64]byte,
 		0,
 		contract,
 		contractVariables,
+		nil,
+		0,
+		false,
+		[64]byte{},
 	}
 
 	return newAcc
@@ -50,6 +58,55 @@ func (acc *Account) Hash() [32]byte {
 	return SerializeHashContent(acc.Address)
 }
 
+//StateHash commits to the content of the account and is used as leaf value in the state tree. StakingBlockHeight is
+//not part of it, because it is not rolled back and would let the state roots of nodes diverge after a rollback.
+func (acc *Account) StateHash() [32]byte {
+	if acc == nil {
+		return [32]byte{}
+	}
+
+	accHash := struct {
+		Address           [64]byte
+		Issuer            [32]byte
+		Balance           uint64
+		TxCnt             uint32
+		IsStaking         bool
+		CommitmentKey     [crypto.COMM_KEY_LENGTH]byte
+		Contract          []byte
+		ContractVariables [][]byte
+	}{
+		acc.Address,
+		acc.Issuer,
+		acc.Balance,
+		acc.TxCnt,
+		acc.IsStaking,
+		acc.CommitmentKey,
+		acc.Contract,
+		acc.ContractVariables,
+	}
+
+	//The signature settings are only part of the state hash if they are set, the hashes of other accounts stay the same.
+	if acc.IsMultiSig() || acc.Sig2Required || acc.SigningKey != [64]byte{} {
+		sigAccHash := struct {
+			Acc               interface{}
+			MultiSigKeys      [][64]byte
+			MultiSigThreshold uint8
+			Sig2Required      bool
+			SigningKey        [64]byte
+		}{
+			accHash,
+			acc.MultiSigKeys,
+			acc.MultiSigThreshold,
+			acc.Sig2Required,
+			acc.SigningKey,
+		}
+
+		return SerializeHashContent(sigAccHash)
+	}
+
+	return SerializeHashContent(accHash)
+}
+
 func (acc *Account) Encode() []byte {
 	if acc == nil {
 		return nil
@@ -65,6 +122,10 @@ func (acc *Account) Encode() []byte {
 		StakingBlockHeight: acc.StakingBlockHeight,
 		Contract:           acc.Contract,
 		ContractVariables:  acc.ContractVariables,
+		MultiSigKeys:       acc.MultiSigKeys,
+		MultiSigThreshold:  acc.MultiSigThreshold,
+		Sig2Required:       acc.Sig2Required,
+		SigningKey:         acc.SigningKey,
 	}
 
 	buffer := new(bytes.Buffer)
@@ -72,6 +133,30 @@ func (acc *Account) Encode() []byte {
 	return buffer.Bytes()
 }
 
+//Spends of a multisig account need signatures of MultiSigThreshold of its MultiSigKeys.
+func (acc *Account) IsMultiSig() bool {
+	return acc.MultiSigThreshold != 0
+}
+
+//The public key that signs the txs of the account. It is the address unless it has been rotated with a keyTx.
+func (acc *Account) PubKey() [64]byte {
+	if acc.SigningKey != [64]byte{} {
+		return acc.SigningKey
+	}
+
+	return acc.Address
+}
+
+//The signing key is only stored if it differs from the address, rotating back to the address restores the initial
+//state of the account.
+func (acc *Account) SetPubKey(key [64]byte) {
+	if key == acc.Address {
+		acc.SigningKey = [64]byte{}
+	} else {
+		acc.SigningKey = key
+	}
+}
+
 func (*Account) Decode(encoded []byte) (acc *Account) {
 	var decoded Account
 	buffer := bytes.NewBuffer(encoded)
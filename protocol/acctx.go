@@ -11,6 +11,10 @@ import (
 
 const (
 	ACCTX_SIZE = 169
+
+	//Can be combined with the other headers, the new account requires the co-signature of the multisig server (Sig2)
+	//even if the system parameter does not.
+	ACCTX_SIG2_HEADER = 0x08
 )
 
 type AccTx struct {
@@ -21,6 +25,9 @@ type AccTx struct {
 	Sig               [64]byte
 	Contract          []byte
 	ContractVariables [][]byte
+	//Only set for multisig accounts (ACCTX_MULTISIG_HEADER)
+	MultiSigKeys      [][64]byte
+	MultiSigThreshold uint8
 }
 
 func ConstrAccTx(header byte, fee uint64, address [64]byte, rootPrivKey *ecdsa.PrivateKey, contract []byte, contractVariables [][]byte) (tx *AccTx, newAccAddress *ecdsa.PrivateKey, err error) {
@@ -66,6 +73,29 @@ func ConstrAccTx(header byte, fee uint64, address [64]byte, rootPrivKey *ecdsa.P
 	return tx, newAccAddress, nil
 }
 
+//Creates an M-of-N multisig account with the given keys and threshold. The address of the account is derived from
+//them, see MultiSigAddress().
+func ConstrMultiSigAccTx(fee uint64, keys [][64]byte, threshold uint8, rootPrivKey *ecdsa.PrivateKey) (tx *AccTx, err error) {
+	tx = new(AccTx)
+	tx.Header = ACCTX_MULTISIG_HEADER
+	tx.Fee = fee
+	tx.PubKey = MultiSigAddress(keys, threshold)
+	tx.MultiSigKeys = keys
+	tx.MultiSigThreshold = threshold
+
+	var rootPublicKey [64]byte
+	rootPubKey1, rootPubKey2 := rootPrivKey.PublicKey.X.Bytes(), rootPrivKey.PublicKey.Y.Bytes()
+	copy(rootPublicKey[32-len(rootPubKey1):32], rootPubKey1)
+	copy(rootPublicKey[64-len(rootPubKey2):], rootPubKey2)
+	tx.Issuer = SerializeHashContent(rootPublicKey)
+
+	if tx.Sig, err = signHash(rootPrivKey, tx.Hash()); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
 func (tx *AccTx) Hash() [32]byte {
 	if tx == nil {
 		return [32]byte{}
@@ -87,6 +117,21 @@ func (tx *AccTx) Hash() [32]byte {
 		tx.ContractVariables,
 	}
 
+	//The multisig keys are only part of the hash if they are set, the hashes of other accTxs stay the same.
+	if tx.IsMultiSig() {
+		multiSigTxHash := struct {
+			Tx                interface{}
+			MultiSigKeys      [][64]byte
+			MultiSigThreshold uint8
+		}{
+			txHash,
+			tx.MultiSigKeys,
+			tx.MultiSigThreshold,
+		}
+
+		return SerializeHashContent(multiSigTxHash)
+	}
+
 	return SerializeHashContent(txHash)
 }
 
@@ -96,11 +141,15 @@ func (tx *AccTx) Encode() []byte {
 	}
 
 	encoded := AccTx{
-		Header: tx.Header,
-		Issuer: tx.Issuer,
-		Fee:    tx.Fee,
-		PubKey: tx.PubKey,
-		Sig:    tx.Sig,
+		Header:            tx.Header,
+		Issuer:            tx.Issuer,
+		Fee:               tx.Fee,
+		PubKey:            tx.PubKey,
+		Sig:               tx.Sig,
+		Contract:          tx.Contract,
+		ContractVariables: tx.ContractVariables,
+		MultiSigKeys:      tx.MultiSigKeys,
+		MultiSigThreshold: tx.MultiSigThreshold,
 	}
 
 	buffer := new(bytes.Buffer)
@@ -118,7 +167,22 @@ func (*AccTx) Decode(encoded []byte) (tx *AccTx) {
 
 func (tx *AccTx) TxFee() uint64 { return tx.Fee }
 
-func (tx *AccTx) Size() uint64 { return ACCTX_SIZE }
+func (tx *AccTx) Size() uint64 {
+	if tx.IsMultiSig() {
+		return ACCTX_SIZE + 1 + uint64(len(tx.MultiSigKeys))*MULTISIG_KEY_SIZE
+	}
+
+	return ACCTX_SIZE
+}
+
+//Returns the header without the sig2 bit.
+func (tx *AccTx) BaseHeader() byte {
+	return tx.Header &^ ACCTX_SIG2_HEADER
+}
+
+func (tx *AccTx) IsMultiSig() bool {
+	return len(tx.MultiSigKeys) > 0 || tx.MultiSigThreshold != 0
+}
 
 func (tx AccTx) String() string {
 	return fmt.Sprintf(
@@ -129,7 +193,8 @@ func (tx AccTx) String() string {
 			"PubKey: %x\n"+
 			"Sig: %x\n"+
 			"Contract: %v\n"+
-			"ContractVariables: %v\n",
+			"ContractVariables: %v\n"+
+			"MultiSig: %v of %v\n",
 		tx.Header,
 		tx.Issuer[0:8],
 		tx.Fee,
@@ -137,5 +202,7 @@ func (tx AccTx) String() string {
 		tx.Sig[0:8],
 		tx.Contract[:],
 		tx.ContractVariables[:],
+		tx.MultiSigThreshold,
+		len(tx.MultiSigKeys),
 	)
 }
@@ -110,6 +110,16 @@ func TestAccTxSerialization(t *testing.T) {
 	if !reflect.DeepEqual(tx, decodedTx) {
 		t.Errorf("AccTx serialization failed: %v vs. %v\n", tx, decodedTx)
 	}
+
+	//The contract is part of the hash, other nodes need it to validate the tx.
+	tx, _, _ = ConstrAccTx(0, fee, accA.Address, RootPrivKey, []byte{35, 29, 0, 4, 27, 0, 50}, [][]byte{{0, 2}})
+
+	encodedTx = tx.Encode()
+	decodedTx = decodedTx.Decode(encodedTx)
+
+	if !reflect.DeepEqual(tx, decodedTx) || tx.Hash() != decodedTx.Hash() {
+		t.Errorf("AccTx serialization failed: %v vs. %v\n", tx, decodedTx)
+	}
 }
 
 func getAddressFromPubKey(pubKey *ecdsa.PublicKey) (address [64]byte) {
@@ -117,4 +127,20 @@ func getAddressFromPubKey(pubKey *ecdsa.PublicKey) (address [64]byte) {
 	copy(address[32:], pubKey.Y.Bytes())
 
 	return address
-}
\ No newline at end of file
+}
+func TestMultiSigAccTxSerialization(t *testing.T) {
+	keys := [][64]byte{accA.Address, accB.Address}
+	tx, _ := ConstrMultiSigAccTx(1, keys, 2, RootPrivKey)
+	if tx.Header != ACCTX_MULTISIG_HEADER || tx.PubKey != MultiSigAddress(keys, 2) || !tx.IsMultiSig() {
+		t.Errorf("Multisig AccTx has not been created correctly: %v\n", tx)
+	}
+	if tx.PubKey == MultiSigAddress(keys, 1) || tx.Size() != ACCTX_SIZE+1+2*MULTISIG_KEY_SIZE {
+		t.Error("Multisig address or size does not depend on the keys and threshold.\n")
+	}
+
+	var decodedTx *AccTx
+	decodedTx = decodedTx.Decode(tx.Encode())
+	if !reflect.DeepEqual(tx, decodedTx) || decodedTx.Hash() != tx.Hash() {
+		t.Errorf("Multisig AccTx Serialization failed (%v) vs. (%v)\n", tx, decodedTx)
+	}
+}
@@ -0,0 +1,198 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+)
+
+const (
+	//Size without the payments
+	BATCHTX_SIZE         = 173
+	BATCHTX_PAYMENT_SIZE = 40
+	MAX_BATCHTX_PAYMENTS = 1000
+	//Additional size of a batchTx with an expiry height
+	BATCHTX_EXPIRY_SIZE = 4
+)
+
+//A batchTx pays many recipients from one sender. It uses the txCnt of the sender like a fundsTx and needs to be signed
+//by the sender (Sig1) and the multisig server (Sig2) only once.
+
+type BatchPayment struct {
+	To     [32]byte
+	Amount uint64
+}
+
+type BatchTx struct {
+	Header   byte
+	Fee      uint64
+	TxCnt    uint32
+	From     [32]byte
+	Payments []BatchPayment
+	Sig1     [64]byte
+	Sig2     [64]byte
+	//Optional expiry, the tx can only be included in blocks up to (and including) ExpiryHeight.
+	ExpiryHeight uint32
+	//Signatures of a multisig sender, Sig1 is not used in this case. Not part of the hash.
+	MultiSigs [][64]byte
+}
+
+func ConstrBatchTx(header byte, fee uint64, txCnt uint32, from [32]byte, payments []BatchPayment, expiryHeight uint32, sig1Key *ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey) (tx *BatchTx, err error) {
+	tx = new(BatchTx)
+
+	tx.Header = header
+	tx.Fee = fee
+	tx.TxCnt = txCnt
+	tx.From = from
+	tx.Payments = payments
+	tx.ExpiryHeight = expiryHeight
+
+	txHash := tx.Hash()
+
+	r, s, err := ecdsa.Sign(rand.Reader, sig1Key, txHash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	copy(tx.Sig1[32-len(r.Bytes()):32], r.Bytes())
+	copy(tx.Sig1[64-len(s.Bytes()):], s.Bytes())
+
+	if sig2Key != nil {
+		r, s, err := ecdsa.Sign(rand.Reader, sig2Key, txHash[:])
+		if err != nil {
+			return nil, err
+		}
+
+		copy(tx.Sig2[32-len(r.Bytes()):32], r.Bytes())
+		copy(tx.Sig2[64-len(s.Bytes()):], s.Bytes())
+	}
+
+	return tx, nil
+}
+
+//Creates a batchTx of a multisig account, it is signed with each of the given keys.
+func ConstrMultiSigBatchTx(header byte, fee uint64, txCnt uint32, from [32]byte, payments []BatchPayment, expiryHeight uint32, multiSigKeys []*ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey) (tx *BatchTx, err error) {
+	tx = new(BatchTx)
+
+	tx.Header = header
+	tx.Fee = fee
+	tx.TxCnt = txCnt
+	tx.From = from
+	tx.Payments = payments
+	tx.ExpiryHeight = expiryHeight
+
+	txHash := tx.Hash()
+
+	for _, key := range multiSigKeys {
+		sig, err := signHash(key, txHash)
+		if err != nil {
+			return nil, err
+		}
+		tx.MultiSigs = append(tx.MultiSigs, sig)
+	}
+
+	if sig2Key != nil {
+		if tx.Sig2, err = signHash(sig2Key, txHash); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+func (tx *BatchTx) Hash() (hash [32]byte) {
+	if tx == nil {
+		return [32]byte{}
+	}
+
+	txHash := struct {
+		Header       byte
+		Fee          uint64
+		TxCnt        uint32
+		From         [32]byte
+		Payments     []BatchPayment
+		ExpiryHeight uint32
+	}{
+		tx.Header,
+		tx.Fee,
+		tx.TxCnt,
+		tx.From,
+		tx.Payments,
+		tx.ExpiryHeight,
+	}
+
+	return SerializeHashContent(txHash)
+}
+
+//Sum of all payments, without the fee.
+func (tx *BatchTx) TotalAmount() (total uint64) {
+	for _, payment := range tx.Payments {
+		total += payment.Amount
+	}
+
+	return total
+}
+
+func (tx *BatchTx) Encode() (encodedTx []byte) {
+	encodeData := BatchTx{
+		Header:       tx.Header,
+		Fee:          tx.Fee,
+		TxCnt:        tx.TxCnt,
+		From:         tx.From,
+		Payments:     tx.Payments,
+		Sig1:         tx.Sig1,
+		Sig2:         tx.Sig2,
+		ExpiryHeight: tx.ExpiryHeight,
+		MultiSigs:    tx.MultiSigs,
+	}
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(encodeData)
+	return buffer.Bytes()
+}
+
+func (*BatchTx) Decode(encodedTx []byte) *BatchTx {
+	var decoded BatchTx
+	buffer := bytes.NewBuffer(encodedTx)
+	decoder := gob.NewDecoder(buffer)
+	decoder.Decode(&decoded)
+	return &decoded
+}
+
+func (tx *BatchTx) TxFee() uint64 { return tx.Fee }
+
+func (tx *BatchTx) Size() (size uint64) {
+	size = BATCHTX_SIZE + uint64(len(tx.Payments))*BATCHTX_PAYMENT_SIZE
+	if tx.ExpiryHeight != 0 {
+		size += BATCHTX_EXPIRY_SIZE
+	}
+	size += uint64(len(tx.MultiSigs)) * MULTISIG_SIG_SIZE
+
+	return size
+}
+
+func (tx BatchTx) String() string {
+	return fmt.Sprintf(
+		"\nHeader: %v\n"+
+			"Fee: %v\n"+
+			"TxCnt: %v\n"+
+			"From: %x\n"+
+			"Payments: %v\n"+
+			"Total amount: %v\n"+
+			"Sig1: %x\n"+
+			"Sig2: %x\n"+
+			"ExpiryHeight: %v\n"+
+			"MultiSigs: %v\n",
+		tx.Header,
+		tx.Fee,
+		tx.TxCnt,
+		tx.From[0:8],
+		len(tx.Payments),
+		tx.TotalAmount(),
+		tx.Sig1[0:8],
+		tx.Sig2[0:8],
+		tx.ExpiryHeight,
+		len(tx.MultiSigs),
+	)
+}
@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBatchTxSerialization(t *testing.T) {
+	rand := rand.New(rand.NewSource(time.Now().Unix()))
+	accAHash := SerializeHashContent(accA.Address)
+	accBHash := SerializeHashContent(accB.Address)
+
+	var payments []BatchPayment
+	for i := 0; i < int(rand.Uint32()%100)+1; i++ {
+		payments = append(payments, BatchPayment{accBHash, rand.Uint64()%100000 + 1})
+	}
+
+	tx, _ := ConstrBatchTx(0x01, rand.Uint64()%10+1, rand.Uint32(), accAHash, payments, 0, PrivKeyA, PrivKeyA)
+	var decodedTx *BatchTx
+	decodedTx = decodedTx.Decode(tx.Encode())
+
+	if !reflect.DeepEqual(tx, decodedTx) {
+		t.Errorf("BatchTx Serialization failed (%v) vs. (%v)\n", tx, decodedTx)
+	}
+
+	if tx.Size() != BATCHTX_SIZE+uint64(len(payments))*BATCHTX_PAYMENT_SIZE {
+		t.Errorf("Wrong BatchTx size: %v\n", tx.Size())
+	}
+}
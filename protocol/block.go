@@ -12,9 +12,9 @@ import (
 const (
 	HASH_LEN                = 32
 	HEIGHT_LEN				= 4
-	//All fixed sizes form the Block struct are 254
-	MIN_BLOCKSIZE           = 254 + crypto.COMM_PROOF_LENGTH
-	MIN_BLOCKHEADER_SIZE    = 104
+	//All fixed sizes form the Block struct are 322
+	MIN_BLOCKSIZE           = 322 + crypto.COMM_PROOF_LENGTH
+	MIN_BLOCKHEADER_SIZE    = 168
 	BLOOM_FILTER_ERROR_RATE = 0.1
 )
 
@@ -28,6 +28,8 @@ type Block struct {
 	BloomFilter  *bloom.BloomFilter
 	Height       uint32
 	Beneficiary  [32]byte
+	StateRoot    [32]byte //Root of the state tree after applying the block
+	ReceiptsRoot [32]byte //Root of the receipts of all txs of the block
 
 	//Body
 	Nonce                 [8]byte
@@ -36,16 +38,21 @@ type Block struct {
 	NrAccTx               uint16
 	NrFundsTx             uint16
 	NrStakeTx             uint16
+	NrBatchTx             uint16
+	NrKeyTx               uint16
 	SlashedAddress        [32]byte
 	CommitmentProof       [crypto.COMM_PROOF_LENGTH]byte
 	ConflictingBlockHash1 [32]byte
 	ConflictingBlockHash2 [32]byte
 	StateCopy             map[[32]byte]*Account //won't be serialized, just keeping track of local state changes
+	ContractGas           uint64                //won't be serialized, gas of the contract calls added to the block
 
 	AccTxData    [][32]byte
 	FundsTxData  [][32]byte
 	ConfigTxData [][32]byte
 	StakeTxData  [][32]byte
+	BatchTxData  [][32]byte
+	KeyTxData    [][32]byte
 }
 
 func NewBlock(prevHash [32]byte, height uint32) *Block {
@@ -68,6 +75,8 @@ func (block *Block) HashBlock() [32]byte {
 		prevHash              [32]byte
 		timestamp             int64
 		merkleRoot            [32]byte
+		stateRoot             [32]byte
+		receiptsRoot          [32]byte
 		beneficiary           [32]byte
 		commitmentProof       [crypto.COMM_PROOF_LENGTH]byte
 		slashedAddress        [32]byte
@@ -77,6 +86,8 @@ func (block *Block) HashBlock() [32]byte {
 		block.PrevHash,
 		block.Timestamp,
 		block.MerkleRoot,
+		block.StateRoot,
+		block.ReceiptsRoot,
 		block.Beneficiary,
 		block.CommitmentProof,
 		block.SlashedAddress,
@@ -117,7 +128,9 @@ func (block *Block) GetHeaderSize() uint64 {
 		reflect.TypeOf(block.NrConfigTx).Size() +
 		reflect.TypeOf(block.NrElementsBF).Size() +
 		reflect.TypeOf(block.Height).Size() +
-		reflect.TypeOf(block.Beneficiary).Size())
+		reflect.TypeOf(block.Beneficiary).Size() +
+		reflect.TypeOf(block.StateRoot).Size() +
+		reflect.TypeOf(block.ReceiptsRoot).Size())
 
 	size += int(block.GetBloomFilterSize())
 
@@ -131,6 +144,8 @@ func (block *Block) GetBodySize() uint64 {
 		reflect.TypeOf(block.NrAccTx).Size() +
 		reflect.TypeOf(block.NrFundsTx).Size() +
 		reflect.TypeOf(block.NrStakeTx).Size() +
+		reflect.TypeOf(block.NrBatchTx).Size() +
+		reflect.TypeOf(block.NrKeyTx).Size() +
 		reflect.TypeOf(block.SlashedAddress).Size() +
 		reflect.TypeOf(block.CommitmentProof).Size() +
 		reflect.TypeOf(block.ConflictingBlockHash1).Size() +
@@ -146,7 +161,9 @@ func (block *Block) GetTxDataSize() uint64 {
 	size := int(block.NrAccTx)*HASH_LEN +
 		int(block.NrFundsTx)*HASH_LEN +
 		int(block.NrConfigTx)*HASH_LEN +
-		int(block.NrStakeTx)*HASH_LEN
+		int(block.NrStakeTx)*HASH_LEN +
+		int(block.NrBatchTx)*HASH_LEN +
+		int(block.NrKeyTx)*HASH_LEN
 
 	return uint64(size)
 }
@@ -174,10 +191,14 @@ func (block *Block) Encode() []byte {
 		Timestamp:             block.Timestamp,
 		MerkleRoot:            block.MerkleRoot,
 		Beneficiary:           block.Beneficiary,
+		StateRoot:             block.StateRoot,
+		ReceiptsRoot:          block.ReceiptsRoot,
 		NrAccTx:               block.NrAccTx,
 		NrFundsTx:             block.NrFundsTx,
 		NrConfigTx:            block.NrConfigTx,
 		NrStakeTx:             block.NrStakeTx,
+		NrBatchTx:             block.NrBatchTx,
+		NrKeyTx:               block.NrKeyTx,
 		NrElementsBF:          block.NrElementsBF,
 		BloomFilter:           block.BloomFilter,
 		SlashedAddress:        block.SlashedAddress,
@@ -190,6 +211,8 @@ func (block *Block) Encode() []byte {
 		FundsTxData:  block.FundsTxData,
 		ConfigTxData: block.ConfigTxData,
 		StakeTxData:  block.StakeTxData,
+		BatchTxData:  block.BatchTxData,
+		KeyTxData:    block.KeyTxData,
 	}
 
 	buffer := new(bytes.Buffer)
@@ -211,6 +234,8 @@ func (block *Block) EncodeHeader() []byte {
 		BloomFilter:  block.BloomFilter,
 		Height:       block.Height,
 		Beneficiary:  block.Beneficiary,
+		StateRoot:    block.StateRoot,
+		ReceiptsRoot: block.ReceiptsRoot,
 	}
 
 	buffer := new(bytes.Buffer)
@@ -218,6 +243,46 @@ func (block *Block) EncodeHeader() []byte {
 	return buffer.Bytes()
 }
 
+//Returns the hashes of all txs in the order of the merkle tree leaves.
+func (block *Block) TxHashes() (txHashes [][32]byte) {
+	txHashes = append(txHashes, block.FundsTxData...)
+	txHashes = append(txHashes, block.AccTxData...)
+	txHashes = append(txHashes, block.ConfigTxData...)
+	txHashes = append(txHashes, block.StakeTxData...)
+	txHashes = append(txHashes, block.BatchTxData...)
+	txHashes = append(txHashes, block.KeyTxData...)
+
+	return txHashes
+}
+
+//Encodes a list of blocks, used to transfer ranges of blocks.
+func EncodeBlocks(blocks []*Block) []byte {
+	var encodedBlocks [][]byte
+	for _, block := range blocks {
+		encodedBlocks = append(encodedBlocks, block.Encode())
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(encodedBlocks)
+	return buffer.Bytes()
+}
+
+func DecodeBlocks(encoded []byte) (blocks []*Block) {
+	var encodedBlocks [][]byte
+	buffer := bytes.NewBuffer(encoded)
+	decoder := gob.NewDecoder(buffer)
+	if err := decoder.Decode(&encodedBlocks); err != nil {
+		return nil
+	}
+
+	var block *Block
+	for _, encodedBlock := range encodedBlocks {
+		blocks = append(blocks, block.Decode(encodedBlock))
+	}
+
+	return blocks
+}
+
 func (block *Block) Decode(encoded []byte) (b *Block) {
 	if encoded == nil {
 		return nil
@@ -236,11 +301,15 @@ func (block Block) String() string {
 		"Nonce: %x\n"+
 		"Timestamp: %v\n"+
 		"MerkleRoot: %x\n"+
+		"StateRoot: %x\n"+
+		"ReceiptsRoot: %x\n"+
 		"Beneficiary: %x\n"+
 		"Amount of fundsTx: %v --> %x\n"+
 		"Amount of accTx: %v --> %x\n"+
 		"Amount of configTx: %v --> %x\n"+
 		"Amount of stakeTx: %v --> %x\n"+
+		"Amount of batchTx: %v --> %x\n"+
+		"Amount of keyTx: %v --> %x\n"+
 		"Total Transactions in this block: %v\n"+
 		"Height: %d\n"+
 		"Commitment Proof: %x\n"+
@@ -252,12 +321,16 @@ func (block Block) String() string {
 		block.Nonce,
 		block.Timestamp,
 		block.MerkleRoot[0:8],
+		block.StateRoot[0:8],
+		block.ReceiptsRoot[0:8],
 		block.Beneficiary[0:8],
 		block.NrFundsTx, block.FundsTxData,
 		block.NrAccTx, block.AccTxData,
 		block.NrConfigTx, block.ConfigTxData,
 		block.NrStakeTx, block.StakeTxData,
-		uint16(block.NrFundsTx) + uint16(block.NrAccTx) + uint16(block.NrConfigTx) + uint16(block.NrStakeTx),
+		block.NrBatchTx, block.BatchTxData,
+		block.NrKeyTx, block.KeyTxData,
+		uint16(block.NrFundsTx) + uint16(block.NrAccTx) + uint16(block.NrConfigTx) + uint16(block.NrStakeTx) + uint16(block.NrBatchTx) + uint16(block.NrKeyTx),
 		block.Height,
 		block.CommitmentProof[0:8],
 		block.SlashedAddress[0:8],
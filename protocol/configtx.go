@@ -21,6 +21,8 @@ const (
 	ACCEPTANCE_TIME_DIFF_ID = 8
 	SLASHING_WINDOW_SIZE_ID = 9
 	SLASHING_REWARD_ID      = 10
+	MULTISIG_REQUIRED_ID    = 11
+	BLOCK_GAS_LIMIT_ID      = 12
 
 	MIN_BLOCK_SIZE = 1000      //1KB
 	MAX_BLOCK_SIZE = 100000000 //100MB
@@ -51,6 +53,12 @@ const (
 
 	MIN_SLASHING_REWARD = 0                   // reward for providing a valid slashing proof
 	MAX_SLASHING_REWARD = 1152921504606846976 //2^60
+
+	MIN_MULTISIG_REQUIRED = 0 //the co-signature of the multisig server is only required by accounts asking for it
+	MAX_MULTISIG_REQUIRED = 1 //the co-signature of the multisig server is required for all fundsTxs and batchTxs
+
+	MIN_BLOCK_GAS_LIMIT = 1000                //gas all contract calls of a block may use together
+	MAX_BLOCK_GAS_LIMIT = 1152921504606846976 //2^60
 )
 
 type ConfigTx struct {
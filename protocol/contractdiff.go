@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+//The contract calls made by the txs of a block. For every contract call, the changes that revert it are recorded in
+//the order the calls have been applied, so a rolled back block restores the contract variables exactly. The outcome
+//of the calls is recorded as well, it is needed for the receipts of the block.
+type ContractDiff struct {
+	Calls []ContractCallDiff
+}
+
+type ContractCallDiff struct {
+	TxHash        [32]byte
+	Account       [32]byte
+	RevertChanges []Change
+	Failed        bool //A failed call has not changed any contract variables, the amount of the tx stays with the sender.
+	GasLimit      uint64 //The gas it consumed is not known, gas is not metered.
+}
+
+//Adding to a nil diff is a no-op.
+func (diff *ContractDiff) Add(call ContractCallDiff) {
+	if diff == nil {
+		return
+	}
+
+	diff.Calls = append(diff.Calls, call)
+}
+
+//Returns the call made by the given tx, nil if the tx has not called a contract.
+func (diff *ContractDiff) Call(txHash [32]byte) *ContractCallDiff {
+	if diff == nil {
+		return nil
+	}
+
+	for i := range diff.Calls {
+		if diff.Calls[i].TxHash == txHash {
+			return &diff.Calls[i]
+		}
+	}
+
+	return nil
+}
+
+//Removes and returns the last call if it has been made by the given tx.
+func (diff *ContractDiff) PopCall(txHash [32]byte) *ContractCallDiff {
+	if diff == nil || len(diff.Calls) == 0 || diff.Calls[len(diff.Calls)-1].TxHash != txHash {
+		return nil
+	}
+
+	call := diff.Calls[len(diff.Calls)-1]
+	diff.Calls = diff.Calls[:len(diff.Calls)-1]
+	return &call
+}
+
+func (diff *ContractDiff) IsEmpty() bool {
+	return diff == nil || len(diff.Calls) == 0
+}
+
+func (diff *ContractDiff) Encode() []byte {
+	if diff == nil {
+		return nil
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(diff)
+	return buffer.Bytes()
+}
+
+func (*ContractDiff) Decode(encoded []byte) *ContractDiff {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded ContractDiff
+	buffer := bytes.NewBuffer(encoded)
+	decoder := gob.NewDecoder(buffer)
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContractDiffSerialization(t *testing.T) {
+	diff := new(ContractDiff)
+	diff.Add(ContractCallDiff{[32]byte{1}, [32]byte{2}, []Change{NewChange(0, []byte{0, 2}), NewChange(2, []byte{0})}, false, 100})
+	diff.Add(ContractCallDiff{[32]byte{3}, [32]byte{2}, []Change{NewChange(1, []byte{7})}, false, 50})
+	diff.Add(ContractCallDiff{[32]byte{4}, [32]byte{2}, nil, true, 50})
+
+	var decodedDiff *ContractDiff
+	decodedDiff = decodedDiff.Decode(diff.Encode())
+
+	if !reflect.DeepEqual(diff, decodedDiff) {
+		t.Errorf("ContractDiff serialization failed: %v vs. %v\n", diff, decodedDiff)
+	}
+}
+
+func TestContractDiffPopCall(t *testing.T) {
+	diff := new(ContractDiff)
+	diff.Add(ContractCallDiff{[32]byte{1}, [32]byte{2}, []Change{NewChange(0, []byte{0, 2})}, false, 100})
+	diff.Add(ContractCallDiff{[32]byte{3}, [32]byte{2}, nil, true, 100})
+
+	//Failed calls are recorded as well, only the last call can be popped.
+	if len(diff.Calls) != 2 || diff.PopCall([32]byte{1}) != nil || diff.Call([32]byte{1}) == nil {
+		t.Errorf("Unexpected calls in the diff: %v\n", diff.Calls)
+	}
+
+	if call := diff.PopCall([32]byte{3}); call == nil || !call.Failed || diff.Call([32]byte{3}) != nil {
+		t.Errorf("Popping the failed call failed: %v\n", call)
+	}
+
+	if call := diff.PopCall([32]byte{1}); call == nil || call.Account != [32]byte{2} || !diff.IsEmpty() {
+		t.Errorf("Popping the call failed: %v\n", call)
+	}
+
+	var nilDiff *ContractDiff
+	nilDiff.Add(ContractCallDiff{[32]byte{1}, [32]byte{2}, []Change{NewChange(0, []byte{0, 2})}, false, 100})
+	if !nilDiff.IsEmpty() || nilDiff.PopCall([32]byte{1}) != nil || nilDiff.Call([32]byte{1}) != nil {
+		t.Error("Nil diff has recorded a call.")
+	}
+}
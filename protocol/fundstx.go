@@ -3,13 +3,17 @@ package protocol
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/rand"
 	"encoding/gob"
 	"fmt"
 )
 
 const (
 	FUNDSTX_SIZE = 213
+	//Additional sizes of a fundsTx with a lock or an expiry height
+	FUNDSTX_LOCK_SIZE   = 12
+	FUNDSTX_EXPIRY_SIZE = 4
+	//Additional size of a fundsTx with a gas limit
+	FUNDSTX_GAS_SIZE = 8
 )
 
 //when we broadcast transactions we need a way to distinguish with a type
@@ -24,9 +28,23 @@ type FundsTx struct {
 	Sig1   [64]byte
 	Sig2   [64]byte
 	Data   []byte
+	//Optional lock, the tx only becomes valid once the last block has reached LockHeight and LockTime.
+	LockHeight uint32
+	LockTime   int64
+	//Optional expiry, the tx can only be included in blocks up to (and including) ExpiryHeight.
+	ExpiryHeight uint32
+	//Signatures of a multisig sender, Sig1 is not used in this case. Not part of the hash.
+	MultiSigs [][64]byte
+	//Optional gas limit of a contract call, at most the fee. Without it, the fee is the limit. Only a cap, gas is not
+	//metered and the whole fee is charged.
+	GasLimit uint64
 }
 
 func ConstrFundsTx(header byte, amount uint64, fee uint64, txCnt uint32, from, to [32]byte, sig1Key *ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey, data []byte) (tx *FundsTx, err error) {
+	return ConstrTimeBoundFundsTx(header, amount, fee, txCnt, from, to, 0, 0, 0, sig1Key, sig2Key, data)
+}
+
+func ConstrTimeBoundFundsTx(header byte, amount uint64, fee uint64, txCnt uint32, from, to [32]byte, lockHeight uint32, lockTime int64, expiryHeight uint32, sig1Key *ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey, data []byte) (tx *FundsTx, err error) {
 	tx = new(FundsTx)
 
 	tx.Header = header
@@ -36,25 +54,79 @@ func ConstrFundsTx(header byte, amount uint64, fee uint64, txCnt uint32, from, t
 	tx.Fee = fee
 	tx.TxCnt = txCnt
 	tx.Data = data
+	tx.LockHeight = lockHeight
+	tx.LockTime = lockTime
+	tx.ExpiryHeight = expiryHeight
 
 	txHash := tx.Hash()
 
-	r, s, err := ecdsa.Sign(rand.Reader, sig1Key, txHash[:])
-	if err != nil {
+	if tx.Sig1, err = signHash(sig1Key, txHash); err != nil {
 		return nil, err
 	}
 
-	copy(tx.Sig1[32-len(r.Bytes()):32], r.Bytes())
-	copy(tx.Sig1[64-len(s.Bytes()):], s.Bytes())
+	if sig2Key != nil {
+		if tx.Sig2, err = signHash(sig2Key, txHash); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+//Creates a fundsTx calling the contract of the receiver, the execution of the contract may use at most gasLimit gas.
+func ConstrContractCallTx(header byte, amount uint64, fee uint64, gasLimit uint64, txCnt uint32, from, to [32]byte, sig1Key *ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey, data []byte) (tx *FundsTx, err error) {
+	tx = new(FundsTx)
+
+	tx.Header = header
+	tx.From = from
+	tx.To = to
+	tx.Amount = amount
+	tx.Fee = fee
+	tx.TxCnt = txCnt
+	tx.Data = data
+	tx.GasLimit = gasLimit
+
+	txHash := tx.Hash()
+
+	if tx.Sig1, err = signHash(sig1Key, txHash); err != nil {
+		return nil, err
+	}
 
 	if sig2Key != nil {
-		r, s, err := ecdsa.Sign(rand.Reader, sig2Key, txHash[:])
+		if tx.Sig2, err = signHash(sig2Key, txHash); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+//Creates a fundsTx of a multisig account, it is signed with each of the given keys.
+func ConstrMultiSigFundsTx(header byte, amount uint64, fee uint64, txCnt uint32, from, to [32]byte, multiSigKeys []*ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey, data []byte) (tx *FundsTx, err error) {
+	tx = new(FundsTx)
+
+	tx.Header = header
+	tx.From = from
+	tx.To = to
+	tx.Amount = amount
+	tx.Fee = fee
+	tx.TxCnt = txCnt
+	tx.Data = data
+
+	txHash := tx.Hash()
+
+	for _, key := range multiSigKeys {
+		sig, err := signHash(key, txHash)
 		if err != nil {
 			return nil, err
 		}
+		tx.MultiSigs = append(tx.MultiSigs, sig)
+	}
 
-		copy(tx.Sig2[32-len(r.Bytes()):32], r.Bytes())
-		copy(tx.Sig2[64-len(s.Bytes()):], s.Bytes())
+	if sig2Key != nil {
+		if tx.Sig2, err = signHash(sig2Key, txHash); err != nil {
+			return nil, err
+		}
 	}
 
 	return tx, nil
@@ -84,7 +156,53 @@ func (tx *FundsTx) Hash() (hash [32]byte) {
 		tx.Data,
 	}
 
-	return SerializeHashContent(txHash)
+	var hashContent interface{} = txHash
+
+	//The lock and the expiry are only part of the hash if one of them is set, the hashes of other txs stay the same.
+	if tx.IsLocked() || tx.ExpiryHeight != 0 {
+		hashContent = struct {
+			Tx           interface{}
+			LockHeight   uint32
+			LockTime     int64
+			ExpiryHeight uint32
+		}{
+			hashContent,
+			tx.LockHeight,
+			tx.LockTime,
+			tx.ExpiryHeight,
+		}
+	}
+
+	//Same for the gas limit.
+	if tx.GasLimit != 0 {
+		hashContent = struct {
+			Tx       interface{}
+			GasLimit uint64
+		}{
+			hashContent,
+			tx.GasLimit,
+		}
+	}
+
+	return SerializeHashContent(hashContent)
+}
+
+//Gas available to the contract called by the tx.
+func (tx *FundsTx) Gas() uint64 {
+	if tx.GasLimit != 0 {
+		return tx.GasLimit
+	}
+
+	return tx.Fee
+}
+
+func (tx *FundsTx) IsLocked() bool {
+	return tx.LockHeight != 0 || tx.LockTime != 0
+}
+
+//Returns true if the lock is satisfied by the last block, i.e., the tx can be added to the block following it.
+func (tx *FundsTx) IsUnlocked(lastHeight uint32, lastTimestamp int64) bool {
+	return lastHeight >= tx.LockHeight && lastTimestamp >= tx.LockTime
 }
 
 //when we serialize the struct with binary.Write, unexported field get serialized as well, undesired
@@ -92,15 +210,20 @@ func (tx *FundsTx) Hash() (hash [32]byte) {
 func (tx *FundsTx) Encode() (encodedTx []byte) {
 	// Encode
 	encodeData := FundsTx{
-		Header: tx.Header,
-		Amount: tx.Amount,
-		Fee:    tx.Fee,
-		TxCnt:  tx.TxCnt,
-		From:   tx.From,
-		To:     tx.To,
-		Sig1:   tx.Sig1,
-		Sig2:   tx.Sig2,
-		Data:   tx.Data,
+		Header:       tx.Header,
+		Amount:       tx.Amount,
+		Fee:          tx.Fee,
+		TxCnt:        tx.TxCnt,
+		From:         tx.From,
+		To:           tx.To,
+		Sig1:         tx.Sig1,
+		Sig2:         tx.Sig2,
+		Data:         tx.Data,
+		LockHeight:   tx.LockHeight,
+		LockTime:     tx.LockTime,
+		ExpiryHeight: tx.ExpiryHeight,
+		MultiSigs:    tx.MultiSigs,
+		GasLimit:     tx.GasLimit,
 	}
 	buffer := new(bytes.Buffer)
 	gob.NewEncoder(buffer).Encode(encodeData)
@@ -116,7 +239,21 @@ func (*FundsTx) Decode(encodedTx []byte) *FundsTx {
 }
 
 func (tx *FundsTx) TxFee() uint64 { return tx.Fee }
-func (tx *FundsTx) Size() uint64  { return FUNDSTX_SIZE }
+func (tx *FundsTx) Size() (size uint64) {
+	size = FUNDSTX_SIZE
+	if tx.IsLocked() {
+		size += FUNDSTX_LOCK_SIZE
+	}
+	if tx.ExpiryHeight != 0 {
+		size += FUNDSTX_EXPIRY_SIZE
+	}
+	if tx.GasLimit != 0 {
+		size += FUNDSTX_GAS_SIZE
+	}
+	size += uint64(len(tx.MultiSigs)) * MULTISIG_SIG_SIZE
+
+	return size
+}
 
 func (tx FundsTx) String() string {
 	return fmt.Sprintf(
@@ -128,7 +265,12 @@ func (tx FundsTx) String() string {
 			"To: %x\n"+
 			"Sig1: %x\n"+
 			"Sig2: %x\n"+
-			"Data: %v\n",
+			"Data: %v\n"+
+			"LockHeight: %v\n"+
+			"LockTime: %v\n"+
+			"ExpiryHeight: %v\n"+
+			"MultiSigs: %v\n"+
+			"GasLimit: %v\n",
 		tx.Header,
 		tx.Amount,
 		tx.Fee,
@@ -138,5 +280,10 @@ func (tx FundsTx) String() string {
 		tx.Sig1[0:8],
 		tx.Sig2[0:8],
 		tx.Data,
+		tx.LockHeight,
+		tx.LockTime,
+		tx.ExpiryHeight,
+		len(tx.MultiSigs),
+		tx.GasLimit,
 	)
 }
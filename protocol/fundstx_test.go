@@ -27,3 +27,62 @@ func TestFundsTxSerialization(t *testing.T) {
 		}
 	}
 }
+
+func TestLockedFundsTxSerialization(t *testing.T) {
+	accAHash := SerializeHashContent(accA.Address)
+	accBHash := SerializeHashContent(accB.Address)
+
+	tx, _ := ConstrFundsTx(0x01, 100, 1, 0, accAHash, accBHash, PrivKeyA, PrivKeyA, nil)
+	lockedTx, _ := ConstrTimeBoundFundsTx(0x01, 100, 1, 0, accAHash, accBHash, 10, 1000, 0, PrivKeyA, PrivKeyA, nil)
+	if tx.IsLocked() || !lockedTx.IsLocked() || tx.Hash() == lockedTx.Hash() {
+		t.Error("The lock is not part of the tx hash.\n")
+	}
+	if lockedTx.Size() != FUNDSTX_SIZE+FUNDSTX_LOCK_SIZE {
+		t.Errorf("Wrong size of a locked tx: %v\n", lockedTx.Size())
+	}
+
+	var decodedTx *FundsTx
+	decodedTx = decodedTx.Decode(lockedTx.Encode())
+	if !reflect.DeepEqual(lockedTx, decodedTx) {
+		t.Errorf("FundsTx Serialization failed (%v) vs. (%v)\n", lockedTx, decodedTx)
+	}
+
+	if decodedTx.IsUnlocked(9, 1000) || decodedTx.IsUnlocked(10, 999) || !decodedTx.IsUnlocked(10, 1000) {
+		t.Error("Lock is not checked against both the height and the timestamp.\n")
+	}
+}
+
+func TestFundsTxExpiry(t *testing.T) {
+	accAHash := SerializeHashContent(accA.Address)
+	accBHash := SerializeHashContent(accB.Address)
+
+	tx, _ := ConstrFundsTx(0x01, 100, 1, 0, accAHash, accBHash, PrivKeyA, PrivKeyA, nil)
+	expiringTx, _ := ConstrTimeBoundFundsTx(0x01, 100, 1, 0, accAHash, accBHash, 0, 0, 10, PrivKeyA, PrivKeyA, nil)
+	if expiringTx.IsLocked() || tx.Hash() == expiringTx.Hash() || expiringTx.Size() != FUNDSTX_SIZE+FUNDSTX_EXPIRY_SIZE {
+		t.Error("The expiry height is not part of the tx.\n")
+	}
+
+	if IsExpired(tx, 100) || IsExpired(expiringTx, 10) || !IsExpired(expiringTx, 11) {
+		t.Error("Expiry height is not checked correctly.\n")
+	}
+}
+
+func TestFundsTxGasLimit(t *testing.T) {
+	accAHash := SerializeHashContent(accA.Address)
+	accBHash := SerializeHashContent(accB.Address)
+
+	tx, _ := ConstrFundsTx(0x01, 100, 1000, 0, accAHash, accBHash, PrivKeyA, PrivKeyA, []byte{1})
+	callTx, _ := ConstrContractCallTx(0x01, 100, 1000, 500, 0, accAHash, accBHash, PrivKeyA, PrivKeyA, []byte{1})
+	if tx.Hash() == callTx.Hash() || callTx.Size() != FUNDSTX_SIZE+FUNDSTX_GAS_SIZE {
+		t.Error("The gas limit is not part of the tx.\n")
+	}
+	if tx.Gas() != 1000 || callTx.Gas() != 500 {
+		t.Errorf("Wrong gas: %v (without gas limit) vs. %v (with gas limit)\n", tx.Gas(), callTx.Gas())
+	}
+
+	var decodedTx *FundsTx
+	decodedTx = decodedTx.Decode(callTx.Encode())
+	if !reflect.DeepEqual(callTx, decodedTx) {
+		t.Errorf("FundsTx Serialization failed (%v) vs. (%v)\n", callTx, decodedTx)
+	}
+}
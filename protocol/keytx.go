@@ -0,0 +1,125 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"fmt"
+)
+
+const (
+	KEYTX_SIZE = 301
+)
+
+//A keyTx rotates the signing key of an account. The account keeps its address (and hence its hash), only the key
+//that signs its txs changes. It uses the txCnt of the account like a fundsTx and is signed with the current key (Sig),
+//which is also part of the tx (OldKey) to be able to roll it back. Like a fundsTx, it needs the co-signature of the
+//multisig server (Sig2) if the system parameter or the account requires it.
+
+type KeyTx struct {
+	Header  byte
+	Fee     uint64
+	TxCnt   uint32
+	Account [32]byte
+	OldKey  [64]byte
+	NewKey  [64]byte
+	Sig     [64]byte
+	Sig2    [64]byte
+}
+
+func ConstrKeyTx(header byte, fee uint64, txCnt uint32, account [32]byte, oldKey, newKey [64]byte, signKey *ecdsa.PrivateKey, sig2Key *ecdsa.PrivateKey) (tx *KeyTx, err error) {
+	tx = new(KeyTx)
+
+	tx.Header = header
+	tx.Fee = fee
+	tx.TxCnt = txCnt
+	tx.Account = account
+	tx.OldKey = oldKey
+	tx.NewKey = newKey
+
+	txHash := tx.Hash()
+
+	if tx.Sig, err = signHash(signKey, txHash); err != nil {
+		return nil, err
+	}
+
+	if sig2Key != nil {
+		if tx.Sig2, err = signHash(sig2Key, txHash); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+func (tx *KeyTx) Hash() (hash [32]byte) {
+	if tx == nil {
+		return [32]byte{}
+	}
+
+	txHash := struct {
+		Header  byte
+		Fee     uint64
+		TxCnt   uint32
+		Account [32]byte
+		OldKey  [64]byte
+		NewKey  [64]byte
+	}{
+		tx.Header,
+		tx.Fee,
+		tx.TxCnt,
+		tx.Account,
+		tx.OldKey,
+		tx.NewKey,
+	}
+
+	return SerializeHashContent(txHash)
+}
+
+func (tx *KeyTx) Encode() (encodedTx []byte) {
+	encodeData := KeyTx{
+		Header:  tx.Header,
+		Fee:     tx.Fee,
+		TxCnt:   tx.TxCnt,
+		Account: tx.Account,
+		OldKey:  tx.OldKey,
+		NewKey:  tx.NewKey,
+		Sig:     tx.Sig,
+		Sig2:    tx.Sig2,
+	}
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(encodeData)
+	return buffer.Bytes()
+}
+
+func (*KeyTx) Decode(encodedTx []byte) *KeyTx {
+	var decoded KeyTx
+	buffer := bytes.NewBuffer(encodedTx)
+	decoder := gob.NewDecoder(buffer)
+	decoder.Decode(&decoded)
+	return &decoded
+}
+
+func (tx *KeyTx) TxFee() uint64 { return tx.Fee }
+func (tx *KeyTx) Size() uint64  { return KEYTX_SIZE }
+
+func (tx KeyTx) String() string {
+	return fmt.Sprintf(
+		"\nHeader: %v\n"+
+			"Fee: %v\n"+
+			"TxCnt: %v\n"+
+			"Account: %x\n"+
+			"OldKey: %x\n"+
+			"NewKey: %x\n"+
+			"Sig: %x\n"+
+			"Sig2: %x\n",
+		tx.Header,
+		tx.Fee,
+		tx.TxCnt,
+		tx.Account[0:8],
+		tx.OldKey[0:8],
+		tx.NewKey[0:8],
+		tx.Sig[0:8],
+		tx.Sig2[0:8],
+	)
+}
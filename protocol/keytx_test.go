@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeyTxSerialization(t *testing.T) {
+	rand := rand.New(rand.NewSource(time.Now().Unix()))
+	accAHash := SerializeHashContent(accA.Address)
+
+	tx, _ := ConstrKeyTx(0x01, rand.Uint64()%10+1, rand.Uint32(), accAHash, accA.Address, accB.Address, PrivKeyA, PrivKeyA)
+	var decodedTx *KeyTx
+	decodedTx = decodedTx.Decode(tx.Encode())
+
+	if !reflect.DeepEqual(tx, decodedTx) {
+		t.Errorf("KeyTx Serialization failed (%v) vs. (%v)\n", tx, decodedTx)
+	}
+}
+
+func TestAccountPubKey(t *testing.T) {
+	acc := NewAccount(accA.Address, [32]byte{}, 100, false, accA.CommitmentKey, nil, nil)
+	accHash, stateHash := acc.Hash(), acc.StateHash()
+
+	acc.SetPubKey(accB.Address)
+	if acc.PubKey() != accB.Address || acc.Hash() != accHash || acc.StateHash() == stateHash {
+		t.Errorf("Rotating the key failed: %v\n", acc)
+	}
+
+	//Setting the address again restores the original account.
+	acc.SetPubKey(accA.Address)
+	if acc.PubKey() != accA.Address || acc.SigningKey != [64]byte{} || acc.StateHash() != stateHash {
+		t.Errorf("Restoring the key failed: %v\n", acc)
+	}
+}
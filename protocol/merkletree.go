@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bytes"
+	"encoding/gob"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/sha3"
@@ -68,6 +69,18 @@ func BuildMerkleTree(b *Block) *MerkleTree {
 		}
 	}
 
+	if b.BatchTxData != nil {
+		for _, txHash := range b.BatchTxData {
+			txHashes = append(txHashes, txHash)
+		}
+	}
+
+	if b.KeyTxData != nil {
+		for _, txHash := range b.KeyTxData {
+			txHashes = append(txHashes, txHash)
+		}
+	}
+
 	//Merkle root for no transactions is 0 hash
 	if len(txHashes) == 0 {
 		return nil
@@ -217,3 +230,62 @@ func (m *MerkleTree) String() string {
 	}
 	return s
 }
+
+//TxProof links a closed tx to the block that included it. The header is the block without tx hashes, Index is the
+//position of the tx in the merkle tree leaves and Intermediates are the nodes returned by GetIntermediate.
+type TxProof struct {
+	Tx            []byte
+	Header        *Block
+	Index         uint32
+	Intermediates [][32]byte
+}
+
+//Decodes the tx of the proof. The type follows from the position of the tx, since the leaves of the merkle tree are
+//ordered by tx type (see Block.TxHashes).
+func (proof *TxProof) Transaction() Transaction {
+	if proof == nil || proof.Header == nil {
+		return nil
+	}
+
+	index := int(proof.Index)
+	switch {
+	case index < int(proof.Header.NrFundsTx):
+		var tx *FundsTx
+		return tx.Decode(proof.Tx)
+	case index < int(proof.Header.NrFundsTx)+int(proof.Header.NrAccTx):
+		var tx *AccTx
+		return tx.Decode(proof.Tx)
+	case index < int(proof.Header.NrFundsTx)+int(proof.Header.NrAccTx)+int(proof.Header.NrConfigTx):
+		var tx *ConfigTx
+		return tx.Decode(proof.Tx)
+	case index < int(proof.Header.NrFundsTx)+int(proof.Header.NrAccTx)+int(proof.Header.NrConfigTx)+int(proof.Header.NrStakeTx):
+		var tx *StakeTx
+		return tx.Decode(proof.Tx)
+	case index < int(proof.Header.NrFundsTx)+int(proof.Header.NrAccTx)+int(proof.Header.NrConfigTx)+int(proof.Header.NrStakeTx)+int(proof.Header.NrBatchTx):
+		var tx *BatchTx
+		return tx.Decode(proof.Tx)
+	case index < int(proof.Header.NrFundsTx)+int(proof.Header.NrAccTx)+int(proof.Header.NrConfigTx)+int(proof.Header.NrStakeTx)+int(proof.Header.NrBatchTx)+int(proof.Header.NrKeyTx):
+		var tx *KeyTx
+		return tx.Decode(proof.Tx)
+	}
+
+	return nil
+}
+
+func (proof *TxProof) Encode() []byte {
+	if proof == nil {
+		return nil
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(proof)
+	return buffer.Bytes()
+}
+
+func (*TxProof) Decode(encoded []byte) (proof *TxProof) {
+	var decoded TxProof
+	buffer := bytes.NewBuffer(encoded)
+	decoder := gob.NewDecoder(buffer)
+	decoder.Decode(&decoded)
+	return &decoded
+}
@@ -392,3 +392,25 @@ func TestGetIntermediate(t *testing.T) {
 		t.Errorf("Hashes don't match: %x != %x\n", intermediates[4].Hash, hash12345678)
 	}
 }
+
+func TestTxProofTransaction(t *testing.T) {
+	fundsTx, _ := ConstrFundsTx(0, 10, 1, 0, [32]byte{'1'}, [32]byte{'2'}, PrivKeyA, PrivKeyA, nil)
+	configTx, _ := ConstrConfigTx(0, 1, 100, 1, 0, RootPrivKey)
+
+	header := Block{NrFundsTx: 2, NrConfigTx: 1}
+
+	proof := TxProof{Tx: fundsTx.Encode(), Header: &header, Index: 1}
+	if tx, ok := proof.Transaction().(*FundsTx); !ok || tx.Hash() != fundsTx.Hash() {
+		t.Errorf("FundsTx could not be decoded from the proof: %v\n", proof.Transaction())
+	}
+
+	proof = TxProof{Tx: configTx.Encode(), Header: &header, Index: 2}
+	if tx, ok := proof.Transaction().(*ConfigTx); !ok || tx.Hash() != configTx.Hash() {
+		t.Errorf("ConfigTx could not be decoded from the proof: %v\n", proof.Transaction())
+	}
+
+	proof.Index = 3
+	if proof.Transaction() != nil {
+		t.Error("Tx decoded from a position outside of the block.\n")
+	}
+}
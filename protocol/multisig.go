@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+)
+
+const (
+	//AccTx header of a new M-of-N multisig account (third bit set)
+	ACCTX_MULTISIG_HEADER = 0x04
+	MAX_MULTISIG_KEYS     = 16
+	MULTISIG_KEY_SIZE     = 64
+	MULTISIG_SIG_SIZE     = 64
+)
+
+//A multisig account holds N public keys and a threshold M, spends need valid signatures of M of these keys. Its
+//address is derived from the keys and the threshold, it is not a public key itself and can therefore not be used
+//to sign a tx on its own.
+func MultiSigAddress(keys [][64]byte, threshold uint8) (address [64]byte) {
+	content := struct {
+		Keys      [][64]byte
+		Threshold uint8
+	}{
+		keys,
+		threshold,
+	}
+
+	keysHash := SerializeHashContent(content)
+	addressHash := SerializeHashContent(keysHash)
+	copy(address[:32], keysHash[:])
+	copy(address[32:], addressHash[:])
+
+	return address
+}
+
+func signHash(key *ecdsa.PrivateKey, hash [32]byte) (sig [64]byte, err error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return sig, err
+	}
+
+	copy(sig[32-len(r.Bytes()):32], r.Bytes())
+	copy(sig[64-len(s.Bytes()):], s.Bytes())
+
+	return sig, nil
+}
@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+//The outcome of a tx applied by a block. Only contract calls use gas and can fail, all other txs are successful if
+//they are part of a block. The receipt reports the gas limit of the call, the VM does not report the gas an execution
+//consumed.
+type Receipt struct {
+	TxHash   [32]byte
+	Success  bool
+	GasLimit uint64
+}
+
+func NewReceipt(txHash [32]byte) *Receipt {
+	return &Receipt{TxHash: txHash, Success: true}
+}
+
+func (receipt *Receipt) Hash() [32]byte {
+	if receipt == nil {
+		return [32]byte{}
+	}
+
+	receiptHash := struct {
+		TxHash   [32]byte
+		Success  bool
+		GasLimit uint64
+	}{
+		receipt.TxHash,
+		receipt.Success,
+		receipt.GasLimit,
+	}
+
+	return SerializeHashContent(receiptHash)
+}
+
+//The receipts root commits to the receipts of all txs of a block, in the order of the merkle tree leaves.
+func ReceiptsRoot(receipts []*Receipt) [32]byte {
+	var receiptHashes [][32]byte
+	for _, receipt := range receipts {
+		receiptHashes = append(receiptHashes, receipt.Hash())
+	}
+
+	//Receipts root for no transactions is 0 hash
+	if len(receiptHashes) == 0 {
+		return [32]byte{}
+	}
+
+	m, _ := newTree(receiptHashes)
+	return m.MerkleRoot()
+}
+
+func (receipt *Receipt) Encode() []byte {
+	if receipt == nil {
+		return nil
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(receipt)
+	return buffer.Bytes()
+}
+
+func (*Receipt) Decode(encoded []byte) *Receipt {
+	if encoded == nil {
+		return nil
+	}
+
+	var decoded Receipt
+	buffer := bytes.NewBuffer(encoded)
+	decoder := gob.NewDecoder(buffer)
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil
+	}
+
+	return &decoded
+}
+
+func (receipt Receipt) String() string {
+	return fmt.Sprintf(
+		"\nTxHash: %x\n"+
+			"Success: %v\n"+
+			"GasLimit: %v\n",
+		receipt.TxHash[0:8],
+		receipt.Success,
+		receipt.GasLimit,
+	)
+}
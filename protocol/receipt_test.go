@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReceiptSerialization(t *testing.T) {
+	receipt := &Receipt{[32]byte{1}, false, 100}
+
+	var decodedReceipt *Receipt
+	decodedReceipt = decodedReceipt.Decode(receipt.Encode())
+
+	if !reflect.DeepEqual(receipt, decodedReceipt) {
+		t.Errorf("Receipt serialization failed: %v vs. %v\n", receipt, decodedReceipt)
+	}
+}
+
+func TestReceiptsRoot(t *testing.T) {
+	receipt, failedReceipt := NewReceipt([32]byte{1}), NewReceipt([32]byte{2})
+	failedReceipt.Success = false
+
+	if ReceiptsRoot(nil) != [32]byte{} {
+		t.Error("Receipts root of no receipts is not the 0 hash.")
+	}
+
+	root := ReceiptsRoot([]*Receipt{receipt, failedReceipt})
+	if root == [32]byte{} || root == ReceiptsRoot([]*Receipt{receipt, NewReceipt([32]byte{2})}) {
+		t.Errorf("Receipts root does not commit to the outcome of the txs: %x\n", root)
+	}
+
+	hash := receipt.Hash()
+	receipt.GasLimit = 100
+	if receipt.Hash() == hash {
+		t.Error("Receipt hash does not cover the gas.")
+	}
+}
@@ -0,0 +1,287 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+//StateTree is a sparse Merkle tree over all accounts of the state. Accounts are placed in the tree according to the
+//bits of their account hash. A subtree that contains a single account is represented by the account's leaf directly,
+//empty subtrees are represented by the zero hash. This keeps the tree small and the root independent of the order
+//in which accounts have been added. Trees are never modified, an update returns a new tree that shares all nodes
+//off the updated path with the previous one.
+type StateTree struct {
+	root *stateNode
+}
+
+//StateProof proves that an account is (or is not) part of the state with a given state root. The path to the
+//account's position ends either in an empty subtree or in a leaf. If the leaf belongs to another account, the
+//account is not part of the state.
+type StateProof struct {
+	BlockHash [32]byte   //Block whose state root the proof refers to
+	Height    uint32     //Height of that block
+	Account   *Account   //Nil for a proof of non-inclusion
+	Siblings  [][32]byte //Sibling hashes from the root down to the end of the path
+	HasLeaf   bool       //False if the path ends in an empty subtree
+	LeafKey   [32]byte
+	LeafValue [32]byte
+}
+
+//A node is either a leaf or an inner node, nil children are empty subtrees.
+type stateNode struct {
+	hash   [32]byte
+	isLeaf bool
+	key    [32]byte
+	value  [32]byte
+	left   *stateNode
+	right  *stateNode
+}
+
+const (
+	STATE_TREE_DEPTH = 256
+
+	stateLeafPrefix = 0x00
+	stateNodePrefix = 0x01
+)
+
+func BuildStateTree(state map[[32]byte]*Account) *StateTree {
+	t := new(StateTree)
+
+	for accHash, acc := range state {
+		t.root = insertStateLeaf(t.root, newStateLeaf(accHash, acc.StateHash()), 0)
+	}
+
+	return t
+}
+
+//Update returns a tree in which the account with the given hash is set to acc, or removed if acc is nil. Only the
+//nodes on the path to the account are rehashed.
+func (t *StateTree) Update(accHash [32]byte, acc *Account) *StateTree {
+	var root *stateNode
+	if t != nil {
+		root = t.root
+	}
+
+	if acc == nil {
+		return &StateTree{removeStateLeaf(root, accHash, 0)}
+	}
+
+	return &StateTree{insertStateLeaf(root, newStateLeaf(accHash, acc.StateHash()), 0)}
+}
+
+//Root returns the state root, the zero hash for an empty state.
+func (t *StateTree) Root() [32]byte {
+	if t == nil {
+		return [32]byte{}
+	}
+
+	return t.root.getHash()
+}
+
+//Proof returns the proof of (non-)inclusion for the given account hash.
+func (t *StateTree) Proof(accHash [32]byte) *StateProof {
+	proof := new(StateProof)
+
+	var node *stateNode
+	if t != nil {
+		node = t.root
+	}
+
+	for depth := 0; node != nil && !node.isLeaf; depth++ {
+		if getKeyBit(accHash, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, node.right.getHash())
+			node = node.left
+		} else {
+			proof.Siblings = append(proof.Siblings, node.left.getHash())
+			node = node.right
+		}
+	}
+
+	if node != nil {
+		proof.HasLeaf = true
+		proof.LeafKey = node.key
+		proof.LeafValue = node.value
+	}
+
+	return proof
+}
+
+//VerifyStateProof checks the proof against the state root. If the proof contains an account, its inclusion is
+//verified, otherwise the non-inclusion of the account hash.
+func VerifyStateProof(stateRoot, accHash [32]byte, proof *StateProof) error {
+	if proof == nil {
+		return errors.New("No proof provided.")
+	}
+	if len(proof.Siblings) > STATE_TREE_DEPTH {
+		return errors.New(fmt.Sprintf("Proof is too long: %v siblings.", len(proof.Siblings)))
+	}
+
+	var node [32]byte
+	if proof.Account != nil {
+		if !proof.HasLeaf || proof.LeafKey != accHash || proof.Account.Hash() != accHash {
+			return errors.New("Proof does not belong to the account.")
+		}
+		if proof.LeafValue != proof.Account.StateHash() {
+			return errors.New("Account does not match the proven leaf.")
+		}
+	} else if proof.HasLeaf && proof.LeafKey == accHash {
+		return errors.New("Account is part of the state, but no account is provided.")
+	}
+
+	if proof.HasLeaf {
+		//The leaf needs to be on the path of the account, otherwise the account could still exist elsewhere.
+		for depth := range proof.Siblings {
+			if getKeyBit(proof.LeafKey, depth) != getKeyBit(accHash, depth) {
+				return errors.New("Leaf is not on the path of the account.")
+			}
+		}
+		node = hashStateLeaf(proof.LeafKey, proof.LeafValue)
+	}
+
+	for depth := len(proof.Siblings) - 1; depth >= 0; depth-- {
+		if getKeyBit(accHash, depth) == 0 {
+			node = hashStateNode(node, proof.Siblings[depth])
+		} else {
+			node = hashStateNode(proof.Siblings[depth], node)
+		}
+	}
+
+	if node != stateRoot {
+		return errors.New(fmt.Sprintf("Proof does not match state root: %x vs. %x", node[0:8], stateRoot[0:8]))
+	}
+
+	return nil
+}
+
+func (proof *StateProof) Encode() []byte {
+	if proof == nil {
+		return nil
+	}
+
+	buffer := new(bytes.Buffer)
+	gob.NewEncoder(buffer).Encode(proof)
+	return buffer.Bytes()
+}
+
+func (*StateProof) Decode(encoded []byte) (proof *StateProof) {
+	var decoded StateProof
+	buffer := bytes.NewBuffer(encoded)
+	decoder := gob.NewDecoder(buffer)
+	decoder.Decode(&decoded)
+	return &decoded
+}
+
+func newStateLeaf(key, value [32]byte) *stateNode {
+	return &stateNode{hash: hashStateLeaf(key, value), isLeaf: true, key: key, value: value}
+}
+
+func newStateNode(left, right *stateNode) *stateNode {
+	return &stateNode{hash: hashStateNode(left.getHash(), right.getHash()), left: left, right: right}
+}
+
+//The hash of an empty subtree is zero.
+func (node *stateNode) getHash() [32]byte {
+	if node == nil {
+		return [32]byte{}
+	}
+
+	return node.hash
+}
+
+//Returns the subtree at the given depth with the leaf inserted (or replaced). The subtree is not modified.
+func insertStateLeaf(node, leaf *stateNode, depth int) *stateNode {
+	if node == nil {
+		return leaf
+	}
+
+	if node.isLeaf {
+		if node.key == leaf.key {
+			return leaf
+		}
+		return joinStateLeaves(node, leaf, depth)
+	}
+
+	if getKeyBit(leaf.key, depth) == 0 {
+		return newStateNode(insertStateLeaf(node.left, leaf, depth+1), node.right)
+	}
+
+	return newStateNode(node.left, insertStateLeaf(node.right, leaf, depth+1))
+}
+
+//Both leaves share the same prefix up to the given depth, inner nodes are added until their paths split.
+func joinStateLeaves(a, b *stateNode, depth int) *stateNode {
+	bitA, bitB := getKeyBit(a.key, depth), getKeyBit(b.key, depth)
+
+	switch {
+	case bitA == bitB && bitA == 0:
+		return newStateNode(joinStateLeaves(a, b, depth+1), nil)
+	case bitA == bitB:
+		return newStateNode(nil, joinStateLeaves(a, b, depth+1))
+	case bitA == 0:
+		return newStateNode(a, b)
+	default:
+		return newStateNode(b, a)
+	}
+}
+
+//Returns the subtree at the given depth without the leaf with the given key. The subtree is not modified.
+func removeStateLeaf(node *stateNode, key [32]byte, depth int) *stateNode {
+	if node == nil {
+		return nil
+	}
+
+	if node.isLeaf {
+		if node.key == key {
+			return nil
+		}
+		return node
+	}
+
+	left, right := node.left, node.right
+	if getKeyBit(key, depth) == 0 {
+		left = removeStateLeaf(left, key, depth+1)
+	} else {
+		right = removeStateLeaf(right, key, depth+1)
+	}
+
+	if left == node.left && right == node.right {
+		return node
+	}
+
+	//A subtree with a single account is represented by its leaf.
+	if left == nil && (right == nil || right.isLeaf) {
+		return right
+	}
+	if right == nil && left.isLeaf {
+		return left
+	}
+
+	return newStateNode(left, right)
+}
+
+func hashStateLeaf(key, value [32]byte) [32]byte {
+	data := make([]byte, 0, 1+2*HASH_LEN)
+	data = append(data, stateLeafPrefix)
+	data = append(data, key[:]...)
+	data = append(data, value[:]...)
+
+	return sha3.Sum256(data)
+}
+
+func hashStateNode(left, right [32]byte) [32]byte {
+	data := make([]byte, 0, 1+2*HASH_LEN)
+	data = append(data, stateNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+
+	return sha3.Sum256(data)
+}
+
+//Returns the bit at the given depth, the most significant bit of the first byte has depth 0.
+func getKeyBit(key [32]byte, depth int) byte {
+	return (key[depth/8] >> uint(7-depth%8)) & 1
+}
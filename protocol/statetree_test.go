@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestBuildStateTree(t *testing.T) {
+	if root := BuildStateTree(nil).Root(); root != [32]byte{} {
+		t.Errorf("Root of empty state is not zero: %x\n", root)
+	}
+
+	state := make(map[[32]byte]*Account)
+	for i := 0; i < 100; i++ {
+		acc := NewAccount([64]byte{byte(i), 1}, [32]byte{}, uint64(i), false, [256]byte{}, nil, nil)
+		state[acc.Hash()] = &acc
+	}
+
+	//Map iteration order is random, the root must not depend on it.
+	root := BuildStateTree(state).Root()
+	for i := 0; i < 10; i++ {
+		if root != BuildStateTree(state).Root() {
+			t.Error("State root depends on the order of the accounts.\n")
+		}
+	}
+
+	for _, acc := range state {
+		acc.Balance++
+		break
+	}
+	if root == BuildStateTree(state).Root() {
+		t.Error("State root did not change after changing an account.\n")
+	}
+}
+
+func TestUpdateStateTree(t *testing.T) {
+	state := make(map[[32]byte]*Account)
+	stateTree := BuildStateTree(state)
+
+	for i := 0; i < 100; i++ {
+		acc := NewAccount([64]byte{byte(i), 4}, [32]byte{}, uint64(i), false, [256]byte{}, nil, nil)
+		state[acc.Hash()] = &acc
+		stateTree = stateTree.Update(acc.Hash(), &acc)
+	}
+	if stateTree.Root() != BuildStateTree(state).Root() {
+		t.Error("State root after adding accounts does not match the rebuilt state tree.\n")
+	}
+
+	prevTree := stateTree
+	prevRoot := stateTree.Root()
+	i := 0
+	for accHash, acc := range state {
+		if i%2 == 0 {
+			delete(state, accHash)
+			stateTree = stateTree.Update(accHash, nil)
+		} else {
+			acc.Balance++
+			stateTree = stateTree.Update(accHash, acc)
+		}
+		i++
+	}
+	if stateTree.Root() != BuildStateTree(state).Root() {
+		t.Error("State root after changing and removing accounts does not match the rebuilt state tree.\n")
+	}
+
+	//Updates return a new tree, the previous one is not modified.
+	if prevTree.Root() != prevRoot {
+		t.Error("Update modified the previous state tree.\n")
+	}
+
+	for accHash := range state {
+		stateTree = stateTree.Update(accHash, nil)
+	}
+	if root := stateTree.Root(); root != [32]byte{} {
+		t.Errorf("Root of empty state is not zero: %x\n", root)
+	}
+}
+
+func TestStateProof(t *testing.T) {
+	state := make(map[[32]byte]*Account)
+	for i := 0; i < 100; i++ {
+		acc := NewAccount([64]byte{byte(i), 2}, [32]byte{}, uint64(i), false, [256]byte{}, nil, nil)
+		state[acc.Hash()] = &acc
+	}
+
+	stateTree := BuildStateTree(state)
+	root := stateTree.Root()
+
+	for accHash, acc := range state {
+		proof := stateTree.Proof(accHash)
+		proof.Account = acc
+
+		var decodedProof *StateProof
+		decodedProof = decodedProof.Decode(proof.Encode())
+		if err := VerifyStateProof(root, accHash, decodedProof); err != nil {
+			t.Errorf("Valid proof of inclusion got rejected: %v\n", err)
+		}
+
+		//Changing the balance invalidates the proof.
+		changedAcc := *acc
+		changedAcc.Balance++
+		proof.Account = &changedAcc
+		if err := VerifyStateProof(root, accHash, proof); err == nil {
+			t.Error("Proof of inclusion for a modified account got accepted.\n")
+		}
+
+		//An existing account cannot be proven to be missing.
+		proof.Account = nil
+		if err := VerifyStateProof(root, accHash, proof); err == nil {
+			t.Error("Proof of non-inclusion for an existing account got accepted.\n")
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		acc := NewAccount([64]byte{byte(i), 3}, [32]byte{}, 0, false, [256]byte{}, nil, nil)
+		accHash := acc.Hash()
+
+		if err := VerifyStateProof(root, accHash, stateTree.Proof(accHash)); err != nil {
+			t.Errorf("Valid proof of non-inclusion got rejected: %v\n", err)
+		}
+
+		proof := stateTree.Proof(accHash)
+		proof.Account = &acc
+		if err := VerifyStateProof(root, accHash, proof); err == nil {
+			t.Error("Proof of inclusion for a missing account got accepted.\n")
+		}
+	}
+}
@@ -8,3 +8,31 @@ type Transaction interface {
 	TxFee() uint64
 	Size() uint64
 }
+
+//Returns true if the tx has an expiry height and can therefore not be included in a block with the given height.
+//Only FundsTxs and BatchTxs have an expiry height, AccTxs, ConfigTxs, StakeTxs and KeyTxs never expire.
+func IsExpired(tx Transaction, height uint32) bool {
+	var expiryHeight uint32
+	switch tx := tx.(type) {
+	case *FundsTx:
+		expiryHeight = tx.ExpiryHeight
+	case *BatchTx:
+		expiryHeight = tx.ExpiryHeight
+	}
+
+	return expiryHeight != 0 && height > expiryHeight
+}
+
+//FundsTxs, BatchTxs and KeyTxs use the TxCnt of their sender. Returns false for all other txs.
+func SenderTxCnt(tx Transaction) (sender [32]byte, txCnt uint32, hasTxCnt bool) {
+	switch tx := tx.(type) {
+	case *FundsTx:
+		return tx.From, tx.TxCnt, true
+	case *BatchTx:
+		return tx.From, tx.TxCnt, true
+	case *KeyTx:
+		return tx.Account, tx.TxCnt, true
+	}
+
+	return sender, txCnt, false
+}
@@ -1,6 +1,8 @@
 package protocol
 
 import (
+	"bytes"
+	"encoding/gob"
 	"errors"
 )
 
@@ -23,6 +25,35 @@ func (c *Change) GetChange() (int, []byte) {
 	return c.index, c.value
 }
 
+//Changes are persisted as part of the contract diff of a block, gob cannot encode unexported fields on its own.
+func (c Change) GobEncode() ([]byte, error) {
+	encoded := struct {
+		Index int
+		Value []byte
+	}{
+		c.index,
+		c.value,
+	}
+
+	buffer := new(bytes.Buffer)
+	err := gob.NewEncoder(buffer).Encode(encoded)
+	return buffer.Bytes(), err
+}
+
+func (c *Change) GobDecode(data []byte) error {
+	var decoded struct {
+		Index int
+		Value []byte
+	}
+
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&decoded); err != nil {
+		return err
+	}
+
+	c.index, c.value = decoded.Index, decoded.Value
+	return nil
+}
+
 func NewContext(account Account, fundsTx FundsTx) *Context {
 	newContext := Context{
 		Account: account,
@@ -74,6 +105,23 @@ func (c *Context) SetContractVariable(index int, value []byte) error {
 	return nil
 }
 
+//Returns the changes of the contract variables made by the vm, they are not persisted yet.
+func (c *Context) GetChanges() []Change {
+	return append([]Change(nil), c.changes...)
+}
+
+//Returns the changes that revert the changes of the context, i.e. the current values of the changed contract
+//variables. They have to be taken before the changes are persisted.
+func (c *Context) GetRevertChanges() (revertChanges []Change) {
+	for _, change := range c.changes {
+		value := make([]byte, len(c.ContractVariables[change.index]))
+		copy(value, c.ContractVariables[change.index])
+		revertChanges = append(revertChanges, NewChange(change.index, value))
+	}
+
+	return revertChanges
+}
+
 func (c *Context) PersistChanges() {
 	for _, change := range c.changes {
 		i, value := change.GetChange()
@@ -105,8 +153,9 @@ func (c *Context) GetTransactionData() []byte {
 	return c.Data
 }
 
+//The vm uses the fee as its gas budget, it is bounded by the gas limit of the tx.
 func (c *Context) GetFee() uint64 {
-	return c.Fee
+	return c.Gas()
 }
 
 func (c *Context) GetSig1() [64]byte {
@@ -117,3 +117,22 @@ func TestVMContext_SetContractVariable_ReplaceChange(t *testing.T) {
 		t.Errorf("Contract variable should be updated to '%v' but was '%v'", newValue2, actual)
 	}
 }
+
+func TestVMContext_GetRevertChanges(t *testing.T) {
+	c := Context{}
+	c.ContractVariables = [][]byte{{0x00, 0x01}, {0x00, 0x02}}
+
+	c.SetContractVariable(1, []byte{0x00, 0x03})
+	c.SetContractVariable(1, []byte{0x00, 0x04})
+	revertChanges := c.GetRevertChanges()
+	c.PersistChanges()
+
+	if len(revertChanges) != 1 {
+		t.Fatalf("Expected one revert change but got '%v'", revertChanges)
+	}
+
+	index, value := revertChanges[0].GetChange()
+	if index != 1 || !bytes.Equal(value, []byte{0x00, 0x02}) || !bytes.Equal(c.ContractVariables[1], []byte{0x00, 0x04}) {
+		t.Errorf("Expected to revert index 1 to '%v' but got index %v and '%v'", []byte{0x00, 0x02}, index, value)
+	}
+}
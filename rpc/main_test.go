@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/bazo-blockchain/bazo-miner/storage"
+)
+
+const (
+	TestIpPort     = "127.0.0.1:8000"
+	TestDBFileName = "test.db"
+)
+
+func TestMain(m *testing.M) {
+
+	storage.Init(TestDBFileName, TestIpPort)
+	logger = storage.InitLogger()
+
+	//we don't want logging msgs when testing, designated messages
+	log.SetOutput(ioutil.Discard)
+	retCode := m.Run()
+
+	storage.TearDown()
+	os.Remove(TestDBFileName)
+	os.Exit(retCode)
+}
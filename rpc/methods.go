@@ -0,0 +1,291 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bazo-blockchain/bazo-miner/miner"
+	"github.com/bazo-blockchain/bazo-miner/p2p"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
+)
+
+type method func(params json.RawMessage) (interface{}, *rpcError)
+
+var methods = map[string]method{
+	"getBlockByHash":   getBlockByHash,
+	"getBlockByHeight": getBlockByHeight,
+	"getTx":            getTx,
+	"getReceipt":       getReceipt,
+	"getAccount":       getAccount,
+	"callContract":     callContract,
+	"sendTx":           sendTx,
+	"getMempool":       getMempool,
+	"getParameters":    getParameters,
+	"getPeers":         getPeers,
+	"getSyncStatus":    getSyncStatus,
+}
+
+type hashParams struct {
+	Hash string `json:"hash"`
+}
+
+type heightParams struct {
+	Height *uint32 `json:"height"`
+}
+
+//The FundsTx a contract call is simulated with, hashes and data are hex encoded. Only to is required.
+type callContractParams struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Amount   uint64 `json:"amount"`
+	Fee      uint64 `json:"fee"`
+	GasLimit uint64 `json:"gasLimit"`
+	Data     string `json:"data"`
+}
+
+type sendTxParams struct {
+	Type string `json:"type"` //"funds", "acc", "config", "stake", "batch" or "key"
+	Tx   string `json:"tx"`   //Hex encoded tx as sent over the network
+}
+
+func getBlockByHash(params json.RawMessage) (interface{}, *rpcError) {
+	hash, err := parseHashParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	block := storage.ReadClosedBlock(hash)
+	if block == nil {
+		return nil, &rpcError{SERVER_ERROR, fmt.Sprintf("Block (%x) not found.", hash)}
+	}
+
+	return newBlockView(block), nil
+}
+
+func getBlockByHeight(params json.RawMessage) (interface{}, *rpcError) {
+	var p heightParams
+	if err := json.Unmarshal(params, &p); err != nil || p.Height == nil {
+		return nil, &rpcError{INVALID_PARAMS, "Parameter height is missing or not a number."}
+	}
+
+	block := storage.ReadClosedBlockByHeight(*p.Height)
+	if block == nil {
+		return nil, &rpcError{SERVER_ERROR, fmt.Sprintf("No block at height %v.", *p.Height)}
+	}
+
+	return newBlockView(block), nil
+}
+
+func getTx(params json.RawMessage) (interface{}, *rpcError) {
+	hash, err := parseHashParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx := storage.ReadOpenTx(hash); tx != nil {
+		return txStatusView{Status: "open", Tx: newTxView(tx)}, nil
+	}
+
+	tx := storage.ReadClosedTx(hash)
+	location := storage.ReadTxLocation(hash)
+	if tx == nil || location == nil {
+		return nil, &rpcError{SERVER_ERROR, fmt.Sprintf("Transaction (%x) not found.", hash)}
+	}
+
+	return txStatusView{"closed", toHex(location.BlockHash[:]), location.Height, location.Index, newTxView(tx)}, nil
+}
+
+func getReceipt(params json.RawMessage) (interface{}, *rpcError) {
+	hash, err := parseHashParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := storage.ReadReceipt(hash)
+	if receipt == nil {
+		return nil, &rpcError{SERVER_ERROR, fmt.Sprintf("Receipt of transaction (%x) not found.", hash)}
+	}
+
+	return newReceiptView(receipt), nil
+}
+
+func getAccount(params json.RawMessage) (interface{}, *rpcError) {
+	hash, err := parseHashParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, accErr := miner.GetAccount(hash)
+	if accErr != nil {
+		return nil, &rpcError{SERVER_ERROR, accErr.Error()}
+	}
+
+	return newAccountView(hash, acc), nil
+}
+
+func callContract(params json.RawMessage) (interface{}, *rpcError) {
+	var p callContractParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{INVALID_PARAMS, "Parameter to is missing."}
+	}
+
+	tx := protocol.FundsTx{Amount: p.Amount, Fee: p.Fee, GasLimit: p.GasLimit}
+	var ok bool
+	if tx.To, ok = decodeHash(p.To); !ok {
+		return nil, &rpcError{INVALID_PARAMS, "Parameter to is not a hex encoded 32 byte hash."}
+	}
+	if p.From != "" {
+		if tx.From, ok = decodeHash(p.From); !ok {
+			return nil, &rpcError{INVALID_PARAMS, "Parameter from is not a hex encoded 32 byte hash."}
+		}
+	}
+
+	data, err := hex.DecodeString(p.Data)
+	if err != nil {
+		return nil, &rpcError{INVALID_PARAMS, "Parameter data is not hex encoded."}
+	}
+	tx.Data = data
+
+	result, err := miner.CallContract(tx)
+	if err != nil {
+		return nil, &rpcError{SERVER_ERROR, err.Error()}
+	}
+
+	return newContractCallView(result), nil
+}
+
+func sendTx(params json.RawMessage) (interface{}, *rpcError) {
+	var p sendTxParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{INVALID_PARAMS, "Parameters type and tx are missing."}
+	}
+
+	encodedTx, err := hex.DecodeString(p.Tx)
+	if err != nil || len(encodedTx) == 0 {
+		return nil, &rpcError{INVALID_PARAMS, "Parameter tx is not hex encoded."}
+	}
+
+	tx, err := decodeTx(p.Type, encodedTx)
+	if err != nil {
+		return nil, &rpcError{INVALID_PARAMS, err.Error()}
+	}
+
+	//A FundsTx with the same sender and txCnt as a pending tx is a replace-by-fee request.
+	if fundsTx, isFundsTx := tx.(*protocol.FundsTx); isFundsTx && len(storage.ReadOpenFundsTxs(fundsTx.From, fundsTx.TxCnt)) > 0 {
+		err = miner.ReplaceTx(fundsTx)
+	} else {
+		err = p2p.SubmitTx(tx)
+	}
+	if err != nil {
+		return nil, &rpcError{SERVER_ERROR, err.Error()}
+	}
+
+	hash := tx.Hash()
+	return toHex(hash[:]), nil
+}
+
+func getMempool(params json.RawMessage) (interface{}, *rpcError) {
+	txs := []interface{}{}
+	for _, tx := range storage.ReadAllOpenTxs() {
+		txs = append(txs, newTxView(tx))
+	}
+
+	return txs, nil
+}
+
+func getParameters(params json.RawMessage) (interface{}, *rpcError) {
+	parameters, err := miner.GetActiveParameters()
+	if err != nil {
+		return nil, &rpcError{SERVER_ERROR, err.Error()}
+	}
+
+	return newParametersView(parameters), nil
+}
+
+func getPeers(params json.RawMessage) (interface{}, *rpcError) {
+	miners, clients := p2p.GetPeers()
+	return peersView{append([]string{}, miners...), append([]string{}, clients...)}, nil
+}
+
+func getSyncStatus(params json.RawMessage) (interface{}, *rpcError) {
+	status := miner.GetSyncStatus()
+	return syncStatusView{status.Syncing, status.UpToDate, status.Height, toHex(status.BlockHash[:])}, nil
+}
+
+func parseHashParams(params json.RawMessage) (hash [32]byte, err *rpcError) {
+	var p hashParams
+	if json.Unmarshal(params, &p) != nil {
+		return hash, &rpcError{INVALID_PARAMS, "Parameter hash is missing."}
+	}
+
+	hash, ok := decodeHash(p.Hash)
+	if !ok {
+		return hash, &rpcError{INVALID_PARAMS, "Parameter hash is not a hex encoded 32 byte hash."}
+	}
+
+	return hash, nil
+}
+
+func decodeHash(encoded string) (hash [32]byte, ok bool) {
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil || len(decoded) != len(hash) {
+		return hash, false
+	}
+	copy(hash[:], decoded)
+
+	return hash, true
+}
+
+//FundsTx, AccTx, BatchTx and KeyTx are gob encoded and decode to an empty tx on malformed input, hence the re-encoding check.
+func decodeTx(txType string, encodedTx []byte) (tx protocol.Transaction, err error) {
+	switch txType {
+	case "funds":
+		var fundsTx *protocol.FundsTx
+		fundsTx = fundsTx.Decode(encodedTx)
+		if !bytes.Equal(fundsTx.Encode(), encodedTx) {
+			return nil, errors.New("FundsTx could not be decoded.")
+		}
+		tx = fundsTx
+	case "acc":
+		var accTx *protocol.AccTx
+		accTx = accTx.Decode(encodedTx)
+		if !bytes.Equal(accTx.Encode(), encodedTx) {
+			return nil, errors.New("AccTx could not be decoded.")
+		}
+		tx = accTx
+	case "config":
+		var configTx *protocol.ConfigTx
+		if configTx = configTx.Decode(encodedTx); configTx == nil {
+			return nil, errors.New("ConfigTx could not be decoded.")
+		}
+		tx = configTx
+	case "stake":
+		var stakeTx *protocol.StakeTx
+		if stakeTx = stakeTx.Decode(encodedTx); stakeTx == nil {
+			return nil, errors.New("StakeTx could not be decoded.")
+		}
+		tx = stakeTx
+	case "batch":
+		var batchTx *protocol.BatchTx
+		batchTx = batchTx.Decode(encodedTx)
+		if !bytes.Equal(batchTx.Encode(), encodedTx) {
+			return nil, errors.New("BatchTx could not be decoded.")
+		}
+		tx = batchTx
+	case "key":
+		var keyTx *protocol.KeyTx
+		keyTx = keyTx.Decode(encodedTx)
+		if !bytes.Equal(keyTx.Encode(), encodedTx) {
+			return nil, errors.New("KeyTx could not be decoded.")
+		}
+		tx = keyTx
+	default:
+		return nil, errors.New(fmt.Sprintf("Transaction type %v not recognized.", txType))
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/bazo-blockchain/bazo-miner/storage"
+)
+
+//JSON-RPC 2.0 over HTTP. Requests are sent as POST to the root path, parameters are passed by name.
+
+const (
+	JSONRPC_VERSION = "2.0"
+
+	//Maximum size of a request body in bytes
+	MAX_REQUEST_SIZE = 1 << 20
+
+	//Error codes as defined by the JSON-RPC 2.0 specification
+	PARSE_ERROR      = -32700
+	INVALID_REQUEST  = -32600
+	METHOD_NOT_FOUND = -32601
+	INVALID_PARAMS   = -32602
+	SERVER_ERROR     = -32000
+)
+
+var logger *log.Logger
+
+type request struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *rpcError) Error() string {
+	return err.Message
+}
+
+//Entry function for the rpc package, serves requests at the given IP:Port until the server fails.
+func Init(address string) {
+	logger = storage.InitLogger()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRequest)
+	mux.HandleFunc("/subscribe", handleSubscription)
+
+	logger.Printf("RPC server listening on %v\n", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logger.Printf("RPC server stopped: %v\n", err)
+	}
+}
+
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_REQUEST_SIZE))
+	if err != nil {
+		writeResponse(w, response{Error: &rpcError{INVALID_REQUEST, "Request could not be read."}})
+		return
+	}
+
+	writeResponse(w, processRequest(body))
+}
+
+//Decouple the function for testing.
+func processRequest(body []byte) response {
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return response{Error: &rpcError{PARSE_ERROR, "Request is not valid JSON."}}
+	}
+	if req.Jsonrpc != JSONRPC_VERSION || req.Method == "" {
+		return response{Error: &rpcError{INVALID_REQUEST, "Request is not a valid JSON-RPC 2.0 request."}, Id: req.Id}
+	}
+
+	method, exists := methods[req.Method]
+	if !exists {
+		return response{Error: &rpcError{METHOD_NOT_FOUND, "Method " + req.Method + " not found."}, Id: req.Id}
+	}
+
+	result, err := method(req.Params)
+	if err != nil {
+		return response{Error: err, Id: req.Id}
+	}
+
+	return response{Result: result, Id: req.Id}
+}
+
+func writeResponse(w http.ResponseWriter, res response) {
+	res.Jsonrpc = JSONRPC_VERSION
+	if res.Id == nil {
+		res.Id = json.RawMessage("null")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Printf("RPC response could not be written: %v\n", err)
+	}
+}
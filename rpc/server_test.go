@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bazo-blockchain/bazo-miner/crypto"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/bazo-blockchain/bazo-miner/storage"
+)
+
+func TestProcessRequestErrors(t *testing.T) {
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc": "2.0", "method": `, PARSE_ERROR},
+		{`{"jsonrpc": "1.0", "method": "getMempool", "id": 1}`, INVALID_REQUEST},
+		{`{"jsonrpc": "2.0", "method": "unknown", "id": 1}`, METHOD_NOT_FOUND},
+		{`{"jsonrpc": "2.0", "method": "getBlockByHash", "params": {"hash": "abc"}, "id": 1}`, INVALID_PARAMS},
+		{`{"jsonrpc": "2.0", "method": "getBlockByHeight", "params": {}, "id": 1}`, INVALID_PARAMS},
+		{`{"jsonrpc": "2.0", "method": "callContract", "params": {"to": "abc"}, "id": 1}`, INVALID_PARAMS},
+		{`{"jsonrpc": "2.0", "method": "sendTx", "params": {"type": "funds", "tx": "0102"}, "id": 1}`, INVALID_PARAMS},
+		{`{"jsonrpc": "2.0", "method": "getBlockByHeight", "params": {"height": 4294967295}, "id": 1}`, SERVER_ERROR},
+	}
+
+	for _, test := range tests {
+		res := processRequest([]byte(test.body))
+		if res.Error == nil || res.Error.Code != test.code {
+			t.Errorf("Request %v returned %v instead of error code %v.\n", test.body, res.Error, test.code)
+		}
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+
+	block := protocol.NewBlock([32]byte{'0'}, 7)
+	block.Hash = [32]byte{'1'}
+	storage.WriteClosedBlock(block)
+	storage.WriteBlockIndex([]*protocol.Block{block})
+
+	res := processRequest([]byte(`{"jsonrpc": "2.0", "method": "getBlockByHeight", "params": {"height": 7}, "id": 1}`))
+	if res.Error != nil {
+		t.Fatalf("Block could not be read by height: %v\n", res.Error)
+	}
+	if view := res.Result.(blockView); view.Hash != toHex(block.Hash[:]) || view.Height != 7 {
+		t.Errorf("Wrong block returned: %v\n", view)
+	}
+
+	res = processRequest([]byte(`{"jsonrpc": "2.0", "method": "getBlockByHash", "params": {"hash": "` + toHex(block.Hash[:]) + `"}, "id": 1}`))
+	if res.Error != nil || res.Result.(blockView).Height != 7 {
+		t.Errorf("Block could not be read by hash: %v\n", res.Error)
+	}
+}
+
+func TestHandleRequest(t *testing.T) {
+
+	tx := &protocol.ConfigTx{Header: 1, Id: 2, Payload: 3, Fee: 4, TxCnt: 5}
+	storage.WriteOpenTx(tx)
+	defer storage.DeleteOpenTx(tx)
+
+	body := []byte(`{"jsonrpc": "2.0", "method": "getMempool", "id": "a"}`)
+	rec := httptest.NewRecorder()
+	handleRequest(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+
+	var res struct {
+		Jsonrpc string
+		Result  []configTxView
+		Id      string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Response is not valid JSON: %v\n", err)
+	}
+
+	txHash := tx.Hash()
+	if res.Jsonrpc != JSONRPC_VERSION || res.Id != "a" || len(res.Result) != 1 || res.Result[0].Hash != toHex(txHash[:]) {
+		t.Errorf("Wrong mempool returned: %s\n", rec.Body.Bytes())
+	}
+
+	rec = httptest.NewRecorder()
+	handleRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET request returned status %v.\n", rec.Code)
+	}
+}
+
+func TestDecodeTx(t *testing.T) {
+
+	fundsTx := &protocol.FundsTx{Header: 1, Amount: 10, Fee: 1, TxCnt: 2, From: [32]byte{'a'}, To: [32]byte{'b'}}
+	tx, err := decodeTx("funds", fundsTx.Encode())
+	if err != nil || tx.Hash() != fundsTx.Hash() {
+		t.Errorf("FundsTx could not be decoded: %v\n", err)
+	}
+
+	if _, err := decodeTx("stake", fundsTx.Encode()); err == nil {
+		t.Error("FundsTx decoded as StakeTx.\n")
+	}
+
+	if _, err := decodeTx("unknown", fundsTx.Encode()); err == nil {
+		t.Error("Unknown tx type decoded.\n")
+	}
+}
+
+func TestCallContract(t *testing.T) {
+
+	acc := protocol.NewAccount([64]byte{'c'}, [32]byte{}, 0, false, [crypto.COMM_KEY_LENGTH]byte{}, []byte{
+		35,    // CALLDATA
+		29, 0, // SLOAD
+		4,     // ADD
+		27, 0, // SSTORE
+		29, 0, // SLOAD
+		50, // HALT
+	}, [][]byte{{0, 2}})
+	accHash := acc.Hash()
+	storage.State[accHash] = &acc
+	defer delete(storage.State, accHash)
+
+	res := processRequest([]byte(`{"jsonrpc": "2.0", "method": "callContract", "params": {"to": "` + toHex(accHash[:]) + `", "gasLimit": 100000, "data": "01000f"}, "id": 1}`))
+	if res.Error != nil {
+		t.Fatalf("Contract call failed: %v\n", res.Error)
+	}
+	if view := res.Result.(contractCallView); view.Result != "0011" || len(view.Changes) != 1 || view.Changes[0].Value != "0011" {
+		t.Errorf("Wrong result of the contract call: %v\n", view)
+	}
+	if acc.ContractVariables[0][1] != 2 {
+		t.Errorf("Contract call changed the contract variables: %v\n", acc.ContractVariables)
+	}
+
+	res = processRequest([]byte(`{"jsonrpc": "2.0", "method": "callContract", "params": {"to": "` + toHex(accHash[:]) + `", "gasLimit": 1, "data": "01000f"}, "id": 1}`))
+	if res.Error == nil || res.Error.Code != SERVER_ERROR {
+		t.Errorf("Contract call running out of gas returned %v.\n", res.Error)
+	}
+}
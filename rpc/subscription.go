@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bazo-blockchain/bazo-miner/miner"
+)
+
+//Subscriptions are served as server-sent events at /subscribe. Every subscriber receives new blocks ("block") and
+//rolled back blocks ("rollback"). FundsTxs ("tx") are only pushed for the accounts passed as address query parameters,
+//e.g., /subscribe?address=<hex account hash>&address=<hex account hash>. A rolled back block includes the txs that
+//are no longer confirmed, so they get pushed again with the "rollback" status.
+
+const SSE_KEEPALIVE_INTERVAL = 30 * time.Second
+
+type txEventView struct {
+	Status    string      `json:"status"` //"confirmed" or "rollback"
+	BlockHash string      `json:"blockHash"`
+	Height    uint32      `json:"height"`
+	Tx        fundsTxView `json:"tx"`
+}
+
+func handleSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	addresses, err := parseAddresses(r.URL.Query()["address"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := miner.Subscribe()
+	defer miner.Unsubscribe(events)
+
+	keepalive := time.NewTicker(SSE_KEEPALIVE_INTERVAL)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				//The subscriber fell behind, the client has to reconnect.
+				return
+			}
+			for _, message := range eventMessages(event, addresses) {
+				if _, err := w.Write(message); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+//Returns the server-sent event messages of a miner event for the given watched accounts.
+func eventMessages(event miner.Event, addresses map[[32]byte]bool) (messages [][]byte) {
+	eventName, txStatus := "block", "confirmed"
+	if event.Type == miner.EVENT_ROLLBACK {
+		eventName, txStatus = "rollback", "rollback"
+	}
+
+	messages = append(messages, sseMessage(eventName, newBlockView(event.Block)))
+
+	for _, tx := range event.FundsTxs {
+		if !addresses[tx.From] && !addresses[tx.To] {
+			continue
+		}
+
+		view := txEventView{txStatus, toHex(event.Block.Hash[:]), event.Block.Height, newFundsTxView(tx)}
+		messages = append(messages, sseMessage("tx", view))
+	}
+
+	return messages
+}
+
+func sseMessage(event string, data interface{}) []byte {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		logger.Printf("Event %v could not be encoded: %v\n", event, err)
+		return nil
+	}
+
+	return []byte(fmt.Sprintf("event: %v\ndata: %s\n\n", event, encoded))
+}
+
+func parseAddresses(params []string) (addresses map[[32]byte]bool, err error) {
+	addresses = make(map[[32]byte]bool)
+	for _, param := range params {
+		var address [32]byte
+		decoded, err := hex.DecodeString(param)
+		if err != nil || len(decoded) != len(address) {
+			return nil, errors.New(fmt.Sprintf("Address %v is not a hex encoded 32 byte account hash.", param))
+		}
+		copy(address[:], decoded)
+		addresses[address] = true
+	}
+
+	return addresses, nil
+}
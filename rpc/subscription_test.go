@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazo-blockchain/bazo-miner/miner"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+func TestEventMessages(t *testing.T) {
+
+	block := protocol.NewBlock([32]byte{'0'}, 3)
+	block.Hash = [32]byte{'1'}
+	watchedTx := &protocol.FundsTx{Amount: 5, From: [32]byte{'a'}, To: [32]byte{'b'}}
+	otherTx := &protocol.FundsTx{Amount: 6, From: [32]byte{'c'}, To: [32]byte{'d'}}
+
+	addresses, err := parseAddresses([]string{toHex(watchedTx.To[:])})
+	if err != nil {
+		t.Fatalf("Address could not be parsed: %v\n", err)
+	}
+
+	messages := eventMessages(miner.Event{Type: miner.EVENT_BLOCK, Block: block, FundsTxs: []*protocol.FundsTx{watchedTx, otherTx}}, addresses)
+	if len(messages) != 2 {
+		t.Fatalf("Expected a block and a tx message, got %v messages.\n", len(messages))
+	}
+	if !strings.HasPrefix(string(messages[0]), "event: block\ndata: ") || !strings.HasSuffix(string(messages[0]), "\n\n") {
+		t.Errorf("Malformed block message: %s\n", messages[0])
+	}
+	watchedHash := watchedTx.Hash()
+	if !strings.HasPrefix(string(messages[1]), "event: tx\n") || !strings.Contains(string(messages[1]), toHex(watchedHash[:])) ||
+		!strings.Contains(string(messages[1]), `"status":"confirmed"`) {
+		t.Errorf("Malformed tx message: %s\n", messages[1])
+	}
+
+	messages = eventMessages(miner.Event{Type: miner.EVENT_ROLLBACK, Block: block, FundsTxs: []*protocol.FundsTx{watchedTx}}, addresses)
+	if len(messages) != 2 || !strings.HasPrefix(string(messages[0]), "event: rollback\n") ||
+		!strings.Contains(string(messages[1]), `"status":"rollback"`) {
+		t.Errorf("Malformed rollback messages: %s\n", messages)
+	}
+
+	if _, err := parseAddresses([]string{"abc"}); err == nil {
+		t.Error("Invalid address parsed.\n")
+	}
+}
@@ -0,0 +1,305 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/bazo-blockchain/bazo-miner/miner"
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+//JSON representations of the protocol types. Hashes, keys and other binary data are hex encoded.
+
+type blockView struct {
+	Hash                  string   `json:"hash"`
+	PrevHash              string   `json:"prevHash"`
+	Height                uint32   `json:"height"`
+	Timestamp             int64    `json:"timestamp"`
+	Beneficiary           string   `json:"beneficiary"`
+	StateRoot             string   `json:"stateRoot"`
+	ReceiptsRoot          string   `json:"receiptsRoot"`
+	MerkleRoot            string   `json:"merkleRoot"`
+	Nonce                 string   `json:"nonce"`
+	SlashedAddress        string   `json:"slashedAddress"`
+	ConflictingBlockHash1 string   `json:"conflictingBlockHash1"`
+	ConflictingBlockHash2 string   `json:"conflictingBlockHash2"`
+	CommitmentProof       string   `json:"commitmentProof"`
+	AccTxs                []string `json:"accTxs"`
+	FundsTxs              []string `json:"fundsTxs"`
+	ConfigTxs             []string `json:"configTxs"`
+	StakeTxs              []string `json:"stakeTxs"`
+	BatchTxs              []string `json:"batchTxs"`
+	KeyTxs                []string `json:"keyTxs"`
+}
+
+type fundsTxView struct {
+	Type         string `json:"type"`
+	Hash         string `json:"hash"`
+	Header       byte   `json:"header"`
+	Amount       uint64 `json:"amount"`
+	Fee          uint64 `json:"fee"`
+	TxCnt        uint32 `json:"txCnt"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Data         string `json:"data"`
+	LockHeight   uint32 `json:"lockHeight,omitempty"`
+	LockTime     int64  `json:"lockTime,omitempty"`
+	ExpiryHeight uint32 `json:"expiryHeight,omitempty"`
+	GasLimit     uint64 `json:"gasLimit,omitempty"`
+}
+
+type accTxView struct {
+	Type              string   `json:"type"`
+	Hash              string   `json:"hash"`
+	Header            byte     `json:"header"`
+	Issuer            string   `json:"issuer"`
+	Fee               uint64   `json:"fee"`
+	PubKey            string   `json:"pubKey"`
+	Contract          string   `json:"contract"`
+	MultiSigKeys      []string `json:"multiSigKeys,omitempty"`
+	MultiSigThreshold uint8    `json:"multiSigThreshold,omitempty"`
+}
+
+type configTxView struct {
+	Type    string `json:"type"`
+	Hash    string `json:"hash"`
+	Header  byte   `json:"header"`
+	Id      uint8  `json:"id"`
+	Payload uint64 `json:"payload"`
+	Fee     uint64 `json:"fee"`
+	TxCnt   uint8  `json:"txCnt"`
+}
+
+type stakeTxView struct {
+	Type      string `json:"type"`
+	Hash      string `json:"hash"`
+	Header    byte   `json:"header"`
+	Fee       uint64 `json:"fee"`
+	IsStaking bool   `json:"isStaking"`
+	Account   string `json:"account"`
+}
+
+type batchTxView struct {
+	Type         string             `json:"type"`
+	Hash         string             `json:"hash"`
+	Header       byte               `json:"header"`
+	Fee          uint64             `json:"fee"`
+	TxCnt        uint32             `json:"txCnt"`
+	From         string             `json:"from"`
+	Payments     []batchPaymentView `json:"payments"`
+	ExpiryHeight uint32             `json:"expiryHeight,omitempty"`
+}
+
+type keyTxView struct {
+	Type    string `json:"type"`
+	Hash    string `json:"hash"`
+	Header  byte   `json:"header"`
+	Fee     uint64 `json:"fee"`
+	TxCnt   uint32 `json:"txCnt"`
+	Account string `json:"account"`
+	OldKey  string `json:"oldKey"`
+	NewKey  string `json:"newKey"`
+}
+
+type batchPaymentView struct {
+	To     string `json:"to"`
+	Amount uint64 `json:"amount"`
+}
+
+type txStatusView struct {
+	Status    string      `json:"status"` //"open" or "closed"
+	BlockHash string      `json:"blockHash,omitempty"`
+	Height    uint32      `json:"height,omitempty"`
+	Index     uint32      `json:"index,omitempty"`
+	Tx        interface{} `json:"tx"`
+}
+
+type accountView struct {
+	Hash               string   `json:"hash"`
+	Address            string   `json:"address"`
+	SigningKey         string   `json:"signingKey"`
+	Issuer             string   `json:"issuer"`
+	Balance            uint64   `json:"balance"`
+	TxCnt              uint32   `json:"txCnt"`
+	IsStaking          bool     `json:"isStaking"`
+	StakingBlockHeight uint32   `json:"stakingBlockHeight"`
+	Contract           string   `json:"contract"`
+	ContractVariables  []string `json:"contractVariables"`
+	MultiSigKeys       []string `json:"multiSigKeys,omitempty"`
+	MultiSigThreshold  uint8    `json:"multiSigThreshold,omitempty"`
+	Sig2Required       bool     `json:"sig2Required"`
+}
+
+type parametersView struct {
+	BlockHash          string `json:"blockHash"`
+	FeeMinimum         uint64 `json:"feeMinimum"`
+	BlockSize          uint64 `json:"blockSize"`
+	DiffInterval       uint64 `json:"diffInterval"`
+	BlockInterval      uint64 `json:"blockInterval"`
+	BlockReward        uint64 `json:"blockReward"`
+	StakingMinimum     uint64 `json:"stakingMinimum"`
+	WaitingMinimum     uint64 `json:"waitingMinimum"`
+	AcceptedTimeDiff   uint64 `json:"acceptedTimeDiff"`
+	SlashingWindowSize uint64 `json:"slashingWindowSize"`
+	SlashReward        uint64 `json:"slashReward"`
+	MultisigRequired   bool   `json:"multisigRequired"`
+	BlockGasLimit      uint64 `json:"blockGasLimit"`
+}
+
+type receiptView struct {
+	TxHash   string   `json:"txHash"`
+	Success  bool     `json:"success"`
+	GasLimit uint64 `json:"gasLimit"`
+}
+
+type contractCallView struct {
+	Result  string               `json:"result"`
+	Changes []contractChangeView `json:"changes"`
+}
+
+type contractChangeView struct {
+	Index int    `json:"index"`
+	Value string `json:"value"`
+}
+
+type peersView struct {
+	Miners  []string `json:"miners"`
+	Clients []string `json:"clients"`
+}
+
+type syncStatusView struct {
+	Syncing   bool   `json:"syncing"`
+	UpToDate  bool   `json:"upToDate"`
+	Height    uint32 `json:"height"`
+	BlockHash string `json:"blockHash"`
+}
+
+func toHex(data []byte) string {
+	return fmt.Sprintf("%x", data)
+}
+
+func toHexList(hashes [][32]byte) []string {
+	list := make([]string, len(hashes))
+	for i, hash := range hashes {
+		list[i] = toHex(hash[:])
+	}
+
+	return list
+}
+
+func newBlockView(block *protocol.Block) blockView {
+	return blockView{
+		Hash:                  toHex(block.Hash[:]),
+		PrevHash:              toHex(block.PrevHash[:]),
+		Height:                block.Height,
+		Timestamp:             block.Timestamp,
+		Beneficiary:           toHex(block.Beneficiary[:]),
+		StateRoot:             toHex(block.StateRoot[:]),
+		ReceiptsRoot:          toHex(block.ReceiptsRoot[:]),
+		MerkleRoot:            toHex(block.MerkleRoot[:]),
+		Nonce:                 toHex(block.Nonce[:]),
+		SlashedAddress:        toHex(block.SlashedAddress[:]),
+		ConflictingBlockHash1: toHex(block.ConflictingBlockHash1[:]),
+		ConflictingBlockHash2: toHex(block.ConflictingBlockHash2[:]),
+		CommitmentProof:       toHex(block.CommitmentProof[:]),
+		AccTxs:                toHexList(block.AccTxData),
+		FundsTxs:              toHexList(block.FundsTxData),
+		ConfigTxs:             toHexList(block.ConfigTxData),
+		StakeTxs:              toHexList(block.StakeTxData),
+		BatchTxs:              toHexList(block.BatchTxData),
+		KeyTxs:                toHexList(block.KeyTxData),
+	}
+}
+
+func newReceiptView(receipt *protocol.Receipt) receiptView {
+	return receiptView{toHex(receipt.TxHash[:]), receipt.Success, receipt.GasLimit}
+}
+
+func newContractCallView(result miner.ContractCallResult) contractCallView {
+	changes := []contractChangeView{}
+	for _, change := range result.Changes {
+		index, value := change.GetChange()
+		changes = append(changes, contractChangeView{index, toHex(value)})
+	}
+
+	return contractCallView{toHex(result.Result), changes}
+}
+
+func newTxView(transaction protocol.Transaction) interface{} {
+	hash := transaction.Hash()
+
+	switch tx := transaction.(type) {
+	case *protocol.FundsTx:
+		return newFundsTxView(tx)
+	case *protocol.AccTx:
+		return accTxView{"acc", toHex(hash[:]), tx.Header, toHex(tx.Issuer[:]), tx.Fee, toHex(tx.PubKey[:]), toHex(tx.Contract), multiSigKeysView(tx.MultiSigKeys), tx.MultiSigThreshold}
+	case *protocol.ConfigTx:
+		return configTxView{"config", toHex(hash[:]), tx.Header, tx.Id, tx.Payload, tx.Fee, tx.TxCnt}
+	case *protocol.StakeTx:
+		return stakeTxView{"stake", toHex(hash[:]), tx.Header, tx.Fee, tx.IsStaking, toHex(tx.Account[:])}
+	case *protocol.BatchTx:
+		payments := make([]batchPaymentView, len(tx.Payments))
+		for i, payment := range tx.Payments {
+			payments[i] = batchPaymentView{toHex(payment.To[:]), payment.Amount}
+		}
+		return batchTxView{"batch", toHex(hash[:]), tx.Header, tx.Fee, tx.TxCnt, toHex(tx.From[:]), payments, tx.ExpiryHeight}
+	case *protocol.KeyTx:
+		return keyTxView{"key", toHex(hash[:]), tx.Header, tx.Fee, tx.TxCnt, toHex(tx.Account[:]), toHex(tx.OldKey[:]), toHex(tx.NewKey[:])}
+	}
+
+	return nil
+}
+
+func newFundsTxView(tx *protocol.FundsTx) fundsTxView {
+	hash := tx.Hash()
+	return fundsTxView{"funds", toHex(hash[:]), tx.Header, tx.Amount, tx.Fee, tx.TxCnt, toHex(tx.From[:]), toHex(tx.To[:]), toHex(tx.Data), tx.LockHeight, tx.LockTime, tx.ExpiryHeight, tx.GasLimit}
+}
+
+func newAccountView(accHash [32]byte, acc protocol.Account) accountView {
+	signingKey := acc.PubKey()
+	variables := make([]string, len(acc.ContractVariables))
+	for i, variable := range acc.ContractVariables {
+		variables[i] = toHex(variable)
+	}
+
+	return accountView{
+		Hash:               toHex(accHash[:]),
+		Address:            toHex(acc.Address[:]),
+		SigningKey:         toHex(signingKey[:]),
+		Issuer:             toHex(acc.Issuer[:]),
+		Balance:            acc.Balance,
+		TxCnt:              acc.TxCnt,
+		IsStaking:          acc.IsStaking,
+		StakingBlockHeight: acc.StakingBlockHeight,
+		Contract:           toHex(acc.Contract),
+		ContractVariables:  variables,
+		MultiSigKeys:       multiSigKeysView(acc.MultiSigKeys),
+		MultiSigThreshold:  acc.MultiSigThreshold,
+		Sig2Required:       acc.Sig2Required,
+	}
+}
+
+func multiSigKeysView(keys [][64]byte) (view []string) {
+	for _, key := range keys {
+		view = append(view, toHex(key[:]))
+	}
+
+	return view
+}
+
+func newParametersView(parameters miner.Parameters) parametersView {
+	return parametersView{
+		BlockHash:          toHex(parameters.BlockHash[:]),
+		FeeMinimum:         parameters.Fee_minimum,
+		BlockSize:          parameters.Block_size,
+		DiffInterval:       parameters.Diff_interval,
+		BlockInterval:      parameters.Block_interval,
+		BlockReward:        parameters.Block_reward,
+		StakingMinimum:     parameters.Staking_minimum,
+		WaitingMinimum:     parameters.Waiting_minimum,
+		AcceptedTimeDiff:   parameters.Accepted_time_diff,
+		SlashingWindowSize: parameters.Slashing_window_size,
+		SlashReward:        parameters.Slash_reward,
+		MultisigRequired:   parameters.Multisig_required != 0,
+		BlockGasLimit:      parameters.Block_gas_limit,
+	}
+}
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"bytes"
+	"time"
+
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/boltdb/bolt"
 )
@@ -30,6 +33,85 @@ func DeleteLastClosedBlock(hash [32]byte) {
 	})
 }
 
+//Counterpart of WriteClosedBlockWithState. Removes the block from closed storage, sets its predecessor as the last
+//closed block and persists the given (rolled back) accounts within the same bolt transaction. The records of the block
+//are removed as well.
+func DeleteClosedBlockWithState(block *protocol.Block, prevBlock *protocol.Block, accHashes [][32]byte, records *BlockRecords) (err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("closedblocks"))
+		if err := b.Delete(block.Hash[:]); err != nil {
+			return err
+		}
+
+		//The height only gets removed from the index if it still refers to this block.
+		b = tx.Bucket([]byte("blockheights"))
+		if hash := b.Get(encodeHeight(block.Height)); hash != nil && bytes.Equal(hash, block.Hash[:]) {
+			if err := b.Delete(encodeHeight(block.Height)); err != nil {
+				return err
+			}
+		}
+
+		//Same for the txs, which might have been included in another block in the meantime.
+		b = tx.Bucket([]byte("txindex"))
+		for _, txHash := range block.TxHashes() {
+			if location := b.Get(txHash[:]); location != nil && bytes.Equal(location[0:32], block.Hash[:]) {
+				if err := b.Delete(txHash[:]); err != nil {
+					return err
+				}
+			}
+		}
+
+		if prevBlock != nil {
+			if err := writeLastClosedBlock(tx, prevBlock); err != nil {
+				return err
+			}
+		}
+
+		if err := deleteBlockRecords(tx, block, records); err != nil {
+			return err
+		}
+
+		return writeAccounts(tx, accHashes)
+	})
+
+	return err
+}
+
+//Removes the txs of a rolled back block from the history of the involved accounts.
+//Removes the closed txs, the account history, the contract diff and the receipts of a block.
+func deleteBlockRecords(tx *bolt.Tx, block *protocol.Block, records *BlockRecords) error {
+	if records == nil {
+		return nil
+	}
+
+	for _, transaction := range records.Txs {
+		hash := transaction.Hash()
+		if err := tx.Bucket([]byte(closedTxBucket(transaction))).Delete(hash[:]); err != nil {
+			return err
+		}
+	}
+
+	b := tx.Bucket([]byte("accounttxs"))
+	for _, key := range accountTxKeys(block, records.Txs) {
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Bucket([]byte("contractdiffs")).Delete(block.Hash[:]); err != nil {
+		return err
+	}
+
+	b = tx.Bucket([]byte("receipts"))
+	for _, txHash := range block.TxHashes() {
+		if err := b.Delete(txHash[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func DeleteAllLastClosedBlock() {
 	db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("lastclosedblock"))
@@ -42,29 +124,36 @@ func DeleteAllLastClosedBlock() {
 }
 
 func DeleteOpenTx(transaction protocol.Transaction) {
-	delete(txMemPool, transaction.Hash())
+	txMemPool.delete(transaction.Hash())
+	flushMemPool()
 }
 
 func DeleteINVALIDOpenTx(transaction protocol.Transaction) {
-	delete(txINVALIDMemPool, transaction.Hash())
+	txINVALIDMemPool.delete(transaction.Hash())
 }
 
-func DeleteClosedTx(transaction protocol.Transaction) {
-	var bucket string
-	switch transaction.(type) {
-	case *protocol.FundsTx:
-		bucket = "closedfunds"
-	case *protocol.AccTx:
-		bucket = "closedaccs"
-	case *protocol.ConfigTx:
-		bucket = "closedconfigs"
-	case *protocol.StakeTx:
-		bucket = "closedstakes"
-	}
+//Removes all open txs that have been in the mempool for longer than MemPoolTxExpiry. Locked FundsTxs are only removed
+//once the given last block unlocked them and MemPoolTxExpiry has passed since.
+func DeleteExpiredOpenTxs(lastHeight uint32, lastTime int64) (expired []protocol.Transaction) {
+	before := time.Now().Add(-MemPoolTxExpiry)
+	txINVALIDMemPool.expire(before)
+
+	defer flushMemPool()
+	return txMemPool.expire(before, lastHeight, lastTime)
+}
+
+//Removes all open txs whose expiry height does not allow them to be included in a block with the given height.
+func DeleteOpenTxsExpiredAt(height uint32) (expired []protocol.Transaction) {
+	txINVALIDMemPool.expireAt(height)
+
+	defer flushMemPool()
+	return txMemPool.expireAt(height)
+}
 
+func DeleteClosedTx(transaction protocol.Transaction) {
 	hash := transaction.Hash()
 	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket([]byte(closedTxBucket(transaction)))
 		err := b.Delete(hash[:])
 		return err
 	})
@@ -72,9 +161,7 @@ func DeleteClosedTx(transaction protocol.Transaction) {
 
 func DeleteAll() {
 	//Delete in-memory storage
-	for key := range txMemPool {
-		delete(txMemPool, key)
-	}
+	txMemPool.clear()
 
 	//Delete disk-based storage
 	db.Update(func(tx *bolt.Tx) error {
@@ -125,6 +212,38 @@ func DeleteAll() {
 		})
 		return nil
 	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("closedbatches"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("closedkeys"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("contractdiffs"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("receipts"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
 	db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("lastclosedblock"))
 		b.ForEach(func(k, v []byte) error {
@@ -133,4 +252,44 @@ func DeleteAll() {
 		})
 		return nil
 	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("blockheights"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("txindex"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("accounttxs"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("accounts"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("rootkeys"))
+		b.ForEach(func(k, v []byte) error {
+			b.Delete(k)
+			return nil
+		})
+		return nil
+	})
 }
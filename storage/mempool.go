@@ -0,0 +1,645 @@
+package storage
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+	"github.com/boltdb/bolt"
+)
+
+//The mempool holds all open txs. Its size is capped, if it is full the txs with the lowest fee per byte get evicted.
+//FundsTxs, BatchTxs and KeyTxs of a sender are evicted starting at the highest TxCnt, so the remaining txs of a
+//sender never have a gap.
+//Txs that have not been included in a block for MemPoolTxExpiry get purged when the next block is prepared. Txs with
+//an expiry height are purged as soon as the chain has passed it.
+//Pending FundsTxs with the same sender and TxCnt may coexist (e.g., if they are part of competing blocks), the one
+//with the highest fee is tried first when a block is prepared. A verified FundsTx with a higher fee replaces all of
+//them (replace-by-fee).
+//Changes are written through to the open tx buckets, so the pending txs survive a restart or a crash.
+
+type memPoolEntry struct {
+	tx        protocol.Transaction
+	hash      [32]byte
+	received  time.Time
+	unlocked  time.Time //Set once a locked FundsTx is found to be unlocked, not persisted
+	heapIndex int       //Position in the eviction heap, -1 if the tx cannot be evicted
+}
+
+type memPoolStruct struct {
+	txs        map[[32]byte]*memPoolEntry
+	fundsTxs   map[fundsTxKey]map[[32]byte]bool        //Pending FundsTxs by sender and TxCnt
+	senderTxs  map[[32]byte]map[[32]byte]*memPoolEntry //Txs with a TxCnt by sender
+	lastTxs    map[[32]byte]*memPoolEntry              //Tx with the highest TxCnt by sender
+	evictable  evictionHeap                            //Txs that can be evicted without leaving a TxCnt gap
+	size       uint64                                  //Sum of the tx sizes in bytes
+	dirty      map[[32]byte]bool                       //Txs added or removed since the last flush
+	mutex      sync.Mutex
+	flushMutex sync.Mutex
+}
+
+type fundsTxKey struct {
+	from  [32]byte
+	txCnt uint32
+}
+
+//Open txs that could not be added to a block. They are kept (up to INVALID_MEMPOOL_MAX_TXS) in case they are part of
+//a block received later on.
+type invalidMemPoolStruct struct {
+	txs   map[[32]byte]*memPoolEntry
+	mutex sync.Mutex
+}
+
+func newMemPool() *memPoolStruct {
+	return &memPoolStruct{
+		txs:       make(map[[32]byte]*memPoolEntry),
+		fundsTxs:  make(map[fundsTxKey]map[[32]byte]bool),
+		senderTxs: make(map[[32]byte]map[[32]byte]*memPoolEntry),
+		lastTxs:   make(map[[32]byte]*memPoolEntry),
+		dirty:     make(map[[32]byte]bool),
+	}
+}
+
+func newMemPoolEntry(tx protocol.Transaction, hash [32]byte, received time.Time) *memPoolEntry {
+	return &memPoolEntry{tx: tx, hash: hash, received: received, heapIndex: -1}
+}
+
+func newInvalidMemPool() *invalidMemPoolStruct {
+	return &invalidMemPoolStruct{txs: make(map[[32]byte]*memPoolEntry)}
+}
+
+func (pool *memPoolStruct) add(tx protocol.Transaction) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	entry := newMemPoolEntry(tx, tx.Hash(), time.Now())
+	if _, exists := pool.txs[entry.hash]; exists {
+		return nil
+	}
+
+	pool.insert(entry)
+
+	return pool.evict(entry)
+}
+
+//Replaces the pending FundsTxs with the same sender and TxCnt if the new tx pays a higher fee than all of them.
+func (pool *memPoolStruct) replace(tx *protocol.FundsTx) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	entry := newMemPoolEntry(tx, tx.Hash(), time.Now())
+	if _, exists := pool.txs[entry.hash]; exists {
+		return errors.New(fmt.Sprintf("FundsTx (%x) already in the mempool.", entry.hash[0:8]))
+	}
+
+	pending := pool.fundsTxs[fundsTxKey{tx.From, tx.TxCnt}]
+	for pendingHash := range pending {
+		if pendingFee := pool.txs[pendingHash].tx.TxFee(); tx.Fee <= pendingFee {
+			return errors.New(fmt.Sprintf("Fee of the replacement (%v) must be higher than the fee of the pending tx (%v).", tx.Fee, pendingFee))
+		}
+	}
+
+	for pendingHash := range pending {
+		pool.remove(pendingHash)
+	}
+	pool.insert(entry)
+
+	return pool.evict(entry)
+}
+
+func (pool *memPoolStruct) getFundsTxs(from [32]byte, txCnt uint32) (txs []*protocol.FundsTx) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for hash := range pool.fundsTxs[fundsTxKey{from, txCnt}] {
+		txs = append(txs, pool.txs[hash].tx.(*protocol.FundsTx))
+	}
+
+	return txs
+}
+
+//Must be called with the mutex held.
+func (pool *memPoolStruct) insert(entry *memPoolEntry) {
+	pool.txs[entry.hash] = entry
+	pool.size += entry.tx.Size()
+	pool.dirty[entry.hash] = true
+
+	if fundsTx, isFundsTx := entry.tx.(*protocol.FundsTx); isFundsTx {
+		key := fundsTxKey{fundsTx.From, fundsTx.TxCnt}
+		if pool.fundsTxs[key] == nil {
+			pool.fundsTxs[key] = make(map[[32]byte]bool)
+		}
+		pool.fundsTxs[key][entry.hash] = true
+	}
+
+	from, _, hasTxCnt := protocol.SenderTxCnt(entry.tx)
+	if !hasTxCnt {
+		heap.Push(&pool.evictable, entry)
+		return
+	}
+
+	if pool.senderTxs[from] == nil {
+		pool.senderTxs[from] = make(map[[32]byte]*memPoolEntry)
+	}
+	pool.senderTxs[from][entry.hash] = entry
+
+	//Only the last tx of a sender can be evicted.
+	if last := pool.lastTxs[from]; last == nil || lessTxCnt(last, entry) {
+		if last != nil {
+			heap.Remove(&pool.evictable, last.heapIndex)
+		}
+		pool.lastTxs[from] = entry
+		heap.Push(&pool.evictable, entry)
+	}
+}
+
+//Evicts txs until the mempool is within its size limit, returns an error if the newly added entry got evicted. Must be
+//called with the mutex held.
+func (pool *memPoolStruct) evict(entry *memPoolEntry) error {
+	for pool.size > MemPoolMaxSize {
+		evicted := pool.evictionCandidate()
+		pool.remove(evicted.hash)
+
+		if evicted == entry {
+			return errors.New(fmt.Sprintf("Mempool is full, fee of tx (%x) too low.", entry.hash[0:8]))
+		}
+		logger.Printf("Mempool is full, evicted tx (%x).\n", evicted.hash[0:8])
+	}
+
+	return nil
+}
+
+//Must be called with the mutex held.
+func (pool *memPoolStruct) remove(hash [32]byte) {
+	if entry, exists := pool.txs[hash]; exists {
+		pool.size -= entry.tx.Size()
+		delete(pool.txs, hash)
+		pool.dirty[hash] = true
+
+		if fundsTx, isFundsTx := entry.tx.(*protocol.FundsTx); isFundsTx {
+			key := fundsTxKey{fundsTx.From, fundsTx.TxCnt}
+			if delete(pool.fundsTxs[key], hash); len(pool.fundsTxs[key]) == 0 {
+				delete(pool.fundsTxs, key)
+			}
+		}
+
+		if entry.heapIndex >= 0 {
+			heap.Remove(&pool.evictable, entry.heapIndex)
+		}
+
+		if from, _, hasTxCnt := protocol.SenderTxCnt(entry.tx); hasTxCnt {
+			delete(pool.senderTxs[from], hash)
+			if pool.lastTxs[from] == entry {
+				pool.updateLastTx(from)
+			}
+			if len(pool.senderTxs[from]) == 0 {
+				delete(pool.senderTxs, from)
+			}
+		}
+	}
+}
+
+//Makes the tx with the highest TxCnt of the sender evictable after the previous one has been removed. Must be called
+//with the mutex held.
+func (pool *memPoolStruct) updateLastTx(from [32]byte) {
+	var last *memPoolEntry
+	for _, entry := range pool.senderTxs[from] {
+		if last == nil || lessTxCnt(last, entry) {
+			last = entry
+		}
+	}
+
+	if last == nil {
+		delete(pool.lastTxs, from)
+		return
+	}
+
+	pool.lastTxs[from] = last
+	heap.Push(&pool.evictable, last)
+}
+
+func (pool *memPoolStruct) delete(hash [32]byte) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.remove(hash)
+}
+
+func (pool *memPoolStruct) get(hash [32]byte) protocol.Transaction {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if entry, exists := pool.txs[hash]; exists {
+		return entry.tx
+	}
+
+	return nil
+}
+
+func (pool *memPoolStruct) len() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return len(pool.txs)
+}
+
+func (pool *memPoolStruct) all() (txs []protocol.Transaction) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for _, entry := range pool.txs {
+		txs = append(txs, entry.tx)
+	}
+
+	return txs
+}
+
+//Removes all txs from memory and disk.
+func (pool *memPoolStruct) clear() {
+	pool.flushMutex.Lock()
+	defer pool.flushMutex.Unlock()
+
+	pool.mutex.Lock()
+	pool.txs = make(map[[32]byte]*memPoolEntry)
+	pool.fundsTxs = make(map[fundsTxKey]map[[32]byte]bool)
+	pool.senderTxs = make(map[[32]byte]map[[32]byte]*memPoolEntry)
+	pool.lastTxs = make(map[[32]byte]*memPoolEntry)
+	pool.evictable = nil
+	pool.dirty = make(map[[32]byte]bool)
+	pool.size = 0
+	pool.mutex.Unlock()
+
+	db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range openTxBuckets {
+			b := tx.Bucket([]byte(bucket))
+			b.ForEach(func(k, v []byte) error {
+				b.Delete(k)
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+//Writes the txs that have been added or removed since the last flush to the open tx buckets.
+func (pool *memPoolStruct) flush() error {
+	pool.flushMutex.Lock()
+	defer pool.flushMutex.Unlock()
+
+	pool.mutex.Lock()
+	changes := make(map[[32]byte]*memPoolEntry)
+	for hash := range pool.dirty {
+		changes[hash] = pool.txs[hash]
+	}
+	pool.dirty = make(map[[32]byte]bool)
+	pool.mutex.Unlock()
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		for hash, entry := range changes {
+			//The type of a removed tx is unknown, hence it is removed from all buckets.
+			for _, bucket := range openTxBuckets {
+				if err := tx.Bucket([]byte(bucket)).Delete(hash[:]); err != nil {
+					return err
+				}
+			}
+			if entry == nil {
+				continue
+			}
+
+			received := make([]byte, 8)
+			binary.BigEndian.PutUint64(received, uint64(entry.received.UnixNano()))
+			if err := tx.Bucket([]byte(openTxBucket(entry.tx))).Put(hash[:], append(received, entry.tx.Encode()...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	//Changes that could not be written are retried with the next flush.
+	if err != nil {
+		pool.mutex.Lock()
+		for hash := range changes {
+			pool.dirty[hash] = true
+		}
+		pool.mutex.Unlock()
+	}
+
+	return err
+}
+
+//Loads the txs of the open tx buckets, e.g., after a restart. They still need to be verified against the state.
+func (pool *memPoolStruct) load() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range openTxBuckets {
+			tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+				if len(v) <= 8 {
+					return nil
+				}
+
+				var transaction protocol.Transaction
+				switch bucket {
+				case "openfunds":
+					var fundsTx *protocol.FundsTx
+					transaction = fundsTx.Decode(v[8:])
+				case "openaccs":
+					var accTx *protocol.AccTx
+					transaction = accTx.Decode(v[8:])
+				case "openconfigs":
+					var configTx *protocol.ConfigTx
+					if configTx = configTx.Decode(v[8:]); configTx != nil {
+						transaction = configTx
+					}
+				case "openstakes":
+					var stakeTx *protocol.StakeTx
+					if stakeTx = stakeTx.Decode(v[8:]); stakeTx != nil {
+						transaction = stakeTx
+					}
+				case "openbatches":
+					var batchTx *protocol.BatchTx
+					transaction = batchTx.Decode(v[8:])
+				case "openkeys":
+					var keyTx *protocol.KeyTx
+					transaction = keyTx.Decode(v[8:])
+				}
+
+				var hash [32]byte
+				copy(hash[:], k)
+				if transaction == nil || transaction.Hash() != hash {
+					return nil
+				}
+
+				received := time.Unix(0, int64(binary.BigEndian.Uint64(v[:8])))
+				pool.insert(newMemPoolEntry(transaction, hash, received))
+				delete(pool.dirty, hash)
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func openTxBucket(tx protocol.Transaction) string {
+	switch tx.(type) {
+	case *protocol.FundsTx:
+		return "openfunds"
+	case *protocol.AccTx:
+		return "openaccs"
+	case *protocol.ConfigTx:
+		return "openconfigs"
+	case *protocol.BatchTx:
+		return "openbatches"
+	case *protocol.KeyTx:
+		return "openkeys"
+	}
+
+	return "openstakes"
+}
+
+//Called after every change of the mempool. Changes that could not be written are retried with the next change.
+func flushMemPool() {
+	if err := txMemPool.flush(); err != nil {
+		logger.Printf("Could not persist the mempool: %v\n", err)
+	}
+}
+
+//Removes and returns all txs that have been received before the given time. FundsTxs that are still locked after the
+//given last block are held until they can be included in a block. The time they spent locked does not count, they
+//expire once they have been unlocked for as long as other txs are kept.
+func (pool *memPoolStruct) expire(before time.Time, lastHeight uint32, lastTime int64) (expired []protocol.Transaction) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for hash, entry := range pool.txs {
+		since := entry.received
+		if fundsTx, ok := entry.tx.(*protocol.FundsTx); ok && fundsTx.IsLocked() {
+			if !fundsTx.IsUnlocked(lastHeight, lastTime) {
+				continue
+			}
+			if entry.unlocked.IsZero() {
+				entry.unlocked = time.Now()
+			}
+			since = entry.unlocked
+		}
+
+		if since.Before(before) {
+			expired = append(expired, entry.tx)
+			pool.remove(hash)
+		}
+	}
+
+	return expired
+}
+
+//Removes and returns all txs that cannot be included in a block with the given height anymore.
+func (pool *memPoolStruct) expireAt(height uint32) (expired []protocol.Transaction) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for hash, entry := range pool.txs {
+		if protocol.IsExpired(entry.tx, height) {
+			expired = append(expired, entry.tx)
+			pool.remove(hash)
+		}
+	}
+
+	return expired
+}
+
+//Returns the tx with the lowest priority among all txs that can be removed without leaving a TxCnt gap, i.e., all
+//txs without a TxCnt and the tx with the highest TxCnt of every sender. Must be called with the mutex held.
+func (pool *memPoolStruct) evictionCandidate() *memPoolEntry {
+	if len(pool.evictable) == 0 {
+		return nil
+	}
+
+	return pool.evictable[0]
+}
+
+//Returns all txs ordered by fee per byte. The FundsTxs, BatchTxs and KeyTxs of a sender keep their TxCnt order, such
+//a tx is only considered once all preceding txs of its sender have been added.
+func (pool *memPoolStruct) sorted() (txs []protocol.Transaction) {
+	pool.mutex.Lock()
+
+	queues := make(txQueues, 0, len(pool.txs))
+	senders := make(map[[32]byte]int)
+	for _, entry := range pool.txs {
+		from, _, hasTxCnt := protocol.SenderTxCnt(entry.tx)
+		if !hasTxCnt {
+			queues = append(queues, []*memPoolEntry{entry})
+			continue
+		}
+
+		if index, exists := senders[from]; exists {
+			queues[index] = append(queues[index], entry)
+		} else {
+			senders[from] = len(queues)
+			queues = append(queues, []*memPoolEntry{entry})
+		}
+	}
+
+	pool.mutex.Unlock()
+
+	for _, queue := range queues {
+		sort.Slice(queue, func(i, j int) bool {
+			return lessTxCnt(queue[i], queue[j])
+		})
+	}
+
+	heap.Init(&queues)
+	for queues.Len() > 0 {
+		queue := queues[0]
+		txs = append(txs, queue[0].tx)
+
+		if len(queue) > 1 {
+			queues[0] = queue[1:]
+			heap.Fix(&queues, 0)
+		} else {
+			heap.Pop(&queues)
+		}
+	}
+
+	return txs
+}
+
+func feePerByte(tx protocol.Transaction) float64 {
+	if tx.Size() == 0 {
+		return float64(tx.TxFee())
+	}
+
+	return float64(tx.TxFee()) / float64(tx.Size())
+}
+
+//Higher fee per byte first, then the tx that has been received earlier. The hash makes the order deterministic.
+func hasPriority(a, b *memPoolEntry) bool {
+	if feeA, feeB := feePerByte(a.tx), feePerByte(b.tx); feeA != feeB {
+		return feeA > feeB
+	}
+	if !a.received.Equal(b.received) {
+		return a.received.Before(b.received)
+	}
+
+	return bytes.Compare(a.hash[:], b.hash[:]) < 0
+}
+
+//Order of the txs of a sender: by TxCnt, txs with the same TxCnt by priority.
+func lessTxCnt(a, b *memPoolEntry) bool {
+	_, txCntA, _ := protocol.SenderTxCnt(a.tx)
+	_, txCntB, _ := protocol.SenderTxCnt(b.tx)
+	if txCntA != txCntB {
+		return txCntA < txCntB
+	}
+
+	return hasPriority(a, b)
+}
+
+//Max-heap of tx queues, ordered by the priority of their first tx.
+type txQueues [][]*memPoolEntry
+
+func (q txQueues) Len() int            { return len(q) }
+func (q txQueues) Less(i, j int) bool  { return hasPriority(q[i][0], q[j][0]) }
+func (q txQueues) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *txQueues) Push(x interface{}) { *q = append(*q, x.([]*memPoolEntry)) }
+func (q *txQueues) Pop() interface{} {
+	old := *q
+	queue := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return queue
+}
+
+//Min-heap of the evictable txs, the tx with the lowest priority is evicted first.
+type evictionHeap []*memPoolEntry
+
+func (h evictionHeap) Len() int           { return len(h) }
+func (h evictionHeap) Less(i, j int) bool { return hasPriority(h[j], h[i]) }
+func (h evictionHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+func (h *evictionHeap) Push(x interface{}) {
+	entry := x.(*memPoolEntry)
+	entry.heapIndex = len(*h)
+	*h = append(*h, entry)
+}
+func (h *evictionHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	entry.heapIndex = -1
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func (pool *invalidMemPoolStruct) add(tx protocol.Transaction) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	//Which tx gets dropped does not matter, they are only kept in case another block contains them.
+	if len(pool.txs) >= INVALID_MEMPOOL_MAX_TXS {
+		for hash := range pool.txs {
+			delete(pool.txs, hash)
+			break
+		}
+	}
+
+	pool.txs[tx.Hash()] = newMemPoolEntry(tx, tx.Hash(), time.Now())
+}
+
+func (pool *invalidMemPoolStruct) delete(hash [32]byte) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	delete(pool.txs, hash)
+}
+
+func (pool *invalidMemPoolStruct) get(hash [32]byte) protocol.Transaction {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if entry, exists := pool.txs[hash]; exists {
+		return entry.tx
+	}
+
+	return nil
+}
+
+func (pool *invalidMemPoolStruct) len() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return len(pool.txs)
+}
+
+func (pool *invalidMemPoolStruct) expire(before time.Time) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for hash, entry := range pool.txs {
+		if entry.received.Before(before) {
+			delete(pool.txs, hash)
+		}
+	}
+}
+
+func (pool *invalidMemPoolStruct) expireAt(height uint32) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for hash, entry := range pool.txs {
+		if protocol.IsExpired(entry.tx, height) {
+			delete(pool.txs, hash)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bazo-blockchain/bazo-miner/protocol"
+)
+
+func TestMemPoolOrder(t *testing.T) {
+
+	pool := newMemPool()
+	senderA, senderB := [32]byte{'a'}, [32]byte{'b'}
+
+	//The second tx of A has the highest fee but has to wait for the first one, which has the lowest fee.
+	txA0 := &protocol.FundsTx{Fee: 1, TxCnt: 0, From: senderA}
+	txA1 := &protocol.FundsTx{Fee: 100, TxCnt: 1, From: senderA}
+	txB0 := &protocol.FundsTx{Fee: 50, TxCnt: 0, From: senderB}
+	txB1 := &protocol.FundsTx{Fee: 2, TxCnt: 1, From: senderB}
+	stakeTx := &protocol.StakeTx{Fee: 10000}
+
+	for _, tx := range []protocol.Transaction{txA1, txB1, txA0, stakeTx, txB0} {
+		if err := pool.add(tx); err != nil {
+			t.Fatalf("Tx could not be added: %v\n", err)
+		}
+	}
+
+	expected := []protocol.Transaction{stakeTx, txB0, txB1, txA0, txA1}
+	sorted := pool.sorted()
+	if len(sorted) != len(expected) {
+		t.Fatalf("Sorted %v txs instead of %v.\n", len(sorted), len(expected))
+	}
+	for i, tx := range sorted {
+		if tx.Hash() != expected[i].Hash() {
+			t.Errorf("Tx at position %v has fee %v, expected fee %v.\n", i, tx.TxFee(), expected[i].TxFee())
+		}
+	}
+}
+
+func TestMemPoolEviction(t *testing.T) {
+
+	maxSize := MemPoolMaxSize
+	defer func() { MemPoolMaxSize = maxSize }()
+	MemPoolMaxSize = 3 * protocol.FUNDSTX_SIZE
+
+	pool := newMemPool()
+	senderA, senderB := [32]byte{'a'}, [32]byte{'b'}
+
+	txA0 := &protocol.FundsTx{Fee: 1, TxCnt: 0, From: senderA}
+	txA1 := &protocol.FundsTx{Fee: 5, TxCnt: 1, From: senderA}
+	txB0 := &protocol.FundsTx{Fee: 3, TxCnt: 0, From: senderB}
+	for _, tx := range []*protocol.FundsTx{txA0, txA1, txB0} {
+		pool.add(tx)
+	}
+
+	//A tx with a lower fee than all evictable txs is rejected.
+	if err := pool.add(&protocol.FundsTx{Fee: 2, TxCnt: 1, From: senderB}); err == nil || pool.len() != 3 {
+		t.Errorf("Tx with the lowest fee has been added to the full mempool.\n")
+	}
+
+	//The lowest fee tx txA0 cannot be evicted before txA1, hence txB0 is evicted.
+	txC0 := &protocol.FundsTx{Fee: 4, TxCnt: 0, From: [32]byte{'c'}}
+	if err := pool.add(txC0); err != nil {
+		t.Fatalf("Tx could not be added: %v\n", err)
+	}
+	if pool.get(txB0.Hash()) != nil || pool.get(txA0.Hash()) == nil || pool.get(txC0.Hash()) == nil {
+		t.Errorf("Wrong tx evicted.\n")
+	}
+	if pool.size != 3*protocol.FUNDSTX_SIZE {
+		t.Errorf("Mempool size %v, expected %v.\n", pool.size, 3*protocol.FUNDSTX_SIZE)
+	}
+}
+
+//The eviction heap needs to yield the same candidate as a scan over all txs, also after txs have been removed.
+func TestMemPoolEvictionCandidate(t *testing.T) {
+
+	pool := newMemPool()
+	var hashes [][32]byte
+	for i := 0; i < 60; i++ {
+		var tx protocol.Transaction
+		if i%4 == 0 {
+			tx = &protocol.StakeTx{Fee: uint64(i*7%13 + 1), Account: [32]byte{byte(i)}}
+		} else {
+			tx = &protocol.FundsTx{Fee: uint64(i*11%17 + 1), TxCnt: uint32(i / 5), From: [32]byte{byte(i % 5)}}
+		}
+		pool.add(tx)
+		hashes = append(hashes, tx.Hash())
+	}
+
+	for i, hash := range hashes {
+		if i%3 == 0 {
+			pool.delete(hash)
+		}
+		if candidate, expected := pool.evictionCandidate(), scanEvictionCandidate(pool); candidate != expected {
+			t.Fatalf("Eviction candidate (%x) does not match the scan (%x).\n", candidate.hash[0:8], expected.hash[0:8])
+		}
+	}
+}
+
+func scanEvictionCandidate(pool *memPoolStruct) (candidate *memPoolEntry) {
+	lastOfSender := make(map[[32]byte]*memPoolEntry)
+	for _, entry := range pool.txs {
+		from, _, hasTxCnt := protocol.SenderTxCnt(entry.tx)
+		if !hasTxCnt {
+			if candidate == nil || hasPriority(candidate, entry) {
+				candidate = entry
+			}
+			continue
+		}
+		if last := lastOfSender[from]; last == nil || lessTxCnt(last, entry) {
+			lastOfSender[from] = entry
+		}
+	}
+
+	for _, entry := range lastOfSender {
+		if candidate == nil || hasPriority(candidate, entry) {
+			candidate = entry
+		}
+	}
+
+	return candidate
+}
+
+func TestMemPoolExpiry(t *testing.T) {
+
+	pool := newMemPool()
+	tx := &protocol.FundsTx{Fee: 1}
+	pool.add(tx)
+
+	if expired := pool.expire(time.Now().Add(-time.Hour), 0, 0); len(expired) != 0 {
+		t.Errorf("Tx expired too early.\n")
+	}
+	if expired := pool.expire(time.Now().Add(time.Second), 0, 0); len(expired) != 1 || pool.len() != 0 || pool.size != 0 {
+		t.Errorf("Tx did not expire.\n")
+	}
+}
+
+func TestMemPoolExpiryLocked(t *testing.T) {
+
+	pool := newMemPool()
+	tx := &protocol.FundsTx{Fee: 1, LockHeight: 5}
+	pool.add(tx)
+
+	if expired := pool.expire(time.Now().Add(time.Second), 4, 0); len(expired) != 0 {
+		t.Errorf("Locked tx expired.\n")
+	}
+	//The expiry starts when the tx is unlocked, not when it has been received.
+	unlocked := time.Now()
+	if expired := pool.expire(unlocked.Add(-time.Millisecond), 5, 0); len(expired) != 0 {
+		t.Errorf("Tx expired right after it was unlocked.\n")
+	}
+	if expired := pool.expire(time.Now().Add(time.Second), 5, 0); len(expired) != 1 || pool.len() != 0 {
+		t.Errorf("Unlocked tx did not expire.\n")
+	}
+}
+
+func TestMemPoolExpiryHeight(t *testing.T) {
+
+	pool := newMemPool()
+	expiringTx := &protocol.FundsTx{Fee: 1, ExpiryHeight: 5}
+	batchTx := &protocol.BatchTx{Fee: 2, ExpiryHeight: 6}
+	tx := &protocol.FundsTx{Fee: 3}
+	for _, tx := range []protocol.Transaction{expiringTx, batchTx, tx} {
+		pool.add(tx)
+	}
+
+	if expired := pool.expireAt(5); len(expired) != 0 {
+		t.Errorf("Tx expired before its expiry height.\n")
+	}
+	if expired := pool.expireAt(7); len(expired) != 2 || pool.len() != 1 || pool.get(tx.Hash()) == nil {
+		t.Errorf("Txs did not expire at their expiry height.\n")
+	}
+}
+
+func TestMemPoolReplace(t *testing.T) {
+
+	pool := newMemPool()
+	sender := [32]byte{'a'}
+	txA := &protocol.FundsTx{Fee: 2, TxCnt: 0, From: sender}
+	txB := &protocol.FundsTx{Fee: 3, TxCnt: 0, From: sender, To: [32]byte{'b'}}
+	pool.add(txA)
+	pool.add(txB)
+
+	//Conflicting txs can coexist, the one with the higher fee comes first.
+	if sorted := pool.sorted(); len(sorted) != 2 || sorted[0] != txB {
+		t.Errorf("Conflicting txs not ordered by fee.\n")
+	}
+
+	if err := pool.replace(&protocol.FundsTx{Fee: 3, TxCnt: 0, From: sender, To: [32]byte{'c'}}); err == nil {
+		t.Errorf("Replacement without a higher fee succeeded.\n")
+	}
+
+	replacement := &protocol.FundsTx{Fee: 4, TxCnt: 0, From: sender}
+	if err := pool.replace(replacement); err != nil {
+		t.Fatalf("Replacement failed: %v\n", err)
+	}
+	if pool.len() != 1 || pool.get(replacement.Hash()) == nil || len(pool.getFundsTxs(sender, 0)) != 1 {
+		t.Errorf("Pending txs have not been replaced.\n")
+	}
+	if pool.size != protocol.FUNDSTX_SIZE {
+		t.Errorf("Mempool size %v, expected %v.\n", pool.size, protocol.FUNDSTX_SIZE)
+	}
+}
+
+func TestMemPoolPersistence(t *testing.T) {
+
+	DeleteAll()
+	defer DeleteAll()
+
+	fundsTx := &protocol.FundsTx{Fee: 1, TxCnt: 3, From: [32]byte{'a'}}
+	stakeTx, _ := protocol.ConstrStakeTx(0x01, 2, true, [32]byte{'b'}, &PrivKeyA, &CommitmentKeyA.PublicKey)
+	WriteOpenTx(fundsTx)
+	WriteOpenTx(stakeTx)
+
+	//Simulates a restart (or a crash), the txs are written through.
+	pool := newMemPool()
+	pool.load()
+	if pool.len() != 2 || pool.get(fundsTx.Hash()) == nil || pool.get(stakeTx.Hash()) == nil {
+		t.Fatalf("Mempool not restored, %v tx(s) loaded.\n", pool.len())
+	}
+	if !pool.txs[fundsTx.Hash()].received.Equal(txMemPool.txs[fundsTx.Hash()].received) {
+		t.Error("Time of reception not restored.\n")
+	}
+
+	DeleteOpenTx(fundsTx)
+
+	pool = newMemPool()
+	pool.load()
+	if pool.len() != 1 || pool.get(fundsTx.Hash()) != nil {
+		t.Errorf("Deleted tx has been restored.\n")
+	}
+}
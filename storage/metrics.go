@@ -0,0 +1,14 @@
+package storage
+
+import (
+	"github.com/bazo-blockchain/bazo-miner/metrics"
+)
+
+var (
+	memPoolGauge = metrics.NewGaugeFunc("bazo_mempool_txs", "Number of open txs in the mempool.", func() float64 {
+		return float64(txMemPool.len())
+	})
+	invalidMemPoolGauge = metrics.NewGaugeFunc("bazo_invalid_mempool_txs", "Number of invalid open txs.", func() float64 {
+		return float64(txINVALIDMemPool.len())
+	})
+)
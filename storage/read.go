@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/binary"
+
 	"github.com/bazo-blockchain/bazo-miner/protocol"
 	"github.com/boltdb/bolt"
 )
@@ -38,6 +41,101 @@ func ReadClosedBlock(hash [32]byte) (block *protocol.Block) {
 	return block
 }
 
+//Returns the closed block of the current chain at the given height.
+func ReadClosedBlockByHeight(height uint32) (block *protocol.Block) {
+
+	db.View(func(tx *bolt.Tx) error {
+		hash := tx.Bucket([]byte("blockheights")).Get(encodeHeight(height))
+		if hash == nil {
+			return nil
+		}
+		block = block.Decode(tx.Bucket([]byte("closedblocks")).Get(hash))
+		return nil
+	})
+
+	return block
+}
+
+//Returns up to count closed blocks of the current chain in ascending order, starting at the given height. The range
+//ends early if a height is not indexed (e.g., above the last closed block).
+func ReadClosedBlockRange(height uint32, count int) (blocks []*protocol.Block) {
+
+	db.View(func(tx *bolt.Tx) error {
+		heights := tx.Bucket([]byte("blockheights"))
+		closedBlocks := tx.Bucket([]byte("closedblocks"))
+
+		cursor := heights.Cursor()
+		for k, hash := cursor.Seek(encodeHeight(height)); k != nil && len(blocks) < count; k, hash = cursor.Next() {
+			if binary.BigEndian.Uint32(k) != height+uint32(len(blocks)) {
+				break
+			}
+
+			var block *protocol.Block
+			if block = block.Decode(closedBlocks.Get(hash)); block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+		return nil
+	})
+
+	return blocks
+}
+
+//Returns the block and position of a closed tx, nil if the tx is not part of the current chain.
+func ReadTxLocation(hash [32]byte) (location *TxLocation) {
+
+	db.View(func(tx *bolt.Tx) error {
+		location = location.decode(tx.Bucket([]byte("txindex")).Get(hash[:]))
+		return nil
+	})
+
+	return location
+}
+
+//Returns the hashes of up to count txs of an account in the order they were applied, skipping the first offset txs.
+func ReadAccountTxs(accHash [32]byte, offset, count int) (txHashes [][32]byte) {
+
+	db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte("accounttxs")).Cursor()
+		for k, v := cursor.Seek(accHash[:]); k != nil && bytes.HasPrefix(k, accHash[:]) && len(txHashes) < count; k, v = cursor.Next() {
+			if offset > 0 {
+				offset--
+				continue
+			}
+
+			var txHash [32]byte
+			copy(txHash[:], v)
+			txHashes = append(txHashes, txHash)
+		}
+		return nil
+	})
+
+	return txHashes
+}
+
+//Returns nil if the block has not changed any contract variables.
+func ReadContractDiff(blockHash [32]byte) (diff *protocol.ContractDiff) {
+
+	db.View(func(tx *bolt.Tx) error {
+		diff = diff.Decode(tx.Bucket([]byte("contractdiffs")).Get(blockHash[:]))
+		return nil
+	})
+
+	return diff
+}
+
+//Returns nil if the tx has not been applied by a block.
+func ReadReceipt(txHash [32]byte) (receipt *protocol.Receipt) {
+
+	db.View(func(tx *bolt.Tx) error {
+		receipt = receipt.Decode(tx.Bucket([]byte("receipts")).Get(txHash[:]))
+		return nil
+	})
+
+	return receipt
+}
+
 func ReadLastClosedBlock() (block *protocol.Block) {
 
 	db.View(func(tx *bolt.Tx) error {
@@ -75,26 +173,69 @@ func ReadAllClosedBlocks() (allClosedBlocks []*protocol.Block) {
 	return allClosedBlocks
 }
 
+//Returns the persisted account state. Root accounts point to the same account as in the state map.
+func ReadState() (state map[[32]byte]*protocol.Account, rootKeys map[[32]byte]*protocol.Account) {
+	state = make(map[[32]byte]*protocol.Account)
+	rootKeys = make(map[[32]byte]*protocol.Account)
+
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("accounts"))
+		b.ForEach(func(k, v []byte) error {
+			var accHash [32]byte
+			var acc *protocol.Account
+			copy(accHash[:], k)
+			state[accHash] = acc.Decode(v)
+			return nil
+		})
+
+		b = tx.Bucket([]byte("rootkeys"))
+		b.ForEach(func(k, v []byte) error {
+			var accHash [32]byte
+			copy(accHash[:], k)
+			if acc := state[accHash]; acc != nil {
+				rootKeys[accHash] = acc
+			}
+			return nil
+		})
+		return nil
+	})
+
+	return state, rootKeys
+}
+
 func ReadReceivedBlockStash() (receivedBlocks []*protocol.Block){
 	return receivedBlockStash
 }
 
 func ReadOpenTx(hash [32]byte) (transaction protocol.Transaction) {
 
-	return txMemPool[hash]
+	return txMemPool.get(hash)
 }
 func ReadINVALIDOpenTx(hash [32]byte) (transaction protocol.Transaction) {
 
-	return txINVALIDMemPool[hash]
+	return txINVALIDMemPool.get(hash)
+}
+
+func ReadMemPoolSize() int {
+
+	return txMemPool.len()
 }
 
-//Needed for the miner to prepare a new block
 func ReadAllOpenTxs() (allOpenTxs []protocol.Transaction) {
 
-	for key := range txMemPool {
-		allOpenTxs = append(allOpenTxs, txMemPool[key])
-	}
-	return
+	return txMemPool.all()
+}
+
+//Returns the pending FundsTxs of a sender with the given txCnt.
+func ReadOpenFundsTxs(from [32]byte, txCnt uint32) (fundsTxs []*protocol.FundsTx) {
+
+	return txMemPool.getFundsTxs(from, txCnt)
+}
+
+//Needed for the miner to prepare a new block. Txs are ordered by fee per byte, FundsTxs of the same sender by TxCnt.
+func ReadOpenTxsByFee() (openTxs []protocol.Transaction) {
+
+	return txMemPool.sorted()
 }
 
 //Personally I like it better to test (which tx type it is) here, and get returned the interface. Simplifies the code
@@ -140,5 +281,25 @@ func ReadClosedTx(hash [32]byte) (transaction protocol.Transaction) {
 	if encodedTx != nil {
 		return staketx.Decode(encodedTx)
 	}
+
+	var batchtx *protocol.BatchTx
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("closedbatches"))
+		encodedTx = b.Get(hash[:])
+		return nil
+	})
+	if encodedTx != nil {
+		return batchtx.Decode(encodedTx)
+	}
+
+	var keytx *protocol.KeyTx
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("closedkeys"))
+		encodedTx = b.Get(hash[:])
+		return nil
+	})
+	if encodedTx != nil {
+		return keytx.Decode(encodedTx)
+	}
 	return nil
 }
@@ -14,17 +14,34 @@ var (
 	logger             *log.Logger
 	State              = make(map[[32]byte]*protocol.Account)
 	RootKeys           = make(map[[32]byte]*protocol.Account)
-	txMemPool          = make(map[[32]byte]protocol.Transaction)
-	txINVALIDMemPool          = make(map[[32]byte]protocol.Transaction)
+	txMemPool          = newMemPool()
+	txINVALIDMemPool   = newInvalidMemPool()
 	receivedBlockStash = make([]*protocol.Block, 0)
 	AllClosedBlocksAsc []*protocol.Block
 	Bootstrap_Server   string
+
+	//Mempool limits, can be changed before the miner is started
+	MemPoolMaxSize  uint64 = MEMPOOL_MAX_SIZE
+	MemPoolTxExpiry        = MEMPOOL_TX_EXPIRY
 )
 
+//Position of a closed tx in the chain, Index refers to the merkle tree leaves of the block.
+type TxLocation struct {
+	BlockHash [32]byte
+	Height    uint32
+	Index     uint32
+}
+
 const (
 	ERROR_MSG = "Initiate storage aborted: "
+
+	MEMPOOL_MAX_SIZE        = 32 << 20 //Byte
+	MEMPOOL_TX_EXPIRY       = 3 * time.Hour
+	INVALID_MEMPOOL_MAX_TXS = 10000
 )
 
+var openTxBuckets = []string{"openfunds", "openaccs", "openconfigs", "openstakes", "openbatches", "openkeys"}
+
 //Entry function for the storage package
 func Init(dbname string, bootstrapIpport string) {
 	Bootstrap_Server = bootstrapIpport
@@ -98,6 +115,20 @@ func Init(dbname string, bootstrapIpport string) {
 		}
 		return nil
 	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("closedbatches"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("closedkeys"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
 	db.Update(func(tx *bolt.Tx) error {
 		_, err = tx.CreateBucket([]byte("lastclosedblock"))
 		if err != nil {
@@ -105,12 +136,74 @@ func Init(dbname string, bootstrapIpport string) {
 		}
 		return nil
 	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("blockheights"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("txindex"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("accounttxs"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("contractdiffs"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("receipts"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("accounts"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err = tx.CreateBucket([]byte("rootkeys"))
+		if err != nil {
+			return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+		}
+		return nil
+	})
+	for _, bucket := range openTxBuckets {
+		db.Update(func(tx *bolt.Tx) error {
+			_, err = tx.CreateBucket([]byte(bucket))
+			if err != nil {
+				return fmt.Errorf(ERROR_MSG+"Create bucket: %s", err)
+			}
+			return nil
+		})
+	}
+
+	//The txs that were pending before the last shutdown.
+	txMemPool.load()
 }
 
 func TearDown() {
+	flushMemPool()
 	db.Close()
 }
 
 func PrintMemPoolSize(){
-	// logger.Printf("Number of transactions in the Mempool: %v \n", len(txMemPool))
+	// logger.Printf("Number of transactions in the Mempool: %v \n", txMemPool.len())
 }
\ No newline at end of file
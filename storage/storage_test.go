@@ -295,4 +295,205 @@ func TestReadWriteDeleteBlock(t *testing.T) {
 	if ReadLastClosedBlock() != nil {
 		t.Error("Failed to delete last closed block from storage.\n")
 	}
-}
\ No newline at end of file
+}
+func TestWriteClosedBlockWithState(t *testing.T) {
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	rootHash := protocol.SerializeHashContent(rootAcc.Address)
+
+	b, b2 := new(protocol.Block), new(protocol.Block)
+	b.Hash = [32]byte{'3'}
+	b2.Hash = [32]byte{'4'}
+	b2.PrevHash = b.Hash
+
+	accA.Balance = 1000
+	if err := WriteClosedBlockWithState(b, [][32]byte{accAHash, rootHash}, nil); err != nil {
+		t.Errorf("Failed to write block with state: %v\n", err)
+	}
+
+	accA.Balance = 2000
+	if err := WriteClosedBlockWithState(b2, [][32]byte{accAHash}, nil); err != nil {
+		t.Errorf("Failed to write block with state: %v\n", err)
+	}
+
+	if ReadClosedBlock(b2.Hash) == nil || ReadLastClosedBlock().Hash != b2.Hash {
+		t.Error("Failed to write block to closed and last closed block storage.\n")
+	}
+
+	state, rootKeys := ReadState()
+	if len(state) != 2 || state[accAHash].Balance != 2000 {
+		t.Errorf("Failed to persist state: %v\n", state)
+	}
+	if len(rootKeys) != 1 || rootKeys[rootHash] != state[rootHash] {
+		t.Errorf("Failed to persist root keys: %v\n", rootKeys)
+	}
+
+	//Account A does not exist anymore after the rollback.
+	delete(State, accAHash)
+	if err := DeleteClosedBlockWithState(b2, b, [][32]byte{accAHash}, nil); err != nil {
+		t.Errorf("Failed to delete block with state: %v\n", err)
+	}
+	State[accAHash] = accA
+
+	state, _ = ReadState()
+	if ReadClosedBlock(b2.Hash) != nil || ReadLastClosedBlock().Hash != b.Hash {
+		t.Error("Failed to delete block from closed block storage.\n")
+	}
+	if _, exists := state[accAHash]; exists || len(state) != 1 {
+		t.Errorf("Failed to delete account from persisted state: %v\n", state)
+	}
+
+	DeleteAll()
+	if state, rootKeys = ReadState(); len(state) != 0 || len(rootKeys) != 0 {
+		t.Error("Failed to delete persisted state.\n")
+	}
+}
+
+func TestBlockHeightIndex(t *testing.T) {
+	var blocks []*protocol.Block
+	for height := uint32(0); height < 10; height++ {
+		b := new(protocol.Block)
+		b.Hash = [32]byte{'h', byte(height)}
+		b.Height = height
+		if height > 0 {
+			b.PrevHash = blocks[height-1].Hash
+		}
+		blocks = append(blocks, b)
+
+		if err := WriteClosedBlockWithState(b, nil, nil); err != nil {
+			t.Errorf("Failed to write block with state: %v\n", err)
+		}
+	}
+
+	if b := ReadClosedBlockByHeight(5); b == nil || b.Hash != blocks[5].Hash {
+		t.Errorf("Failed to read block by height: %v\n", b)
+	}
+	if ReadClosedBlockByHeight(10) != nil {
+		t.Error("Read a block above the last closed block.\n")
+	}
+
+	blockRange := ReadClosedBlockRange(3, 4)
+	if len(blockRange) != 4 || blockRange[0].Hash != blocks[3].Hash || blockRange[3].Hash != blocks[6].Hash {
+		t.Errorf("Failed to read block range: %v\n", blockRange)
+	}
+	if blockRange = ReadClosedBlockRange(8, 5); len(blockRange) != 2 {
+		t.Errorf("Block range does not end at the last closed block: %v\n", blockRange)
+	}
+
+	//After the rollback, the height is not indexed anymore.
+	if err := DeleteClosedBlockWithState(blocks[9], blocks[8], nil, nil); err != nil {
+		t.Errorf("Failed to delete block with state: %v\n", err)
+	}
+	if ReadClosedBlockByHeight(9) != nil || len(ReadClosedBlockRange(0, 20)) != 9 {
+		t.Error("Failed to remove rolled back block from height index.\n")
+	}
+
+	DeleteAll()
+	if ReadClosedBlockByHeight(0) != nil {
+		t.Error("Failed to delete height index.\n")
+	}
+}
+
+func TestTxIndex(t *testing.T) {
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+
+	fundsTx, _ := protocol.ConstrFundsTx(0x01, 10, 1, 0, accAHash, accBHash, &PrivKeyA, nil, nil)
+	configTx, _ := protocol.ConstrConfigTx(0, 1, 100, 1, 0, &RootPrivKey)
+
+	b, b2 := new(protocol.Block), new(protocol.Block)
+	b.Hash = [32]byte{'5'}
+	b.Height = 5
+	b.FundsTxData = [][32]byte{{'0'}, fundsTx.Hash()}
+	b.ConfigTxData = [][32]byte{configTx.Hash()}
+	b2.Hash = [32]byte{'6'}
+	b2.Height = 6
+	b2.PrevHash = b.Hash
+
+	if err := WriteClosedBlockWithState(b, nil, nil); err != nil {
+		t.Errorf("Failed to write block with state: %v\n", err)
+	}
+	if err := WriteClosedBlockWithState(b2, nil, nil); err != nil {
+		t.Errorf("Failed to write block with state: %v\n", err)
+	}
+
+	location := ReadTxLocation(fundsTx.Hash())
+	if location == nil || location.BlockHash != b.Hash || location.Height != 5 || location.Index != 1 {
+		t.Errorf("Failed to index fundsTx: %v\n", location)
+	}
+	if location = ReadTxLocation(configTx.Hash()); location == nil || location.Index != 2 {
+		t.Errorf("Failed to index configTx: %v\n", location)
+	}
+
+	//Rolling back another block does not touch the index of b.
+	if err := DeleteClosedBlockWithState(b2, b, nil, nil); err != nil {
+		t.Errorf("Failed to delete block with state: %v\n", err)
+	}
+	if ReadTxLocation(fundsTx.Hash()) == nil {
+		t.Error("Rollback of another block removed the tx from the index.\n")
+	}
+
+	if err := DeleteClosedBlockWithState(b, nil, nil, nil); err != nil {
+		t.Errorf("Failed to delete block with state: %v\n", err)
+	}
+	if ReadTxLocation(fundsTx.Hash()) != nil || ReadTxLocation(configTx.Hash()) != nil {
+		t.Error("Failed to remove rolled back txs from the index.\n")
+	}
+
+	DeleteAll()
+}
+
+func TestAccountTxs(t *testing.T) {
+	accAHash := protocol.SerializeHashContent(accA.Address)
+	accBHash := protocol.SerializeHashContent(accB.Address)
+
+	b, b2 := new(protocol.Block), new(protocol.Block)
+	b.Hash, b.Height = [32]byte{'7'}, 7
+	b2.Hash, b2.Height = [32]byte{'8'}, 8
+
+	var txs, txs2 []protocol.Transaction
+	for i := 0; i < 5; i++ {
+		tx, _ := protocol.ConstrFundsTx(0x01, 10, 1, uint32(i), accAHash, accBHash, &PrivKeyA, nil, nil)
+		b.FundsTxData = append(b.FundsTxData, tx.Hash())
+		txs = append(txs, tx)
+	}
+	stakeTx, _ := protocol.ConstrStakeTx(0, 1, true, accBHash, &PrivKeyB, &CommitmentKeyA.PublicKey)
+	b2.StakeTxData = [][32]byte{stakeTx.Hash()}
+	txs2 = append(txs2, stakeTx)
+
+	if err := WriteClosedBlockWithState(b, nil, &BlockRecords{Txs: txs}); err != nil {
+		t.Errorf("Failed to write account txs: %v\n", err)
+	}
+	if err := WriteClosedBlockWithState(b2, nil, &BlockRecords{Txs: txs2}); err != nil {
+		t.Errorf("Failed to write account txs: %v\n", err)
+	}
+	if ReadClosedTx(stakeTx.Hash()) == nil {
+		t.Error("Txs of the block were not written to closed storage together with the block.")
+	}
+
+	if txHashes := ReadAccountTxs(accAHash, 0, 10); len(txHashes) != 5 || txHashes[0] != txs[0].Hash() {
+		t.Errorf("Failed to read the txs of the sender: %x\n", txHashes)
+	}
+	if txHashes := ReadAccountTxs(accBHash, 0, 10); len(txHashes) != 6 || txHashes[5] != stakeTx.Hash() {
+		t.Errorf("Failed to read the txs of the receiver: %x\n", txHashes)
+	}
+
+	//Pagination
+	if txHashes := ReadAccountTxs(accAHash, 2, 2); len(txHashes) != 2 || txHashes[0] != txs[2].Hash() || txHashes[1] != txs[3].Hash() {
+		t.Errorf("Failed to read a page of txs: %x\n", txHashes)
+	}
+
+	if err := DeleteClosedBlockWithState(b2, b, nil, &BlockRecords{Txs: txs2}); err != nil {
+		t.Errorf("Failed to delete account txs: %v\n", err)
+	}
+	if txHashes := ReadAccountTxs(accBHash, 0, 10); len(txHashes) != 5 {
+		t.Errorf("Failed to remove txs of a rolled back block: %x\n", txHashes)
+	}
+	if ReadClosedTx(stakeTx.Hash()) != nil {
+		t.Error("Txs of the rolled back block are still in closed storage.")
+	}
+
+	DeleteAll()
+	if len(ReadAccountTxs(accAHash, 0, 10)) != 0 {
+		t.Error("Failed to delete account txs.\n")
+	}
+}
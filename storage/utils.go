@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/bazo-blockchain/bazo-miner/protocol"
@@ -90,3 +91,90 @@ func GetFundsTxPubKeys(fundsTxData [][32]byte) (fundsTxPubKeys [][32]byte) {
 
 	return fundsTxPubKeys
 }
+
+//Heights are big endian encoded, this way the keys of the height index are sorted by height.
+func encodeHeight(height uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, height)
+	return key
+}
+
+//Block hash (32 bytes), height and index (4 bytes each, big endian encoded).
+func (location *TxLocation) encode() []byte {
+	encoded := make([]byte, 40)
+	copy(encoded[0:32], location.BlockHash[:])
+	binary.BigEndian.PutUint32(encoded[32:36], location.Height)
+	binary.BigEndian.PutUint32(encoded[36:40], location.Index)
+	return encoded
+}
+
+func (*TxLocation) decode(encoded []byte) *TxLocation {
+	if len(encoded) != 40 {
+		return nil
+	}
+
+	location := new(TxLocation)
+	copy(location.BlockHash[:], encoded[0:32])
+	location.Height = binary.BigEndian.Uint32(encoded[32:36])
+	location.Index = binary.BigEndian.Uint32(encoded[36:40])
+	return location
+}
+
+//Keys of the account history consist of the account hash, the height of the block and the position of the tx in the
+//block followed by the tx hash. This way, the txs of an account are sorted in the order they were applied.
+func accountTxKeys(block *protocol.Block, txs []protocol.Transaction) (keys [][]byte) {
+	positions := make(map[[32]byte]uint32)
+	for index, txHash := range block.TxHashes() {
+		positions[txHash] = uint32(index)
+	}
+
+	for _, tx := range txs {
+		var accHashes [][32]byte
+		switch tx.(type) {
+		case *protocol.FundsTx:
+			accHashes = append(accHashes, tx.(*protocol.FundsTx).From, tx.(*protocol.FundsTx).To)
+		case *protocol.AccTx:
+			accHashes = append(accHashes, tx.(*protocol.AccTx).Issuer, protocol.SerializeHashContent(tx.(*protocol.AccTx).PubKey))
+		case *protocol.StakeTx:
+			accHashes = append(accHashes, tx.(*protocol.StakeTx).Account)
+		case *protocol.BatchTx:
+			accHashes = append(accHashes, tx.(*protocol.BatchTx).From)
+			for _, payment := range tx.(*protocol.BatchTx).Payments {
+				accHashes = append(accHashes, payment.To)
+			}
+		case *protocol.KeyTx:
+			accHashes = append(accHashes, tx.(*protocol.KeyTx).Account)
+		default:
+			continue
+		}
+
+		txHash := tx.Hash()
+		for _, accHash := range accHashes {
+			key := make([]byte, 72)
+			copy(key[0:32], accHash[:])
+			binary.BigEndian.PutUint32(key[32:36], block.Height)
+			binary.BigEndian.PutUint32(key[36:40], positions[txHash])
+			copy(key[40:72], txHash[:])
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func closedTxBucket(tx protocol.Transaction) string {
+	switch tx.(type) {
+	case *protocol.FundsTx:
+		return "closedfunds"
+	case *protocol.AccTx:
+		return "closedaccs"
+	case *protocol.ConfigTx:
+		return "closedconfigs"
+	case *protocol.BatchTx:
+		return "closedbatches"
+	case *protocol.KeyTx:
+		return "closedkeys"
+	}
+
+	return "closedstakes"
+}
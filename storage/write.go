@@ -38,15 +38,177 @@ func WriteLastClosedBlock(block *protocol.Block) (err error) {
 	return err
 }
 
+//Everything a validated block adds to the database besides the block and the state: its closed txs, the history of
+//the involved accounts, the contract variable changes needed to roll it back and the receipts of its txs.
+type BlockRecords struct {
+	Txs          []protocol.Transaction
+	ContractDiff *protocol.ContractDiff
+	Receipts     []*protocol.Receipt
+}
+
+//Writes the block to closed storage, sets it as the last closed block and persists the given accounts of the
+//in-memory state together with the records of the block. All of it happens in a single bolt transaction, so the
+//persisted state and the indexes always correspond to the last closed block.
+func WriteClosedBlockWithState(block *protocol.Block, accHashes [][32]byte, records *BlockRecords) (err error) {
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("closedblocks"))
+		if err := b.Put(block.Hash[:], block.Encode()); err != nil {
+			return err
+		}
+
+		if err := writeBlockIndex(tx, block); err != nil {
+			return err
+		}
+
+		if err := writeLastClosedBlock(tx, block); err != nil {
+			return err
+		}
+
+		if err := writeBlockRecords(tx, block, records); err != nil {
+			return err
+		}
+
+		return writeAccounts(tx, accHashes)
+	})
+
+	return err
+}
+
+//Indexes the given blocks by their height and their txs by hash, replacing existing entries.
+func WriteBlockIndex(blocks []*protocol.Block) (err error) {
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, block := range blocks {
+			if err := writeBlockIndex(tx, block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
+//Writes the records of a block that is already closed, e.g., while the closed blocks are replayed at startup.
+func WriteBlockRecords(block *protocol.Block, records *BlockRecords) (err error) {
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return writeBlockRecords(tx, block, records)
+	})
+
+	return err
+}
+
+//The account history contains the funds, stake and acc txs of a block, the receipts are keyed by tx hash.
+func writeBlockRecords(tx *bolt.Tx, block *protocol.Block, records *BlockRecords) error {
+	if records == nil {
+		return nil
+	}
+
+	for _, transaction := range records.Txs {
+		hash := transaction.Hash()
+		if err := tx.Bucket([]byte(closedTxBucket(transaction))).Put(hash[:], transaction.Encode()); err != nil {
+			return err
+		}
+	}
+
+	b := tx.Bucket([]byte("accounttxs"))
+	for _, key := range accountTxKeys(block, records.Txs) {
+		if err := b.Put(key, key[40:]); err != nil {
+			return err
+		}
+	}
+
+	if !records.ContractDiff.IsEmpty() {
+		if err := tx.Bucket([]byte("contractdiffs")).Put(block.Hash[:], records.ContractDiff.Encode()); err != nil {
+			return err
+		}
+	}
+
+	b = tx.Bucket([]byte("receipts"))
+	for _, receipt := range records.Receipts {
+		if err := b.Put(receipt.TxHash[:], receipt.Encode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeBlockIndex(tx *bolt.Tx, block *protocol.Block) error {
+	if err := tx.Bucket([]byte("blockheights")).Put(encodeHeight(block.Height), block.Hash[:]); err != nil {
+		return err
+	}
+
+	b := tx.Bucket([]byte("txindex"))
+	for index, txHash := range block.TxHashes() {
+		location := TxLocation{block.Hash, block.Height, uint32(index)}
+		if err := b.Put(txHash[:], location.encode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeLastClosedBlock(tx *bolt.Tx, block *protocol.Block) error {
+	b := tx.Bucket([]byte("lastclosedblock"))
+	b.ForEach(func(k, v []byte) error {
+		b.Delete(k)
+		return nil
+	})
+
+	return b.Put(block.Hash[:], block.Encode())
+}
+
+//Accounts that are no longer part of the state (or no longer root) are removed from the corresponding bucket.
+func writeAccounts(tx *bolt.Tx, accHashes [][32]byte) error {
+	accBucket := tx.Bucket([]byte("accounts"))
+	rootBucket := tx.Bucket([]byte("rootkeys"))
+
+	for _, accHash := range accHashes {
+		var err error
+		if acc := State[accHash]; acc != nil {
+			err = accBucket.Put(accHash[:], acc.Encode())
+		} else {
+			err = accBucket.Delete(accHash[:])
+		}
+		if err != nil {
+			return err
+		}
+
+		if IsRootKey(accHash) {
+			err = rootBucket.Put(accHash[:], []byte{1})
+		} else {
+			err = rootBucket.Delete(accHash[:])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 //Changing the "tx" shortcut here and using "transaction" to distinguish between bolt's transactions
-func WriteOpenTx(transaction protocol.Transaction) {
+//Returns an error if the mempool is full and the tx has the lowest fee.
+func WriteOpenTx(transaction protocol.Transaction) error {
+	defer flushMemPool()
 
-	txMemPool[transaction.Hash()] = transaction
+	return txMemPool.add(transaction)
+}
+
+//Replace-by-fee, the signature of the tx needs to be verified beforehand.
+func ReplaceOpenTx(transaction *protocol.FundsTx) error {
+	defer flushMemPool()
+
+	return txMemPool.replace(transaction)
 }
 
 func WriteINVALIDOpenTx(transaction protocol.Transaction) {
 
-	txINVALIDMemPool[transaction.Hash()] = transaction
+	txINVALIDMemPool.add(transaction)
 }
 func WriteToReceivedStash(block *protocol.Block) {
 
@@ -72,21 +234,9 @@ func blockAlreadyInStash(slice []*protocol.Block, newBlockHash [32]byte) bool {
 
 func WriteClosedTx(transaction protocol.Transaction) (err error) {
 
-	var bucket string
-	switch transaction.(type) {
-	case *protocol.FundsTx:
-		bucket = "closedfunds"
-	case *protocol.AccTx:
-		bucket = "closedaccs"
-	case *protocol.ConfigTx:
-		bucket = "closedconfigs"
-	case *protocol.StakeTx:
-		bucket = "closedstakes"
-	}
-
 	hash := transaction.Hash()
 	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+		b := tx.Bucket([]byte(closedTxBucket(transaction)))
 		err := b.Put(hash[:], transaction.Encode())
 		return err
 	})